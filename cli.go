@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"calendar-bot/internal/config"
+	"calendar-bot/internal/logging"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Exit codes shared by every command.
+const (
+	exitOK          = 0   // The command did what it was asked
+	exitFailure     = 1   // The command ran but failed, e.g. the API or every relay was unreachable
+	exitUsage       = 2   // The command line was invalid
+	exitConfig      = 3   // The configuration (environment, .env or flags) was invalid
+	exitInterrupted = 130 // A shutdown signal stopped the command before it finished
+)
+
+// command is one `calendar-bot <name>` subcommand.
+type command struct {
+	name    string
+	args    string // Synopsis of the arguments, shown in the usage lines
+	summary string
+	run     func(args []string) int
+}
+
+// commands lists the subcommands in the order they are shown in the help.
+var commands = []command{
+	{"run", "[flags] [ENV_VAR]", "Publish today's (or the given dates') events once and exit", runRun},
+	{"daemon", "[flags] [ENV_VAR]", "Run continuously, posting each day on an internal schedule", runDaemonCommand},
+	{"backfill", "--from D [--to D] [flags] [ENV_VAR]", "Publish the events of every day in a range, skipping what the ledger has", runBackfill},
+	{"preview", "[flags]", "Print what would be posted for a date, without signing or publishing", runPreview},
+	{"post", "--event ID [--date D] [flags] [ENV_VAR]", "Publish a single API event right away", runPost},
+	{"delete", "--event ID [--date D] [flags] [ENV_VAR]", "Send a NIP-09 deletion request for the events posted for an API event", runDelete},
+	{"relays", "[flags] [RELAY...]", "Check that the configured relays accept connections", runRelays},
+	{"keys", "generate | show [ENV_VAR]", "Generate a new key pair, or show the public key of the configured one", runKeys},
+	{"report", "[flags]", "Summarize exported metrics files", runReport},
+	{"validate", "[flags] [ENV_VAR]", "Check the configuration and exit", runValidate},
+	{"config", "[flags] [ENV_VAR]", "Print the effective configuration with secrets redacted", runConfig},
+}
+
+// runCLI dispatches to the subcommand named by the first argument and returns the exit code.
+// The original form `calendar-bot [flags] <env_var_for_private_key>` is kept as an alias
+// of `run`, so existing cron jobs and docker-compose services keep working.
+func runCLI(args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			if cmd, ok := findCommand(args[1]); ok {
+				return cmd.run([]string{"-h"})
+			}
+		}
+		printUsage(os.Stdout)
+		return exitOK
+	}
+	if cmd, ok := findCommand(args[0]); ok {
+		return cmd.run(args[1:])
+	}
+	if strings.HasPrefix(args[0], "-") || !isCommandName(args[0]) {
+		return runRun(args)
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command '%s'.\n\n", args[0])
+	printUsage(os.Stderr)
+	return exitUsage
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// isCommandName tells a mistyped command (all lower case letters, e.g. "prevew") apart from
+// the name of an env var holding a private key (e.g. "NOSTR_PRIVATE_KEY_EN"), which is
+// passed to `run` for compatibility with the original command line.
+func isCommandName(arg string) bool {
+	for _, r := range arg {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: calendar-bot <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprint(w, `
+ENV_VAR is the name of the environment variable holding the private key, e.g.
+NOSTR_PRIVATE_KEY_EN; --key-env can be used instead. For compatibility,
+"calendar-bot [flags] ENV_VAR" is the same as "calendar-bot run [flags] ENV_VAR".
+
+Settings come from the environment and .env; flags such as --relays or --log-level
+override them for one invocation. Run "calendar-bot <command> -h" for its flags.
+
+Exit codes: 0 success, 1 failure, 2 invalid command line, 3 invalid configuration,
+130 interrupted by a shutdown signal.
+`)
+}
+
+// newFlagSet creates the flag set of a subcommand with a usage message built from its synopsis.
+func newFlagSet(name string, args string, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: calendar-bot %s %s\n\n%s\n\nFlags:\n", name, args, description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args with fs, accepting flags both before and after positional
+// arguments (`run NOSTR_PRIVATE_KEY_EN --dry-run`), and returns the positional ones.
+// The int result is the exit code to return if parsing did not succeed, or -1.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, int) {
+	positional := make([]string, 0, 1)
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, exitOK
+			}
+			return nil, exitUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, -1
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// isFlagSet reports whether the flag called name was given on the command line.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// usageError reports an invalid command line and returns exitUsage.
+func usageError(fs *flag.FlagSet, format string, a ...any) int {
+	fmt.Fprintf(fs.Output(), format+"\n", a...)
+	fmt.Fprintf(fs.Output(), "Run 'calendar-bot %s -h' for usage.\n", fs.Name())
+	return exitUsage
+}
+
+// keyEnvName returns the name of the env var holding the private key, given either as
+// the only positional argument or with --key-env. It may be empty when a profile of the
+// config file names the key's env var instead; config validation reports a missing key.
+func keyEnvName(fs *flag.FlagSet, keyEnvFlag string, positional []string) (string, int) {
+	switch {
+	case len(positional) > 1:
+		return "", usageError(fs, "Too many arguments: %s", strings.Join(positional, " "))
+	case len(positional) == 1 && keyEnvFlag != "" && positional[0] != keyEnvFlag:
+		return "", usageError(fs, "The key env var is given twice: '%s' and --key-env '%s'", positional[0], keyEnvFlag)
+	case len(positional) == 1:
+		return positional[0], -1
+	default:
+		return keyEnvFlag, -1
+	}
+}
+
+// loadConfig loads and validates the configuration with the flag overrides applied, and
+// sets up logging. needKey selects the full validation for commands that sign events.
+// The int result is the exit code to return if loading failed, or -1.
+func loadConfig(keyEnv string, overrides []config.Override, needKey bool, mode string) (*config.Config, int) {
+	var cfg *config.Config
+	var err error
+	if needKey {
+		cfg, err = config.LoadConfig(keyEnv, overrides...)
+	} else {
+		cfg, err = config.LoadPreviewConfig(keyEnv, overrides...)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		return nil, exitConfig
+	}
+	setupLogging([]*config.Config{cfg}, mode)
+	return cfg, -1
+}
+
+// loadConfigs is loadConfig for the commands that run every profile of the config file
+// when none is selected. It returns one configuration per identity to run.
+func loadConfigs(keyEnv string, overrides []config.Override, needKey bool, mode string) ([]*config.Config, int) {
+	var cfgs []*config.Config
+	var err error
+	if needKey {
+		cfgs, err = config.LoadProfiles(keyEnv, overrides...)
+	} else {
+		cfgs, err = config.LoadPreviewProfiles(keyEnv, overrides...)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		return nil, exitConfig
+	}
+	setupLogging(cfgs, mode)
+	return cfgs, -1
+}
+
+// setupLogging sets up logging from the first configuration (log settings are top-level,
+// the same for every profile) and logs what the process is about to run.
+func setupLogging(cfgs []*config.Config, mode string) {
+	cfg := cfgs[0]
+	logging.Setup(cfg)
+	for _, c := range cfgs {
+		event := log.Info().Str("language", c.ProcessingLanguage).Str("mode", mode)
+		if c.Profile != "" {
+			event = event.Str("profile", c.Profile)
+		}
+		event.Msg("Bot configured to process events for language.")
+	}
+	if cfg.Debug {
+		log.Debug().Msg("Debug logging enabled.")
+		log.Debug().
+			Str("os", runtime.GOOS).
+			Str("arch", runtime.GOARCH).
+			Str("goVersion", runtime.Version()).
+			Int("cpus", runtime.NumCPU()).
+			Str("workingDir", getCurrentDirectory()).
+			Str("envVarForPrivateKey", cfg.EnvVarForPrivateKey).
+			Msg("System information")
+		var sensitive []string
+		for _, c := range cfgs {
+			sensitive = append(sensitive, c.EnvVarForPrivateKey, c.KeyPasswordEnv, c.BunkerEnv)
+		}
+		logEnvironmentVariables(sensitive)
+	}
+}
+
+// signalContext returns a context that is cancelled on SIGINT or SIGTERM. Default signal
+// handling is restored at that point, so a second signal terminates the process immediately.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			log.Warn().Msg("Shutdown signal received. Cancelling in-flight publishes and saving remaining events. Send the signal again to force exit.")
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
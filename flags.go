@@ -0,0 +1,191 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"calendar-bot/internal/config"
+)
+
+// configFlag is a command-line flag that overrides one setting read by config.LoadConfig.
+type configFlag struct {
+	name   string
+	usage  string
+	isBool bool
+	apply  func(cfg *config.Config, value string) error
+}
+
+// configFlags are accepted by every command that loads the configuration. A flag only
+// overrides its setting when it is given; otherwise the environment (or its default) wins.
+var configFlags = []configFlag{
+	{name: "config", usage: "YAML or TOML config file declaring settings and profiles (BOT_CONFIG_FILE)", apply: func(cfg *config.Config, v string) error {
+		cfg.ConfigFile = v
+		return nil
+	}},
+	{name: "profile", usage: "profile of the config file to run as (BOT_PROFILE)", apply: func(cfg *config.Config, v string) error {
+		cfg.Profile = v
+		return nil
+	}},
+	{name: "key-file", usage: "file holding the private key, e.g. a Docker secret; read if the key env var is empty", apply: func(cfg *config.Config, v string) error {
+		cfg.KeyFile = v
+		return nil
+	}},
+	{name: "key-password-file", usage: "file holding the password of an ncryptsec private key", apply: func(cfg *config.Config, v string) error {
+		cfg.KeyPasswordFile = v
+		cfg.KeyPasswordEnv = ""
+		return nil
+	}},
+	{name: "bunker-url", usage: "bunker:// URI of a NIP-46 remote signer holding the key (BOT_BUNKER_URL); prefer the env var, flags are visible in ps", apply: func(cfg *config.Config, v string) error {
+		cfg.BunkerURL = v
+		return nil
+	}},
+	{name: "signer-timeout", usage: "how long to wait for each answer of the remote signer, e.g. 30s (BOT_SIGNER_TIMEOUT)", apply: func(cfg *config.Config, v string) (err error) {
+		cfg.SignerTimeout, err = time.ParseDuration(v)
+		return err
+	}},
+	{name: "api-endpoint", usage: "calendar API endpoint (BOT_API_ENDPOINT)", apply: func(cfg *config.Config, v string) error {
+		cfg.APIEndpoint = v
+		return nil
+	}},
+	{name: "api-key", usage: "calendar API key (BOT_API_KEY); prefer the env var, flags are visible in ps", apply: func(cfg *config.Config, v string) error {
+		cfg.APIKey = v
+		return nil
+	}},
+	{name: "language", usage: "language of the events to post (BOT_PROCESSING_LANGUAGE)", apply: func(cfg *config.Config, v string) error {
+		cfg.ProcessingLanguage = v
+		return nil
+	}},
+	{name: "relays", usage: "comma-separated relay URLs (NOSTR_RELAYS)", apply: func(cfg *config.Config, v string) error {
+		cfg.NostrRelays = splitList(v)
+		return nil
+	}},
+	{name: "calendar-title", usage: "publish a NIP-52 calendar with this title listing the published calendar events (BOT_CALENDAR_TITLE)", apply: func(cfg *config.Config, v string) error {
+		cfg.CalendarTitle = v
+		return nil
+	}},
+	{name: "image-max-bytes", usage: "largest image to download and post, in bytes (BOT_IMAGE_MAX_BYTES)", apply: func(cfg *config.Config, v string) (err error) {
+		cfg.ImageMaxBytes, err = strconv.ParseInt(v, 10, 64)
+		return err
+	}},
+	{name: "video-max-bytes", usage: "largest video to download and post, in bytes (BOT_VIDEO_MAX_BYTES)", apply: func(cfg *config.Config, v string) (err error) {
+		cfg.VideoMaxBytes, err = strconv.ParseInt(v, 10, 64)
+		return err
+	}},
+	{name: "image-max-per-event", usage: "most images of an event posted in one picture event (BOT_IMAGE_MAX_PER_EVENT)", apply: func(cfg *config.Config, v string) (err error) {
+		cfg.ImageMaxPerEvent, err = strconv.Atoi(v)
+		return err
+	}},
+	{name: "blossom-server", usage: "Blossom server to store the posted images on, linked instead of the original hosts (BOT_BLOSSOM_SERVER)", apply: func(cfg *config.Config, v string) error {
+		cfg.BlossomServer, cfg.NIP96Server = v, ""
+		return nil
+	}},
+	{name: "nip96-server", usage: "NIP-96 server to store the posted images on, instead of a Blossom server (BOT_NIP96_SERVER)", apply: func(cfg *config.Config, v string) error {
+		cfg.NIP96Server, cfg.BlossomServer = v, ""
+		return nil
+	}},
+	{name: "process-images", usage: "scale down and re-encode images without metadata before storing them, with a thumbnail; needs a media server (BOT_IMAGE_PROCESS)", isBool: true, apply: func(cfg *config.Config, v string) error {
+		enabled, err := strconv.ParseBool(v)
+		cfg.ProcessImages = enabled
+		return err
+	}},
+	{name: "cards", usage: "post a quote card as the picture of events without images; needs a media server (BOT_CARDS)", isBool: true, apply: func(cfg *config.Config, v string) error {
+		enabled, err := strconv.ParseBool(v)
+		cfg.Cards = enabled
+		return err
+	}},
+	{name: "log-dir", usage: "directory of the log files (BOT_LOG_DIR)", apply: func(cfg *config.Config, v string) error {
+		cfg.LogDir = v
+		return nil
+	}},
+	{name: "log-level", usage: "log level: debug, info, warn or error (BOT_LOG_LEVEL)", apply: func(cfg *config.Config, v string) error {
+		cfg.LogLevel = v
+		return nil
+	}},
+	{name: "console-log", usage: "also log to the console (BOT_CONSOLE_LOG)", isBool: true, apply: func(cfg *config.Config, v string) error {
+		enabled, err := strconv.ParseBool(v)
+		cfg.ConsoleLog = enabled
+		return err
+	}},
+	{name: "debug", usage: "enable debug logging and system information (BOT_DEBUG)", isBool: true, apply: func(cfg *config.Config, v string) error {
+		enabled, err := strconv.ParseBool(v)
+		cfg.Debug = enabled
+		return err
+	}},
+	{name: "ledger", usage: "path of the publish ledger database (BOT_LEDGER_PATH)", apply: func(cfg *config.Config, v string) error {
+		cfg.LedgerPath = v
+		return nil
+	}},
+	{name: "schedule-start", usage: "daemon: local time of the first daily posting slot, HH:MM (BOT_SCHEDULE_START)", apply: func(cfg *config.Config, v string) error {
+		cfg.ScheduleStart = v
+		return nil
+	}},
+	{name: "schedule-interval", usage: "daemon: spacing between posting slots, e.g. 30m (BOT_SCHEDULE_INTERVAL)", apply: func(cfg *config.Config, v string) (err error) {
+		cfg.ScheduleInterval, err = time.ParseDuration(v)
+		return err
+	}},
+	{name: "metrics-addr", usage: "daemon: listen address of the Prometheus /metrics endpoint (BOT_METRICS_ADDR)", apply: func(cfg *config.Config, v string) error {
+		cfg.MetricsAddr = v
+		return nil
+	}},
+	{name: "pushgateway-url", usage: "Pushgateway to push one-shot run metrics to (BOT_PUSHGATEWAY_URL)", apply: func(cfg *config.Config, v string) error {
+		cfg.PushgatewayURL = v
+		return nil
+	}},
+	{name: "pushgateway-job", usage: "job name used when pushing to the Pushgateway (BOT_PUSHGATEWAY_JOB)", apply: func(cfg *config.Config, v string) error {
+		cfg.PushgatewayJob = v
+		return nil
+	}},
+	{name: "metrics-retention-days", usage: "delete exported metrics files older than this many days, 0 keeps all (BOT_METRICS_RETENTION_DAYS)", apply: func(cfg *config.Config, v string) (err error) {
+		cfg.MetricsRetentionDays, err = strconv.Atoi(v)
+		return err
+	}},
+	{name: "backfill-pace", usage: "backfill: wait after each published event, e.g. 5m (BOT_BACKFILL_PACE)", apply: func(cfg *config.Config, v string) (err error) {
+		cfg.BackfillPace, err = time.ParseDuration(v)
+		return err
+	}},
+}
+
+// addConfigFlags registers the configuration flags on fs. The returned function, called
+// after parsing, turns the flags that were given into config overrides.
+func addConfigFlags(fs *flag.FlagSet) func() []config.Override {
+	byName := make(map[string]configFlag, len(configFlags))
+	for _, cf := range configFlags {
+		byName[cf.name] = cf
+		if cf.isBool {
+			fs.Bool(cf.name, false, cf.usage)
+		} else {
+			fs.String(cf.name, "", cf.usage)
+		}
+	}
+	return func() []config.Override {
+		overrides := make([]config.Override, 0)
+		fs.Visit(func(f *flag.Flag) {
+			cf, ok := byName[f.Name]
+			if !ok {
+				return
+			}
+			value := f.Value.String()
+			overrides = append(overrides, func(cfg *config.Config) error {
+				if err := cf.apply(cfg, value); err != nil {
+					return fmt.Errorf("invalid --%s '%s': %w", cf.name, value, err)
+				}
+				return nil
+			})
+		})
+		return overrides
+	}
+}
+
+// splitList splits a comma-separated list, trimming whitespace and dropping empty items.
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,175 @@
+package blossom
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"calendar-bot/internal/media"
+	"calendar-bot/internal/signer"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/rs/zerolog/log"
+)
+
+// authorizationLifetime is how long a signed authorization stays valid. It only has to
+// outlive one request.
+const authorizationLifetime = 5 * time.Minute
+
+// BlobDescriptor is a server's description of a stored blob (BUD-02).
+type BlobDescriptor struct {
+	URL      string `json:"url"`
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+	Type     string `json:"type,omitempty"`
+	Uploaded int64  `json:"uploaded"`
+}
+
+// Client stores blobs on one Blossom server, authorizing each request with a kind 24242
+// event signed as the bot's identity (BUD-01). It is a media.Store.
+type Client struct {
+	server string
+	signer signer.Signer
+	http   *http.Client
+}
+
+// NewClient creates a client for the Blossom server at serverURL, e.g.
+// "https://blossom.example.com".
+func NewClient(serverURL string, eventSigner signer.Signer) *Client {
+	return &Client{
+		server: strings.TrimRight(serverURL, "/"),
+		signer: eventSigner,
+		http:   &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Server returns the server's base URL.
+func (c *Client) Server() string {
+	return c.server
+}
+
+// Store copies an image to the server: the server is asked to mirror img.URL, and the
+// downloaded image is uploaded if it cannot. Images without a URL, such as rendered
+// cards, are uploaded. Blobs are stored as they are, so the copy differs from the
+// original only in its URL.
+func (c *Client) Store(ctx context.Context, img media.Image, download func(ctx context.Context) ([]byte, error)) (media.Stored, error) {
+	if img.URL != "" {
+		descriptor, err := c.Mirror(ctx, img.URL, img.SHA256)
+		if err == nil {
+			return media.Stored{URL: descriptor.URL}, nil
+		}
+		log.Debug().Err(err).Str("mediaURL", img.URL).Msg("Blossom server did not mirror the image. Uploading it instead.")
+	}
+	data, err := download(ctx)
+	if err != nil {
+		return media.Stored{}, err
+	}
+	descriptor, err := c.Upload(ctx, data, img.MediaType)
+	if err != nil {
+		return media.Stored{}, err
+	}
+	if descriptor.SHA256 != img.SHA256 {
+		// The original changed since it was inspected; its imeta would describe another image
+		return media.Stored{}, fmt.Errorf("%s changed while it was being stored", img.URL)
+	}
+	return media.Stored{URL: descriptor.URL}, nil
+}
+
+// Mirror asks the server to download the blob at sourceURL itself (BUD-04). hash is the
+// expected hex SHA-256 of the blob; a server storing different content is an error.
+func (c *Client) Mirror(ctx context.Context, sourceURL string, hash string) (BlobDescriptor, error) {
+	body, err := json.Marshal(map[string]string{"url": sourceURL})
+	if err != nil {
+		return BlobDescriptor{}, fmt.Errorf("failed to encode mirror request: %w", err)
+	}
+	auth, err := c.authorization(ctx, hash, "Mirror image")
+	if err != nil {
+		return BlobDescriptor{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.server+"/mirror", bytes.NewReader(body))
+	if err != nil {
+		return BlobDescriptor{}, fmt.Errorf("failed to create mirror request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", auth)
+	return c.do(req, hash)
+}
+
+// Upload stores data on the server (BUD-02) and returns its descriptor.
+func (c *Client) Upload(ctx context.Context, data []byte, mediaType string) (BlobDescriptor, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	auth, err := c.authorization(ctx, hash, "Upload image")
+	if err != nil {
+		return BlobDescriptor{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.server+"/upload", bytes.NewReader(data))
+	if err != nil {
+		return BlobDescriptor{}, fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", mediaType)
+	req.Header.Set("X-SHA-256", hash)
+	req.Header.Set("Authorization", auth)
+	return c.do(req, hash)
+}
+
+// authorization returns the Authorization header of an upload of the blob with the given
+// hash: a signed kind 24242 event, valid for authorizationLifetime.
+func (c *Client) authorization(ctx context.Context, hash string, content string) (string, error) {
+	ev := nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindBlobs,
+		Content:   content,
+		Tags: nostr.Tags{
+			{"t", "upload"},
+			{"x", hash},
+			{"expiration", strconv.FormatInt(time.Now().Add(authorizationLifetime).Unix(), 10)},
+		},
+	}
+	if err := c.signer.Sign(ctx, &ev); err != nil {
+		return "", fmt.Errorf("failed to sign Blossom authorization: %w", err)
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode Blossom authorization: %w", err)
+	}
+	return "Nostr " + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// do sends a request storing a blob and checks that the server stored the expected hash.
+func (c *Client) do(req *http.Request, hash string) (BlobDescriptor, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return BlobDescriptor{}, fmt.Errorf("Blossom request to %s failed: %w", req.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		reason := resp.Header.Get("X-Reason")
+		if reason == "" {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			reason = strings.TrimSpace(string(body))
+		}
+		return BlobDescriptor{}, fmt.Errorf("Blossom server %s returned status %d: %s", req.URL, resp.StatusCode, reason)
+	}
+	var descriptor BlobDescriptor
+	if err := json.NewDecoder(resp.Body).Decode(&descriptor); err != nil {
+		return BlobDescriptor{}, fmt.Errorf("failed to decode blob descriptor from %s: %w", req.URL, err)
+	}
+	if descriptor.SHA256 != hash {
+		return BlobDescriptor{}, fmt.Errorf("Blossom server %s stored blob %s, expected %s", req.URL, descriptor.SHA256, hash)
+	}
+	if descriptor.URL == "" {
+		return BlobDescriptor{}, fmt.Errorf("Blossom server %s returned no URL for blob %s", req.URL, hash)
+	}
+	return descriptor, nil
+}
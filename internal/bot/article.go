@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"calendar-bot/internal/metrics"
+	"calendar-bot/internal/nostr"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/rs/zerolog"
+)
+
+// articleLink returns the link to the NIP-23 article of an API event published by pubkey
+// to relays, or no link if the pubkey is unknown or the link cannot be encoded. The notes
+// are still published without it.
+func (b *Bot) articleLink(logger zerolog.Logger, pubkey string, apiEventID uint, relays []string) nostr.ArticleLink {
+	if pubkey == "" {
+		return nostr.ArticleLink{}
+	}
+	link, err := nostr.NewArticleLink(pubkey, apiEventID, relays)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to create article link. Posting notes without it.")
+		return nostr.ArticleLink{}
+	}
+	return link
+}
+
+// articlePublishedAt returns when the article of an API event was first published: the
+// creation time of its earliest version in the ledger, or now for a new article. Every
+// posting year republishes the article under the same d tag, keeping this date.
+func (b *Bot) articlePublishedAt(logger zerolog.Logger, apiEventID uint) gonostr.Timestamp {
+	publishedAt := gonostr.Now()
+	if b.ledger == nil {
+		return publishedAt
+	}
+	entries, err := b.ledger.EntriesOfKind(metrics.KindArticle)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to look up earlier versions of the article. Using the current time as its publication date.")
+		return publishedAt
+	}
+	for _, entry := range entries {
+		if entry.APIEventID == apiEventID && entry.Event.CreatedAt < publishedAt {
+			publishedAt = entry.Event.CreatedAt
+		}
+	}
+	return publishedAt
+}
@@ -0,0 +1,524 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"calendar-bot/internal/api"
+	"calendar-bot/internal/card"
+	"calendar-bot/internal/ledger"
+	"calendar-bot/internal/media"
+	"calendar-bot/internal/metrics"
+	"calendar-bot/internal/models"
+	"calendar-bot/internal/nostr"
+	"calendar-bot/internal/signer"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/rs/zerolog"
+)
+
+// DefaultMetricsDir is where per-run metrics files are exported unless SetMetricsDir
+// chooses another directory.
+const DefaultMetricsDir = "metrics-logs"
+
+// Bot ties together the API client, the publish ledger and the Nostr publisher
+// and knows how to publish the events of one calendar day.
+type Bot struct {
+	api        *api.Client
+	publisher  *nostr.EventPublisher
+	validator  *nostr.ImageValidator
+	ledger     *ledger.Ledger
+	language   string
+	templates  Templates        // Content templates per kind, empty to use the built-in content
+	calendar   string           // Title of the NIP-52 calendar listing the published calendar events, empty to not publish one
+	maxImages  int              // Most images in one picture event
+	mediaStore media.Store      // Server the posted images are stored on, nil to link the original URLs
+	processor  *media.Processor // Processes images before they are stored, nil to store them as they are
+	cards      *card.Renderer   // Draws the picture of events without images, nil to post none
+	logger     zerolog.Logger
+
+	metricsDir           string // Where per-run metrics files are exported
+	metricsRetentionDays int    // Exported metrics files older than this are pruned after each run, 0 keeps everything
+
+	mu      sync.Mutex // Guards metrics, which the metrics endpoint reads from another goroutine
+	metrics *metrics.Collector
+}
+
+// New creates a Bot. A fresh metrics collector is started for the first run.
+// publisher and publishLedger may be nil for a Bot that is only used for previews.
+func New(apiClient *api.Client, publisher *nostr.EventPublisher, validator *nostr.ImageValidator, publishLedger *ledger.Ledger, language string, logger zerolog.Logger) *Bot {
+	b := &Bot{
+		api:       apiClient,
+		publisher: publisher,
+		validator: validator,
+		ledger:    publishLedger,
+		language:  language,
+		maxImages: nostr.DefaultMaxImages,
+		logger:    logger,
+
+		metricsDir: DefaultMetricsDir,
+	}
+	b.StartRun()
+	return b
+}
+
+// Metrics returns the collector of the current run. It is safe to call from any goroutine.
+func (b *Bot) Metrics() *metrics.Collector {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.metrics
+}
+
+// StartRun begins a new run with a fresh metrics collector.
+func (b *Bot) StartRun() *metrics.Collector {
+	collector := metrics.NewCollector()
+	b.mu.Lock()
+	b.metrics = collector
+	b.mu.Unlock()
+	if b.publisher != nil {
+		b.publisher.SetMetrics(collector)
+	}
+	return collector
+}
+
+// FinishRun logs the metrics summary of the current run and exports it to the metrics directory.
+// The prefix distinguishes the kind of run in the file name (e.g. "run" or "error").
+func (b *Bot) FinishRun(prefix string) {
+	b.metrics.LogSummary()
+	filePath, err := b.metrics.ExportToDir(b.metricsDir, prefix)
+	if err != nil {
+		b.logger.Error().Err(err).Str("directory", b.metricsDir).Msg("Failed to export metrics")
+		return
+	}
+	b.logger.Info().Str("file", filePath).Msg("Metrics exported successfully")
+
+	if b.metricsRetentionDays > 0 {
+		removed, err := metrics.PruneDir(b.metricsDir, time.Now().AddDate(0, 0, -b.metricsRetentionDays))
+		if err != nil {
+			b.logger.Error().Err(err).Str("directory", b.metricsDir).Msg("Failed to prune old metrics files")
+			return
+		}
+		if len(removed) > 0 {
+			b.logger.Info().Int("removedCount", len(removed)).Int("retentionDays", b.metricsRetentionDays).Msg("Pruned old metrics files.")
+		}
+	}
+}
+
+// SetMetricsDir sets the directory per-run metrics files are exported to and pruned from,
+// e.g. one per profile when several run in one process.
+func (b *Bot) SetMetricsDir(dir string) {
+	b.metricsDir = dir
+}
+
+// SetMetricsRetention makes FinishRun delete exported metrics files older than the given
+// number of days. Zero keeps every file.
+func (b *Bot) SetMetricsRetention(days int) {
+	b.metricsRetentionDays = days
+}
+
+// SetMaxImages limits how many images of an API event's media one picture event includes.
+func (b *Bot) SetMaxImages(n int) {
+	b.maxImages = n
+}
+
+// FetchDayEvents fetches the events of the given calendar day from the API and
+// returns those whose month and day match.
+func (b *Bot) FetchDayEvents(day time.Time) ([]models.APIEvent, error) {
+	monthDay := day.Format("01-02") // Format is "MM-DD"
+	month, dayOfMonth := day.Format("01"), day.Format("02")
+	b.logger.Debug().Str("month", month).Str("day", dayOfMonth).Msg("Extracted month and day for API query")
+
+	apiEvents, err := b.api.FetchEvents(month, dayOfMonth, b.language)
+	if err != nil {
+		return nil, err
+	}
+	b.logger.Info().Int("eventsFetchedCount", len(apiEvents)).Msg("Successfully fetched events from API.")
+
+	matching := make([]models.APIEvent, 0, len(apiEvents))
+	for _, apiEvent := range apiEvents {
+		if apiEvent.Date.Format("01-02") != monthDay {
+			b.metrics.RecordDateMismatch()
+			b.logger.Debug().Uint("apiEventID", apiEvent.ID).Str("eventTitle", apiEvent.Title).Str("eventAPIDate", apiEvent.Date.Format("2006-01-02")).Msg("Skipped API event: Date does not match requested day.")
+			continue
+		}
+		matching = append(matching, apiEvent)
+	}
+	return matching, nil
+}
+
+// RunDay publishes all events of the given day one after another, waiting the
+// publisher's default wait time after each freshly published Kind 1 event.
+// This is the one-shot behaviour used by cron-driven runs. If ctx is cancelled,
+// the events that were not finished are saved so the next run resumes from there.
+func (b *Bot) RunDay(ctx context.Context, day time.Time) error {
+	return b.RunDays(ctx, []time.Time{day}, b.publisher.DefaultWaitTime())
+}
+
+// RunDays publishes the events of each given day in order, e.g. to re-run missed days.
+// The publish ledger keyed by posting date makes it safe to include days that were
+// already (partly) posted: only what is missing is published. pace is the wait after
+// each freshly published Kind 1 event, across day boundaries too, but not after the last one.
+// The calendar, if enabled, is updated once after the last day.
+func (b *Bot) RunDays(ctx context.Context, days []time.Time, pace time.Duration) error {
+	for i, day := range days {
+		if err := b.runDay(ctx, day, pace, i < len(days)-1); err != nil {
+			return err
+		}
+	}
+	if len(days) > 0 {
+		b.publishCalendar(ctx, days[len(days)-1])
+	}
+	return nil
+}
+
+// runDay publishes the events of one day. waitAfterLast makes it pace after the
+// day's last event as well, when more days follow.
+func (b *Bot) runDay(ctx context.Context, day time.Time, pace time.Duration, waitAfterLast bool) error {
+	b.logger.Info().Str("date", day.Format("2006-01-02")).Msg("Starting bot execution. Fetching events from API.")
+
+	apiEvents, err := b.loadDayEvents(day)
+	if err != nil {
+		return fmt.Errorf("failed to fetch events from API for %s: %w", day.Format("2006-01-02"), err)
+	}
+	if len(apiEvents) == 0 {
+		b.logger.Info().Str("date", day.Format("2006-01-02")).Msg("No events found for this date after checking all fetched events.")
+		return nil
+	}
+
+	for i, apiEvent := range apiEvents {
+		published, err := b.ProcessEvent(ctx, day, apiEvent)
+		if err != nil {
+			b.saveRemaining(day, apiEvents[i:])
+			return err
+		}
+		if !published || pace <= 0 || (i == len(apiEvents)-1 && !waitAfterLast) {
+			continue
+		}
+		// Wait between posts if at least 1 Kind 1 event was successfully published.
+		b.logger.Info().Msgf("Waiting %v after processing event ID %d before next event...", pace, apiEvent.ID)
+		if err := SleepContext(ctx, pace); err != nil {
+			b.saveRemaining(day, apiEvents[i+1:])
+			return err
+		}
+	}
+	b.clearQueue()
+	return nil
+}
+
+// loadDayEvents returns the events of day, resuming the queue saved by an interrupted
+// run for the same day if there is one, and fetching them from the API otherwise.
+func (b *Bot) loadDayEvents(day time.Time) ([]models.APIEvent, error) {
+	postingDate := day.Format("2006-01-02")
+	queue, err := b.ledger.LoadQueue()
+	if err != nil {
+		b.logger.Error().Err(err).Msg("Failed to load the queue of an interrupted run. Fetching events instead.")
+	} else if queue != nil {
+		if queue.Date == postingDate {
+			b.logger.Info().Str("date", queue.Date).Int("remainingEvents", len(queue.Events)).Time("savedAt", queue.SavedAt).Msg("Resuming interrupted run from saved queue.")
+			return queue.Events, nil
+		}
+		b.logger.Warn().Str("queueDate", queue.Date).Int("remainingEvents", len(queue.Events)).Msg("Discarding saved queue of an interrupted run for a different day.")
+		b.clearQueue()
+	}
+	return b.FetchDayEvents(day)
+}
+
+// saveRemaining persists the events an interrupted run did not finish. The ledger makes
+// it safe to include an event that was partially published: it will be resumed, not reposted.
+func (b *Bot) saveRemaining(day time.Time, remaining []models.APIEvent) {
+	if len(remaining) == 0 {
+		b.clearQueue()
+		return
+	}
+	if err := b.ledger.SaveQueue(day.Format("2006-01-02"), remaining); err != nil {
+		b.logger.Error().Err(err).Msg("Failed to persist remaining events of interrupted run.")
+		return
+	}
+	b.logger.Info().Int("remainingEvents", len(remaining)).Msg("Persisted remaining events. The next start will resume from here.")
+}
+
+// clearQueue removes the saved queue once a day's work is complete.
+func (b *Bot) clearQueue() {
+	if err := b.ledger.ClearQueue(); err != nil {
+		b.logger.Error().Err(err).Msg("Failed to clear saved queue.")
+	}
+}
+
+// kindBuilder builds the Nostr event of one kind for an API event. build reports whether
+// the API event qualifies for the kind at all; ctx cancels the media downloads it needs.
+type kindBuilder struct {
+	kind  string // Ledger and metrics kind name, e.g. "kind1"
+	label string // Human-readable name for logs, e.g. "Kind 1"
+	build func(ctx context.Context) (gonostr.Event, bool, error)
+}
+
+// builders prepares the API event's URLs and tags and returns the builders of every
+// kind the bot posts for it on the posting day, in posting order. Publishing and
+// previews share them, so a preview shows exactly what would be published. The article
+// comes first so the notes linking to it never point at an article that was not
+// attempted yet.
+func (b *Bot) builders(logger zerolog.Logger, day time.Time, apiEvent models.APIEvent, article nostr.ArticleLink) []kindBuilder {
+	// Clean up media and reference URLs
+	apiEvent.Media = append([]string(nil), apiEvent.Media...)
+	for i := range apiEvent.Media {
+		apiEvent.Media[i] = cleanURL(apiEvent.Media[i])
+	}
+	currentEventAPIReferences := make([]string, 0, len(apiEvent.References))
+	for _, ref := range apiEvent.References {
+		currentEventAPIReferences = append(currentEventAPIReferences, cleanURL(ref))
+	}
+
+	// Parse tags once for all kinds
+	var currentEventAPITags []string
+	if apiEvent.Tags != "" && apiEvent.Tags != "[]" {
+		if err := json.Unmarshal([]byte(apiEvent.Tags), &currentEventAPITags); err != nil {
+			logger.Warn().Err(err).Str("tagsString", apiEvent.Tags).Msg("Failed to unmarshal event Tags. Proceeding with no API tags.")
+		}
+	}
+
+	// The images are stored on the media server, and a card added, when the first kind is
+	// built: kinds the ledger already has are skipped or resumed without touching them.
+	// Preparation cut short by ctx is not kept, like the video selection below.
+	var mediaMu sync.Mutex
+	var prepared *models.APIEvent
+	withMedia := func(ctx context.Context) models.APIEvent {
+		mediaMu.Lock()
+		defer mediaMu.Unlock()
+		if prepared != nil {
+			return *prepared
+		}
+		event := b.storeMedia(ctx, logger, apiEvent)
+		event = b.addCard(ctx, logger, day, event)
+		if ctx.Err() == nil {
+			prepared = &event
+		}
+		return event
+	}
+
+	// Both video kinds post the same video, chosen once, so a broken video is counted once.
+	// A selection cut short by ctx is not kept: the kinds are not published then anyway.
+	var videoMu sync.Mutex
+	var selected *media.Video
+	video := func(ctx context.Context) media.Video {
+		videoMu.Lock()
+		defer videoMu.Unlock()
+		if selected != nil {
+			return *selected
+		}
+		video, _ := nostr.SelectVideo(ctx, apiEvent, b.validator, func(mediaURL string, err error) {
+			b.metrics.RecordVideoValidationFailure(mediaURL, media.Reason(err))
+		})
+		if ctx.Err() == nil {
+			selected = &video
+		}
+		return video
+	}
+	// Videos are linked from their original URLs, so the media is only prepared for the
+	// poster of a video that is posted as this kind.
+	videoEvent := func(ctx context.Context, kind int) (gonostr.Event, bool, error) {
+		video := video(ctx)
+		event := apiEvent
+		if video.URL != "" && nostr.VideoKind(video) == kind {
+			event = withMedia(ctx)
+		}
+		return nostr.CreateVideoNostrEvent(ctx, event, currentEventAPITags, currentEventAPIReferences, b.validator, video, kind)
+	}
+
+	builders := []kindBuilder{
+		{kind: metrics.KindArticle, label: "Kind 30023", build: func(ctx context.Context) (gonostr.Event, bool, error) {
+			ev, err := nostr.CreateArticleNostrEvent(ctx, withMedia(ctx), currentEventAPITags, currentEventAPIReferences, b.validator, b.articlePublishedAt(logger, apiEvent.ID))
+			return ev, err == nil, err
+		}},
+		{kind: metrics.KindNote, label: "Kind 1", build: func(ctx context.Context) (gonostr.Event, bool, error) {
+			ev, err := nostr.CreateKind1NostrEvent(withMedia(ctx), currentEventAPITags, article)
+			return ev, err == nil, err
+		}},
+		{kind: metrics.KindPicture, label: "Kind 20", build: func(ctx context.Context) (gonostr.Event, bool, error) {
+			return nostr.CreateKind20NostrEvent(ctx, withMedia(ctx), currentEventAPITags, currentEventAPIReferences, b.validator, b.maxImages, func(mediaURL string, err error) {
+				b.metrics.RecordImageValidationFailure(mediaURL, media.Reason(err))
+			})
+		}},
+		{kind: metrics.KindVideo, label: "Kind 21", build: func(ctx context.Context) (gonostr.Event, bool, error) {
+			return videoEvent(ctx, nostr.KindVideo)
+		}},
+		{kind: metrics.KindShortVideo, label: "Kind 22", build: func(ctx context.Context) (gonostr.Event, bool, error) {
+			return videoEvent(ctx, nostr.KindShortVideo)
+		}},
+		{kind: metrics.KindCalendarEvent, label: "Kind 31922", build: func(ctx context.Context) (gonostr.Event, bool, error) {
+			ev, err := nostr.CreateCalendarNostrEvent(ctx, withMedia(ctx), currentEventAPITags, currentEventAPIReferences, b.validator)
+			return ev, err == nil, err
+		}},
+	}
+
+	// Render the content of kinds that have a template once the event is built
+	for i := range builders {
+		kind, build := builders[i].kind, builders[i].build
+		builders[i].build = func(ctx context.Context) (gonostr.Event, bool, error) {
+			ev, qualifies, err := build(ctx)
+			if err != nil || !qualifies {
+				return ev, qualifies, err
+			}
+			ev.Content, err = b.templates.render(kind, withMedia(ctx), currentEventAPITags, currentEventAPIReferences, article, ev.Content)
+			return ev, err == nil, err
+		}
+	}
+	return builders
+}
+
+// ProcessEvent publishes every kind of Nostr event for one API event on the given posting day.
+// Returns true if a Kind 1 event was freshly published during this call, and the context's
+// error if ctx was cancelled before the event was fully processed.
+func (b *Bot) ProcessEvent(ctx context.Context, day time.Time, apiEvent models.APIEvent) (bool, error) {
+	postingDate := day.Format("2006-01-02") // Ledger key, includes the year since events recur annually
+	requestID := fmt.Sprintf("api-event-%d-%s-%d", apiEvent.ID, day.Format("01-02"), time.Now().UnixNano())
+	eventSpecificLogger := b.logger.With().Str("requestID", requestID).Uint("apiEventID", apiEvent.ID).Logger()
+	eventSpecificLogger.Info().Str("eventTitle", apiEvent.Title).Msg("Processing matching API event for today")
+
+	kind1PublishedSuccessfully := false
+	article := b.articleLink(eventSpecificLogger, b.publisher.PublicKey(), apiEvent.ID, b.publisher.RelaysFor(metrics.KindArticle))
+	for _, builder := range b.builders(eventSpecificLogger, day, apiEvent, article) {
+		if err := ctx.Err(); err != nil {
+			return kind1PublishedSuccessfully, err
+		}
+
+		eventSpecificLogger.Info().Msgf("Attempting to publish %s event.", builder.label)
+		switch b.publishWithLedger(ctx, eventSpecificLogger, apiEvent, postingDate, builder.kind, builder.build) {
+		case publishPublished:
+			eventSpecificLogger.Info().Msgf("%s event successfully published.", builder.label)
+			b.metrics.RecordEvent(builder.kind, metrics.ResultPosted)
+			if builder.kind == metrics.KindNote {
+				kind1PublishedSuccessfully = true
+			}
+		case publishAlreadyDone:
+			b.metrics.RecordEvent(builder.kind, metrics.ResultAlreadyPublished)
+		case publishNotQualified:
+			eventSpecificLogger.Info().Msgf("Event did not qualify for %s publishing (e.g., no valid image, or other criteria).", builder.label)
+			b.metrics.RecordEvent(builder.kind, metrics.ResultSkipped)
+		default:
+			eventSpecificLogger.Warn().Msgf("%s event failed to publish to any relay.", builder.label)
+			b.metrics.RecordEvent(builder.kind, metrics.ResultFailed)
+		}
+	}
+
+	return kind1PublishedSuccessfully, ctx.Err()
+}
+
+// publishOutcome describes what happened to one kind of one API event during a run.
+type publishOutcome int
+
+const (
+	publishFailed       publishOutcome = iota // Building, signing or publishing failed
+	publishPublished                          // Posted to at least one relay during this run
+	publishAlreadyDone                        // Already posted by an earlier run according to the ledger
+	publishNotQualified                       // The event does not qualify for this kind
+)
+
+// publishWithLedger consults the publish ledger before building an event of the given kind.
+// Events that are already fully published are skipped, events that an earlier run signed but
+// did not deliver everywhere are resumed on the missing relays, and freshly built events are
+// recorded in the ledger before and after they reach each relay.
+func (b *Bot) publishWithLedger(
+	ctx context.Context,
+	logger zerolog.Logger,
+	apiEvent models.APIEvent,
+	date string,
+	kind string,
+	build func(ctx context.Context) (gonostr.Event, bool, error),
+) publishOutcome {
+	entry, err := b.ledger.Get(apiEvent.ID, date, kind)
+	if err != nil {
+		// Without the ledger we cannot tell whether this would be a double post.
+		logger.Error().Err(err).Str("eventType", kind).Msg("Failed to consult publish ledger. Not publishing.")
+		return publishFailed
+	}
+
+	if entry != nil {
+		missingRelays := entry.MissingRelays(b.publisher.RelaysFor(kind))
+		if entry.Published() && len(missingRelays) == 0 {
+			logger.Info().Str("eventType", kind).Str("nostrEventID", entry.NostrEventID).Msg("Event already published to all relays according to the ledger. Skipping.")
+			return publishAlreadyDone
+		}
+
+		logger.Info().Str("eventType", kind).Str("nostrEventID", entry.NostrEventID).Strs("missingRelays", missingRelays).Msg("Resuming ledger event on relays that have not received it yet.")
+		acceptedRelays := b.publisher.PublishSignedEvent(ctx, apiEvent, entry.Event, kind, missingRelays).SuccessfulRelays()
+		b.recordRelays(logger, apiEvent.ID, date, kind, acceptedRelays)
+		switch {
+		case entry.Published():
+			return publishAlreadyDone
+		case len(acceptedRelays) > 0:
+			return publishPublished
+		default:
+			return publishFailed
+		}
+	}
+
+	nostrEv, qualified, err := build(ctx)
+	if err != nil {
+		logger.Error().Err(err).Str("eventType", kind).Msg("Failed to create Nostr event object.")
+		return publishFailed
+	}
+	if !qualified {
+		return publishNotQualified
+	}
+
+	if err := b.publisher.SignEvent(ctx, &nostrEv); err != nil {
+		if errors.Is(err, signer.ErrPermissionDenied) {
+			logger.Error().Err(err).Str("eventType", kind).Msg("Remote signer refused to sign the event. Grant the bot sign_event permission for this kind.")
+		} else {
+			logger.Error().Err(err).Str("eventType", kind).Msg("Failed to sign Nostr event.")
+		}
+		return publishFailed
+	}
+	if _, err := b.ledger.RecordSigned(apiEvent.ID, date, kind, nostrEv); err != nil {
+		logger.Error().Err(err).Str("eventType", kind).Msg("Failed to record signed event in publish ledger. Not publishing.")
+		return publishFailed
+	}
+
+	acceptedRelays := b.publisher.PublishSignedEvent(ctx, apiEvent, nostrEv, kind, b.publisher.RelaysFor(kind)).SuccessfulRelays()
+	b.recordRelays(logger, apiEvent.ID, date, kind, acceptedRelays)
+	if len(acceptedRelays) == 0 {
+		return publishFailed
+	}
+	return publishPublished
+}
+
+// recordRelays writes every relay that accepted an event into the publish ledger.
+func (b *Bot) recordRelays(logger zerolog.Logger, apiEventID uint, date string, kind string, relays []string) {
+	for _, relayURL := range relays {
+		if err := b.ledger.RecordRelay(apiEventID, date, kind, relayURL); err != nil {
+			logger.Error().Err(err).Str("eventType", kind).Str("relayURL", relayURL).Msg("Failed to record relay publish in ledger.")
+		}
+	}
+}
+
+// cleanURL removes unwanted characters and formatting from a URL string.
+func cleanURL(url string) string {
+	// First, remove leading/trailing whitespace
+	cleaned := strings.TrimSpace(url)
+	// Remove potential JSON array wrapping for single items
+	cleaned = strings.TrimPrefix(cleaned, "[\"")
+	cleaned = strings.TrimSuffix(cleaned, "\"]")
+	// Remove list-like prefixes
+	cleaned = strings.TrimPrefix(cleaned, "- ")
+	// Trim space again in case the prefixes left any
+	cleaned = strings.TrimSpace(cleaned)
+	return cleaned
+}
+
+// SleepContext waits for the given duration or until the context is cancelled,
+// in which case the context's error is returned.
+func SleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"calendar-bot/internal/ledger"
+	"calendar-bot/internal/metrics"
+	"calendar-bot/internal/models"
+	"calendar-bot/internal/nostr"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+)
+
+// SetCalendar makes the bot publish a NIP-52 calendar (kind 31924) with the given title
+// that lists the calendar events it has published, so calendar clients can show them as
+// one calendar. An empty title publishes no calendar.
+func (b *Bot) SetCalendar(title string) {
+	b.calendar = title
+}
+
+// publishCalendar publishes the calendar if it is enabled and the calendar events in the
+// ledger changed since the last version, or resumes the last version on relays that have
+// not received it. The version is recorded in the ledger under the posting date of day.
+// Failures are only logged: the calendar events themselves were published already.
+func (b *Bot) publishCalendar(ctx context.Context, day time.Time) {
+	if b.calendar == "" || ctx.Err() != nil {
+		return
+	}
+	logger := b.logger.With().Str("eventType", metrics.KindCalendar).Logger()
+
+	addresses, total, err := b.calendarAddresses()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to list published calendar events. Not updating the calendar.")
+		return
+	}
+	if len(addresses) == 0 {
+		logger.Debug().Msg("No calendar events published yet. Not publishing the calendar.")
+		return
+	}
+	if total > len(addresses) {
+		logger.Warn().Int("calendarEvents", total).Int("listed", len(addresses)).Msg("Too many calendar events for one calendar. Listing only the most recently published ones.")
+	}
+
+	latest, err := b.latestCalendar()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to consult publish ledger. Not updating the calendar.")
+		return
+	}
+	relays := b.publisher.RelaysFor(metrics.KindCalendar)
+	if latest != nil && latest.Event.Tags.FindWithValue("title", b.calendar) != nil && slices.Equal(calendarAddressTags(latest.Event), addresses) {
+		missingRelays := latest.MissingRelays(relays)
+		if len(missingRelays) == 0 {
+			logger.Info().Str("nostrEventID", latest.NostrEventID).Msg("Calendar is up to date.")
+			return
+		}
+		logger.Info().Str("nostrEventID", latest.NostrEventID).Strs("missingRelays", missingRelays).Msg("Resuming calendar on relays that have not received it yet.")
+		accepted := b.publisher.PublishSignedEvent(ctx, models.APIEvent{}, latest.Event, metrics.KindCalendar, missingRelays).SuccessfulRelays()
+		b.recordRelays(logger, latest.APIEventID, latest.Date, metrics.KindCalendar, accepted)
+		return
+	}
+
+	ev, err := nostr.CreateCalendarCollectionEvent(b.calendar, addresses)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to create calendar event object.")
+		return
+	}
+	if err := b.publisher.SignEvent(ctx, &ev); err != nil {
+		logger.Error().Err(err).Msg("Failed to sign calendar.")
+		return
+	}
+	date := day.Format("2006-01-02")
+	if _, err := b.ledger.RecordSigned(0, date, metrics.KindCalendar, ev); err != nil {
+		logger.Error().Err(err).Msg("Failed to record signed calendar in publish ledger. Not publishing.")
+		return
+	}
+	accepted := b.publisher.PublishSignedEvent(ctx, models.APIEvent{}, ev, metrics.KindCalendar, relays).SuccessfulRelays()
+	b.recordRelays(logger, 0, date, metrics.KindCalendar, accepted)
+	if len(accepted) == 0 {
+		logger.Warn().Str("nostrEventID", ev.ID).Msg("Calendar failed to publish to any relay.")
+		return
+	}
+	logger.Info().Str("nostrEventID", ev.ID).Int("calendarEvents", len(addresses)).Msg("Calendar published.")
+}
+
+// calendarAddresses returns the sorted addresses of the calendar events in the ledger that
+// reached a relay and were not deleted since: the nostr.MaxCalendarEvents most recently
+// published ones, so the calendar stays within relay size limits. total counts them all.
+func (b *Bot) calendarAddresses() (addresses []string, total int, err error) {
+	entries, err := b.ledger.EntriesOfKind(metrics.KindCalendarEvent)
+	if err != nil {
+		return nil, 0, err
+	}
+	published := make(map[string]time.Time) // Address -> latest publish
+	for _, entry := range entries {
+		if !entry.Published() || entry.DeletedAt != nil {
+			continue
+		}
+		address := nostr.CalendarEventAddress(entry.Event)
+		if latest, ok := published[address]; !ok || entry.CreatedAt.After(latest) {
+			published[address] = entry.CreatedAt
+		}
+	}
+	addresses = make([]string, 0, len(published))
+	for address := range published {
+		addresses = append(addresses, address)
+	}
+	total = len(addresses)
+	if total > nostr.MaxCalendarEvents {
+		slices.SortFunc(addresses, func(a, b string) int {
+			return published[b].Compare(published[a]) // Most recent first
+		})
+		addresses = addresses[:nostr.MaxCalendarEvents]
+	}
+	slices.Sort(addresses)
+	return addresses, total, nil
+}
+
+// latestCalendar returns the most recently signed calendar in the ledger, or nil.
+func (b *Bot) latestCalendar() (*ledger.Entry, error) {
+	entries, err := b.ledger.EntriesOfKind(metrics.KindCalendar)
+	if err != nil {
+		return nil, err
+	}
+	var latest *ledger.Entry
+	for _, entry := range entries {
+		if latest == nil || entry.CreatedAt.After(latest.CreatedAt) {
+			latest = entry
+		}
+	}
+	return latest, nil
+}
+
+// calendarAddressTags returns the addresses a calendar lists, in tag order.
+func calendarAddressTags(ev gonostr.Event) []string {
+	addresses := make([]string, 0, len(ev.Tags))
+	for _, tag := range ev.Tags {
+		if len(tag) >= 2 && tag[0] == "a" {
+			addresses = append(addresses, tag[1])
+		}
+	}
+	return addresses
+}
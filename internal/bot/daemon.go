@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"calendar-bot/internal/scheduler"
+)
+
+// RunScheduledDay publishes the events of day at the scheduler's posting slots.
+// A slot never fires sooner than one interval after the previous fresh post, so a
+// daemon started late in the day does not burst all of the remaining events at once.
+func (b *Bot) RunScheduledDay(ctx context.Context, sched *scheduler.Scheduler, day time.Time) error {
+	b.StartRun()
+	b.logger.Info().Str("date", day.Format("2006-01-02")).Msg("Starting scheduled day. Fetching events from API.")
+
+	apiEvents, err := b.loadDayEvents(day)
+	if err != nil {
+		b.FinishRun("error")
+		return fmt.Errorf("failed to fetch events from API: %w", err)
+	}
+	if len(apiEvents) == 0 {
+		b.logger.Info().Msg("No events found for this day.")
+		b.FinishRun("run")
+		return nil
+	}
+
+	slots := sched.Slots(day, len(apiEvents))
+	var lastPublished time.Time
+	for i, apiEvent := range apiEvents {
+		slot := slots[i]
+		if earliest := lastPublished.Add(sched.Interval()); !lastPublished.IsZero() && earliest.After(slot) {
+			slot = earliest
+		}
+		b.logger.Info().Uint("apiEventID", apiEvent.ID).Time("slot", slot).Msg("Waiting for posting slot.")
+		if err := sched.WaitUntil(ctx, slot); err != nil {
+			b.saveRemaining(day, apiEvents[i:])
+			b.FinishRun("interrupted")
+			return err
+		}
+		published, err := b.ProcessEvent(ctx, day, apiEvent)
+		if err != nil {
+			b.saveRemaining(day, apiEvents[i:])
+			b.FinishRun("interrupted")
+			return err
+		}
+		if published {
+			lastPublished = time.Now()
+		}
+	}
+
+	b.clearQueue()
+	b.publishCalendar(ctx, day)
+	b.logger.Info().Str("date", day.Format("2006-01-02")).Msg("Scheduled day finished.")
+	b.FinishRun("run")
+	return nil
+}
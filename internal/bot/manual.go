@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"calendar-bot/internal/ledger"
+	"calendar-bot/internal/metrics"
+	"calendar-bot/internal/models"
+	"calendar-bot/internal/nostr"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+)
+
+// kindDeletion is the ledger and log name of NIP-09 deletion requests.
+const kindDeletion = "kind5"
+
+// findEvent returns the API event with the given ID among the events of day.
+func (b *Bot) findEvent(day time.Time, apiEventID uint) (models.APIEvent, error) {
+	apiEvents, err := b.FetchDayEvents(day)
+	if err != nil {
+		return models.APIEvent{}, fmt.Errorf("failed to fetch events from API for %s: %w", day.Format("2006-01-02"), err)
+	}
+	for _, apiEvent := range apiEvents {
+		if apiEvent.ID == apiEventID {
+			return apiEvent, nil
+		}
+	}
+	return models.APIEvent{}, fmt.Errorf("API event %d is not among the %d events of %s", apiEventID, len(apiEvents), day.Format("2006-01-02"))
+}
+
+// PostEvent publishes every kind of Nostr event for a single API event of day, without
+// waiting afterwards. The ledger still applies, so kinds that were already published are
+// skipped or resumed rather than posted twice. An error is returned if any kind failed.
+func (b *Bot) PostEvent(ctx context.Context, day time.Time, apiEventID uint) error {
+	apiEvent, err := b.findEvent(day, apiEventID)
+	if err != nil {
+		return err
+	}
+	if _, err := b.ProcessEvent(ctx, day, apiEvent); err != nil {
+		return err
+	}
+	b.publishCalendar(ctx, day)
+
+	failed := 0
+	for _, results := range b.Metrics().Snapshot().Events {
+		failed += results[string(metrics.ResultFailed)]
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d kinds of API event %d failed to publish", failed, apiEventID)
+	}
+	return nil
+}
+
+// DeleteEvent sends a NIP-09 deletion request for the Nostr events the ledger recorded for
+// an API event on day. If kinds is not empty, only those kinds are deleted. The entries stay
+// in the ledger, marked as deleted, so later runs do not publish the event again.
+// Returns the signed deletion request and the entries it covers.
+func (b *Bot) DeleteEvent(ctx context.Context, day time.Time, apiEventID uint, kinds []string, reason string) (gonostr.Event, []*ledger.Entry, error) {
+	date := day.Format("2006-01-02")
+	entries, err := b.ledger.Entries(date)
+	if err != nil {
+		return gonostr.Event{}, nil, err
+	}
+
+	wanted := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		wanted[kind] = true
+	}
+	targets := make([]*ledger.Entry, 0, len(entries))
+	events := make([]gonostr.Event, 0, len(entries))
+	var relays []string // Every relay the target kinds are published to
+	seenRelays := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.APIEventID != apiEventID || !entry.Published() || entry.DeletedAt != nil {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[entry.Kind] {
+			continue
+		}
+		targets = append(targets, entry)
+		events = append(events, entry.Event)
+		for _, relay := range b.publisher.RelaysFor(entry.Kind) {
+			if !seenRelays[relay] {
+				seenRelays[relay] = true
+				relays = append(relays, relay)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return gonostr.Event{}, nil, fmt.Errorf("the ledger has no published, undeleted events for API event %d on %s", apiEventID, date)
+	}
+
+	deletion, err := nostr.CreateDeletionEvent(events, reason)
+	if err != nil {
+		return gonostr.Event{}, nil, err
+	}
+	if err := b.publisher.SignEvent(ctx, &deletion); err != nil {
+		return gonostr.Event{}, nil, fmt.Errorf("failed to sign deletion request: %w", err)
+	}
+
+	apiEvent := models.APIEvent{ID: apiEventID}
+	accepted := b.publisher.PublishSignedEvent(ctx, apiEvent, deletion, kindDeletion, relays).SuccessfulRelays()
+	if len(accepted) == 0 {
+		return deletion, targets, fmt.Errorf("deletion request %s was not accepted by any relay", deletion.ID)
+	}
+
+	logger := b.logger.With().Uint("apiEventID", apiEventID).Str("deletionEventID", deletion.ID).Logger()
+	for _, entry := range targets {
+		if err := b.ledger.RecordDeleted(entry.APIEventID, entry.Date, entry.Kind, deletion.ID); err != nil {
+			logger.Error().Err(err).Str("eventType", entry.Kind).Msg("Failed to record deletion in ledger.")
+		}
+	}
+	logger.Info().Int("deletedEvents", len(targets)).Int("acceptedRelays", len(accepted)).Msg("Deletion request published.")
+	b.publishCalendar(ctx, day) // Drops deleted calendar events from the calendar
+	return deletion, targets, nil
+}
@@ -0,0 +1,247 @@
+package bot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"calendar-bot/internal/card"
+	"calendar-bot/internal/ledger"
+	"calendar-bot/internal/media"
+	"calendar-bot/internal/models"
+
+	"github.com/rs/zerolog"
+)
+
+// SetMediaStore makes the bot store every image it posts on a media server (Blossom or
+// NIP-96) and link the server's copy instead of the original host, so the posts keep
+// working when the original disappears. nil links the original URLs.
+func (b *Bot) SetMediaStore(store media.Store) {
+	b.mediaStore = store
+}
+
+// storeMedia returns the API event with each valid image's URL replaced by the URL of its
+// copy on the media server, and primes the image validator with the copies, so the picture
+// event's imeta tags describe them. Images are copied once: the copies are recorded in the
+// ledger by hash. An image that cannot be copied keeps its original URL, unless images are
+// processed: then it is left out, since the original still carries its metadata.
+func (b *Bot) storeMedia(ctx context.Context, logger zerolog.Logger, apiEvent models.APIEvent) models.APIEvent {
+	if b.mediaStore == nil || len(apiEvent.Media) == 0 {
+		return apiEvent
+	}
+	mediaURLs := make([]string, len(apiEvent.Media))
+	for i, mediaURL := range apiEvent.Media {
+		mediaURLs[i] = cleanURL(mediaURL)
+		if mediaURLs[i] == "" {
+			continue
+		}
+		img, err := b.validator.Inspect(ctx, mediaURLs[i])
+		if err != nil {
+			continue // Not posted at all; the kinds report why
+		}
+		if b.processor != nil && media.Processable(img.MediaType) {
+			blob, err := b.storeProcessed(ctx, logger, img)
+			if err != nil {
+				logger.Warn().Err(err).Str("mediaURL", img.URL).Str("server", b.mediaStore.Server()).Msg("Failed to process and store image. Leaving it out.")
+				if errors.Is(err, media.ErrTooLarge) || errors.Is(err, media.ErrUndecodable) {
+					b.metrics.RecordImageValidationFailure(img.URL, media.Reason(err))
+				}
+				mediaURLs[i] = ""
+				continue
+			}
+			mediaURLs[i] = blob.URL
+			b.validator.Remember(img.Apply(media.Stored{URL: blob.URL, Fields: blob.Fields}))
+			continue
+		}
+		blob, err := b.storeImage(ctx, logger, img, func(ctx context.Context) ([]byte, error) {
+			return b.validator.Download(ctx, img.URL)
+		})
+		if err != nil {
+			logger.Warn().Err(err).Str("mediaURL", img.URL).Str("server", b.mediaStore.Server()).Msg("Failed to store image on media server. Linking the original URL.")
+			continue
+		}
+		mediaURLs[i] = blob.URL
+		b.validator.Remember(img.Apply(media.Stored{URL: blob.URL, Fields: blob.Fields}))
+	}
+	apiEvent.Media = mediaURLs
+	return apiEvent
+}
+
+// storeImage returns the image's copy on the media server, storing it there unless the
+// ledger records an earlier copy. download returns the image's bytes.
+func (b *Bot) storeImage(ctx context.Context, logger zerolog.Logger, img media.Image, download func(ctx context.Context) ([]byte, error)) (*ledger.Blob, error) {
+	server := b.mediaStore.Server()
+	if blob, err := b.ledger.Blob(server, img.SHA256, ""); err != nil || blob != nil {
+		return blob, err
+	}
+
+	stored, err := b.mediaStore.Store(ctx, img, download)
+	if err != nil {
+		return nil, err
+	}
+	blob := &ledger.Blob{
+		Server:   server,
+		SHA256:   img.SHA256,
+		URL:      stored.URL,
+		Fields:   stored.Fields,
+		StoredAt: time.Now().UTC(),
+	}
+	if err := b.ledger.RecordBlob(*blob); err != nil {
+		logger.Warn().Err(err).Str("sha256", blob.SHA256).Msg("Failed to record stored image in ledger. It will be stored again next time.")
+	}
+	logger.Info().Str("mediaURL", img.URL).Str("storedURL", blob.URL).Str("server", server).Msg("Image stored on media server.")
+	return blob, nil
+}
+
+// SetImageProcessor makes the bot process every JPEG, PNG and WebP image before storing
+// it on the media server: scaled down, re-encoded without metadata, and stored with a
+// thumbnail and, for transparent images, a JPEG copy. nil stores the images as they are.
+func (b *Bot) SetImageProcessor(processor *media.Processor) {
+	b.processor = processor
+}
+
+// storeProcessed returns the processed image's copy on the media server, processing and
+// storing it unless the ledger records a copy made with the same options. The copy's
+// fields describe the processed image and link its variants: "image" (the JPEG copy of a
+// PNG) and "thumb", with "ox" naming the original.
+func (b *Bot) storeProcessed(ctx context.Context, logger zerolog.Logger, img media.Image) (*ledger.Blob, error) {
+	server := b.mediaStore.Server()
+	variant := b.processor.Options().Variant()
+	if blob, err := b.ledger.Blob(server, img.SHA256, variant); err != nil || blob != nil {
+		return blob, err
+	}
+
+	data, err := b.validator.Download(ctx, img.URL)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != img.SHA256 {
+		return nil, fmt.Errorf("%s changed since it was inspected", img.URL)
+	}
+	processed, err := b.processor.Process(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process %s: %w", img.URL, err)
+	}
+
+	stored, err := b.storeBytes(ctx, logger, processed.Image)
+	if err != nil {
+		return nil, err
+	}
+	links := []string{"ox " + img.SHA256}
+	for _, v := range []struct {
+		field string
+		data  []byte
+	}{{"image", processed.Preview}, {"thumb", processed.Thumb}} {
+		if v.data == nil {
+			continue
+		}
+		variantCopy, err := b.storeBytes(ctx, logger, v.data)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, v.field+" "+variantCopy.URL)
+	}
+
+	blob := &ledger.Blob{
+		Server:   server,
+		SHA256:   img.SHA256,
+		Variant:  variant,
+		URL:      stored.URL,
+		Fields:   imetaFields(stored, links),
+		StoredAt: time.Now().UTC(),
+	}
+	if err := b.ledger.RecordBlob(*blob); err != nil {
+		logger.Warn().Err(err).Str("sha256", blob.SHA256).Msg("Failed to record processed image in ledger. It will be processed again next time.")
+	}
+	logger.Info().Str("mediaURL", img.URL).Str("storedURL", blob.URL).Int64("originalSize", img.Size).Int64("size", stored.Size).Str("dim", stored.Dim()).Msg("Image processed and stored on media server.")
+	return blob, nil
+}
+
+// storeBytes inspects an image the bot made itself and returns the description of its
+// copy on the media server.
+func (b *Bot) storeBytes(ctx context.Context, logger zerolog.Logger, data []byte) (media.Image, error) {
+	img, err := media.InspectImage("", data)
+	if err != nil {
+		return media.Image{}, err
+	}
+	blob, err := b.storeImage(ctx, logger, img, func(context.Context) ([]byte, error) {
+		return data, nil
+	})
+	if err != nil {
+		return media.Image{}, err
+	}
+	return img.Apply(media.Stored{URL: blob.URL, Fields: blob.Fields}), nil
+}
+
+// imetaFields returns the imeta fields describing img, followed by links, which replace
+// fields of the same keys the media server reported.
+func imetaFields(img media.Image, links []string) []string {
+	fields := []string{"m " + img.MediaType, "x " + img.SHA256, "size " + strconv.FormatInt(img.Size, 10)}
+	if dim := img.Dim(); dim != "" {
+		fields = append(fields, "dim "+dim)
+	}
+	if img.Blurhash != "" {
+		fields = append(fields, "blurhash "+img.Blurhash)
+	}
+	for _, field := range img.Extra {
+		key, _, _ := strings.Cut(field, " ")
+		if !slices.ContainsFunc(links, func(link string) bool { return strings.HasPrefix(link, key+" ") }) {
+			fields = append(fields, field)
+		}
+	}
+	return append(fields, links...)
+}
+
+// SetCards makes the bot post a quote card drawn by renderer as the picture of events
+// without a valid image. Cards are linked from the media server, so they are only posted
+// if a media store is set. nil posts no cards.
+func (b *Bot) SetCards(renderer *card.Renderer) {
+	b.cards = renderer
+}
+
+// addCard returns the API event with a quote card added to its media if none of its media
+// URLs is a valid image, so it qualifies for a picture event. The card is stored on the
+// media server like any other image; a card that cannot be drawn or stored is left out.
+func (b *Bot) addCard(ctx context.Context, logger zerolog.Logger, day time.Time, apiEvent models.APIEvent) models.APIEvent {
+	if b.cards == nil || b.mediaStore == nil {
+		return apiEvent
+	}
+	for _, mediaURL := range apiEvent.Media {
+		if mediaURL = cleanURL(mediaURL); mediaURL != "" && b.validator.IsValidImageURL(ctx, mediaURL) {
+			return apiEvent
+		}
+	}
+
+	data, err := b.cards.Render(card.Data{
+		Title:       apiEvent.Title,
+		Description: apiEvent.Description,
+		Date:        apiEvent.Date,
+		YearsAgo:    day.Year() - apiEvent.Date.Year(),
+	})
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to render quote card. Posting the event without a picture.")
+		return apiEvent
+	}
+	img, err := media.InspectImage("", data)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to inspect quote card. Posting the event without a picture.")
+		return apiEvent
+	}
+	blob, err := b.storeImage(ctx, logger, img, func(context.Context) ([]byte, error) {
+		return data, nil
+	})
+	if err != nil {
+		logger.Warn().Err(err).Str("server", b.mediaStore.Server()).Msg("Failed to store quote card on media server. Posting the event without a picture.")
+		return apiEvent
+	}
+	b.validator.Remember(img.Apply(media.Stored{URL: blob.URL, Fields: blob.Fields}))
+	logger.Info().Str("cardURL", blob.URL).Msg("Quote card added as the event's picture.")
+	apiEvent.Media = append(append([]string(nil), apiEvent.Media...), blob.URL)
+	return apiEvent
+}
@@ -0,0 +1,124 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+)
+
+// Preview output formats.
+const (
+	PreviewFormatText = "text"
+	PreviewFormatJSON = "json"
+)
+
+// PreviewEvent is the Nostr event the bot would publish for one kind, unsigned.
+type PreviewEvent struct {
+	Kind      string         `json:"kind"`      // Ledger and metrics kind name, e.g. "kind1"
+	Qualified bool           `json:"qualified"` // False if the API event does not qualify for this kind
+	Error     string         `json:"error,omitempty"`
+	Event     *gonostr.Event `json:"event,omitempty"`
+}
+
+// Preview lists what the bot would publish for one API event.
+type Preview struct {
+	Profile    string         `json:"profile,omitempty"` // Config file profile, set by the caller when several are previewed
+	Language   string         `json:"language"`
+	APIEventID uint           `json:"apiEventID"`
+	Title      string         `json:"title"`
+	Date       string         `json:"date"`
+	Events     []PreviewEvent `json:"events"`
+}
+
+// PreviewDay builds every kind of Nostr event for the events of day exactly as a run
+// would, without signing them, touching the ledger or contacting relays. If pubkey is
+// set, it is filled in and the event IDs are computed, so they match what a run on the
+// same second would publish, and the notes link to the article published to articleRelays.
+// ctx cancels the media downloads.
+func (b *Bot) PreviewDay(ctx context.Context, day time.Time, pubkey string, articleRelays []string) ([]Preview, error) {
+	apiEvents, err := b.FetchDayEvents(day)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch events from API: %w", err)
+	}
+
+	previews := make([]Preview, 0, len(apiEvents))
+	for _, apiEvent := range apiEvents {
+		logger := b.logger.With().Uint("apiEventID", apiEvent.ID).Logger()
+		preview := Preview{Language: b.language, APIEventID: apiEvent.ID, Title: apiEvent.Title, Date: apiEvent.Date.Format("2006-01-02")}
+		article := b.articleLink(logger, pubkey, apiEvent.ID, articleRelays)
+		for _, builder := range b.builders(logger, day, apiEvent, article) {
+			ev, qualified, err := builder.build(ctx)
+			previewEvent := PreviewEvent{Kind: builder.kind, Qualified: qualified && err == nil}
+			if err != nil {
+				previewEvent.Error = err.Error()
+			}
+			if previewEvent.Qualified {
+				if pubkey != "" {
+					ev.PubKey = pubkey
+					ev.ID = ev.GetID()
+				}
+				previewEvent.Event = &ev
+			}
+			preview.Events = append(preview.Events, previewEvent)
+		}
+		previews = append(previews, preview)
+	}
+	return previews, nil
+}
+
+// WritePreviews renders previews as JSON or as human-readable text.
+func WritePreviews(w io.Writer, previews []Preview, format string) error {
+	switch format {
+	case PreviewFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(previews)
+	case PreviewFormatText:
+		if len(previews) == 0 {
+			_, err := fmt.Fprintln(w, "No events for this date.")
+			return err
+		}
+		for _, preview := range previews {
+			profile := ""
+			if preview.Profile != "" {
+				profile = preview.Profile + ": "
+			}
+			fmt.Fprintf(w, "=== %sAPI event %d: %s (%s) ===\n", profile, preview.APIEventID, preview.Title, preview.Date)
+			for _, pe := range preview.Events {
+				switch {
+				case pe.Error != "":
+					fmt.Fprintf(w, "\n--- %s: failed to build: %s ---\n", pe.Kind, pe.Error)
+				case !pe.Qualified:
+					fmt.Fprintf(w, "\n--- %s: does not qualify, would be skipped ---\n", pe.Kind)
+				default:
+					fmt.Fprintf(w, "\n--- %s (Nostr kind %d) ---\n", pe.Kind, pe.Event.Kind)
+					if pe.Event.ID != "" {
+						fmt.Fprintf(w, "ID: %s\n", pe.Event.ID)
+					}
+					fmt.Fprintf(w, "Content:\n%s\n", indent(pe.Event.Content))
+					fmt.Fprintln(w, "Tags:")
+					for _, tag := range pe.Event.Tags {
+						encoded, _ := json.Marshal(tag)
+						fmt.Fprintf(w, "  %s\n", encoded)
+					}
+				}
+			}
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown preview format %q (want %s or %s)", format, PreviewFormatText, PreviewFormatJSON)
+	}
+}
+
+func indent(s string) string {
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ")
+}
@@ -0,0 +1,72 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"calendar-bot/internal/models"
+	"calendar-bot/internal/nostr"
+)
+
+// Templates are the content templates of a profile, keyed by kind (e.g. "kind1").
+// A kind without a template keeps the content its builder produces.
+type Templates map[string]*template.Template
+
+// TemplateData is what a content template is executed with.
+type TemplateData struct {
+	Title       string
+	Description string
+	Date        time.Time // Date of the historical event
+	Media       []string  // Cleaned media URLs
+	References  []string  // Cleaned reference URLs
+	Tags        []string  // Hashtags from the API, without '#'
+	Article     string    // "nostr:naddr1..." link to the event's NIP-23 article, empty if the pubkey is unknown
+	Content     string    // Content the kind's builder produced, for templates that only wrap it
+}
+
+// ParseTemplates parses the template source of each kind.
+func ParseTemplates(sources map[string]string) (Templates, error) {
+	templates := make(Templates, len(sources))
+	for kind, source := range sources {
+		tmpl, err := template.New(kind).Option("missingkey=error").Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s template: %w", kind, err)
+		}
+		templates[kind] = tmpl
+	}
+	return templates, nil
+}
+
+// SetTemplates makes the bot render the content of the given kinds from templates.
+func (b *Bot) SetTemplates(templates Templates) {
+	b.templates = templates
+}
+
+// render returns the content of an event of the given kind, rendered from the kind's
+// template, or content unchanged if the kind has none.
+func (t Templates) render(kind string, apiEvent models.APIEvent, tags, references []string, article nostr.ArticleLink, content string) (string, error) {
+	tmpl, ok := t[kind]
+	if !ok {
+		return content, nil
+	}
+	data := TemplateData{
+		Title:       apiEvent.Title,
+		Description: apiEvent.Description,
+		Date:        apiEvent.Date,
+		Media:       apiEvent.Media,
+		References:  references,
+		Tags:        tags,
+		Content:     content,
+	}
+	if article.NAddr != "" {
+		data.Article = "nostr:" + article.NAddr
+	}
+	var b strings.Builder
+	err := tmpl.Execute(&b, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", kind, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,354 @@
+package card
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // Registers the logo decoders image.Decode uses
+	_ "image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	_ "golang.org/x/image/webp"
+)
+
+// DefaultTemplate is the text of a card unless the style sets another: the title, the
+// date of the event and how long ago it was.
+const DefaultTemplate = `{{.Title}}
+{{.Date.Format "January 2, 2006"}}
+{{if gt .YearsAgo 0}}{{.YearsAgo}} {{if eq .YearsAgo 1}}year{{else}}years{{end}} ago{{end}}`
+
+// maxTitleLines is how many lines the title may wrap to before it is cut short.
+const maxTitleLines = 6
+
+// Data is what a card's template is executed with.
+type Data struct {
+	Title       string
+	Description string
+	Date        time.Time // Date of the historical event
+	YearsAgo    int       // Years between the event and the day it is posted on
+}
+
+// Style is how cards look. The template's first line is the title, drawn large in the
+// bold font; every further non-empty line is drawn below it in the accent color.
+type Style struct {
+	Width      int
+	Height     int
+	Font       string // TrueType or OpenType file of the text, empty for Go Regular
+	BoldFont   string // TrueType or OpenType file of the title, empty for Go Bold
+	Logo       string // PNG, JPEG, GIF or WebP file drawn in the top corner, empty for a "B" mark
+	Background string // Colors as "#rrggbb"
+	Foreground string // Color of the title
+	Accent     string // Color of the other lines, the top bar and the mark
+	Template   string // text/template of the card's lines, executed with Data
+}
+
+// DefaultStyle returns the style used for the settings a configuration leaves out: a
+// square card in the bot's colors with the built-in Go fonts.
+func DefaultStyle() Style {
+	return Style{
+		Width:      1080,
+		Height:     1080,
+		Background: "#111111",
+		Foreground: "#ffffff",
+		Accent:     "#f7931a",
+		Template:   DefaultTemplate,
+	}
+}
+
+// Validate checks the settings that need no files: size, colors and template.
+func (s Style) Validate() error {
+	var errs []error
+	if s.Width < 200 || s.Height < 200 || s.Width > 4096 || s.Height > 4096 {
+		errs = append(errs, fmt.Errorf("size %dx%d is out of range. Width and height must be 200 to 4096 pixels", s.Width, s.Height))
+	}
+	for _, c := range [][2]string{{"background", s.Background}, {"foreground", s.Foreground}, {"accent", s.Accent}} {
+		if _, err := parseColor(c[1]); err != nil {
+			errs = append(errs, fmt.Errorf("%s color: %w", c[0], err))
+		}
+	}
+	if _, err := template.New("card").Parse(s.Template); err != nil {
+		errs = append(errs, fmt.Errorf("template: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// Renderer draws quote cards in one style.
+type Renderer struct {
+	style    Style
+	template *template.Template
+	regular  *opentype.Font
+	bold     *opentype.Font
+	logo     image.Image // nil to draw the built-in mark
+
+	background, foreground, accent color.RGBA
+}
+
+// NewRenderer checks the style and loads its fonts and logo.
+func NewRenderer(style Style) (*Renderer, error) {
+	if err := style.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid card style: %w", err)
+	}
+	r := &Renderer{style: style}
+	r.template = template.Must(template.New("card").Option("missingkey=error").Parse(style.Template))
+	r.background, _ = parseColor(style.Background)
+	r.foreground, _ = parseColor(style.Foreground)
+	r.accent, _ = parseColor(style.Accent)
+
+	var err error
+	if r.regular, err = loadFont(style.Font, goregular.TTF); err != nil {
+		return nil, err
+	}
+	if r.bold, err = loadFont(style.BoldFont, gobold.TTF); err != nil {
+		return nil, err
+	}
+	if style.Logo != "" {
+		data, err := os.ReadFile(style.Logo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read card logo: %w", err)
+		}
+		if r.logo, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("failed to decode card logo %s: %w", style.Logo, err)
+		}
+	}
+	return r, nil
+}
+
+// Render draws the card of data and returns it encoded as PNG. The same
+// data always gives the same bytes, so a card is stored on the media server only once.
+func (r *Renderer) Render(data Data) ([]byte, error) {
+	var text strings.Builder
+	if err := r.template.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("failed to render card template: %w", err)
+	}
+	var lines []string
+	for _, line := range strings.Split(text.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("card template rendered no text")
+	}
+
+	width, height := r.style.Width, r.style.Height
+	unit := min(width, height)
+	pad := unit / 12
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(r.background), image.Point{}, draw.Src)
+	bar := unit / 90
+	draw.Draw(canvas, image.Rect(0, 0, width, bar), image.NewUniform(r.accent), image.Point{}, draw.Src)
+
+	logoBox := image.Rect(pad, pad+bar, pad+unit/9, pad+bar+unit/9)
+	if err := r.drawLogo(canvas, logoBox); err != nil {
+		return nil, err
+	}
+
+	// The title and the other lines are centered as one block below the logo
+	area := image.Rect(pad, logoBox.Max.Y+pad/2, width-pad, height-pad)
+	lineFace, err := newFace(r.regular, float64(unit)/28)
+	if err != nil {
+		return nil, err
+	}
+	defer lineFace.Close()
+	var subLines []string
+	for _, line := range lines[1:] {
+		subLines = append(subLines, wrap(lineFace, line, area.Dx())...)
+	}
+	subHeight := len(subLines) * lineHeight(lineFace)
+	gap := unit / 30
+	if len(subLines) == 0 {
+		gap = 0
+	}
+
+	var titleFace font.Face
+	var titleLines []string
+	for size := float64(unit) / 12; ; size -= 2 {
+		if titleFace != nil {
+			titleFace.Close()
+		}
+		if titleFace, err = newFace(r.bold, size); err != nil {
+			return nil, err
+		}
+		titleLines = wrap(titleFace, lines[0], area.Dx())
+		fits := len(titleLines) <= maxTitleLines && len(titleLines)*lineHeight(titleFace)+gap+subHeight <= area.Dy()
+		if fits || size <= float64(unit)/24 {
+			break
+		}
+	}
+	defer titleFace.Close()
+	if len(titleLines) > maxTitleLines {
+		titleLines = titleLines[:maxTitleLines]
+		titleLines[maxTitleLines-1] = ellipsize(titleFace, titleLines[maxTitleLines-1], area.Dx())
+	}
+
+	y := area.Min.Y + (area.Dy()-len(titleLines)*lineHeight(titleFace)-gap-subHeight)/2
+	y = max(y, area.Min.Y)
+	y = drawLines(canvas, titleFace, r.foreground, titleLines, area.Min.X, y)
+	drawLines(canvas, lineFace, r.accent, subLines, area.Min.X, y+gap)
+
+	var out bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&out, canvas); err != nil {
+		return nil, fmt.Errorf("failed to encode card: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// drawLogo draws the logo scaled into box, keeping its aspect ratio, or the built-in mark:
+// a "B" in a circle of the accent color.
+func (r *Renderer) drawLogo(canvas *image.RGBA, box image.Rectangle) error {
+	if r.logo != nil {
+		bounds := r.logo.Bounds()
+		scale := min(float64(box.Dx())/float64(bounds.Dx()), float64(box.Dy())/float64(bounds.Dy()))
+		target := image.Rect(0, 0, max(1, int(float64(bounds.Dx())*scale)), max(1, int(float64(bounds.Dy())*scale))).Add(box.Min)
+		xdraw.CatmullRom.Scale(canvas, target, r.logo, bounds, draw.Over, nil)
+		return nil
+	}
+
+	radius := float64(box.Dx()) / 2
+	cx, cy := float64(box.Min.X)+radius, float64(box.Min.Y)+radius
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			// Coverage of the pixel by the circle's edge, for a smooth outline
+			coverage := min(1, max(0, radius-math.Sqrt(dx*dx+dy*dy)+0.5))
+			if coverage > 0 {
+				canvas.SetRGBA(x, y, blend(canvas.RGBAAt(x, y), r.accent, coverage))
+			}
+		}
+	}
+	face, err := newFace(r.bold, radius*1.2)
+	if err != nil {
+		return err
+	}
+	defer face.Close()
+	metrics := face.Metrics()
+	textWidth := font.MeasureString(face, "B")
+	d := font.Drawer{
+		Dst:  canvas,
+		Src:  image.NewUniform(r.background),
+		Face: face,
+		Dot: fixed.Point26_6{
+			X: fixed.I(int(cx)) - textWidth/2,
+			Y: fixed.I(int(cy)) + (metrics.CapHeight)/2,
+		},
+	}
+	d.DrawString("B")
+	return nil
+}
+
+// drawLines draws the lines top-down from y and returns the y below the last one.
+func drawLines(canvas *image.RGBA, face font.Face, c color.RGBA, lines []string, x, y int) int {
+	d := font.Drawer{Dst: canvas, Src: image.NewUniform(c), Face: face}
+	ascent := face.Metrics().Ascent
+	for _, line := range lines {
+		d.Dot = fixed.Point26_6{X: fixed.I(x), Y: fixed.I(y) + ascent}
+		d.DrawString(line)
+		y += lineHeight(face)
+	}
+	return y
+}
+
+// wrap breaks text into lines no wider than width, between words where it can.
+func wrap(face font.Face, text string, width int) []string {
+	limit := fixed.I(width)
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if font.MeasureString(face, candidate) <= limit {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		// A word wider than a line is broken where it overflows
+		for font.MeasureString(face, word) > limit {
+			runes := []rune(word)
+			n := len(runes) - 1
+			for n > 1 && font.MeasureString(face, string(runes[:n])) > limit {
+				n--
+			}
+			lines = append(lines, string(runes[:n]))
+			word = string(runes[n:])
+		}
+		line = word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// ellipsize shortens the line until it fits width with "…" appended.
+func ellipsize(face font.Face, line string, width int) string {
+	runes := []rune(line)
+	for len(runes) > 0 && font.MeasureString(face, string(runes)+"…") > fixed.I(width) {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimSpace(string(runes)) + "…"
+}
+
+func lineHeight(face font.Face) int {
+	return face.Metrics().Height.Ceil() * 6 / 5
+}
+
+func newFace(f *opentype.Font, size float64) (font.Face, error) {
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create card font face: %w", err)
+	}
+	return face, nil
+}
+
+// loadFont parses the font file at path, or fallback if path is empty.
+func loadFont(path string, fallback []byte) (*opentype.Font, error) {
+	data := fallback
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read card font: %w", err)
+		}
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse card font %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// parseColor parses a "#rrggbb" color.
+func parseColor(s string) (color.RGBA, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("invalid color '%s'. Must be #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color '%s'. Must be #rrggbb", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// blend mixes c over dst by the fraction alpha.
+func blend(dst, c color.RGBA, alpha float64) color.RGBA {
+	mix := func(a, b uint8) uint8 { return uint8(float64(a)*(1-alpha) + float64(b)*alpha + 0.5) }
+	return color.RGBA{R: mix(dst.R, c.R), G: mix(dst.G, c.G), B: mix(dst.B, c.B), A: 0xff}
+}
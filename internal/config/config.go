@@ -1,101 +1,505 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"calendar-bot/internal/card"
+	"calendar-bot/internal/keys"
+	"calendar-bot/internal/media"
+	"calendar-bot/internal/nostr"
+	"calendar-bot/internal/signer"
 
 	"github.com/joho/godotenv"
 )
 
 // Config holds all configuration for the application.
 type Config struct {
-	APIEndpoint         string
-	APIKey              string
-	PrivateKey          string
-	ProcessingLanguage  string
-	LogDir              string
-	LogLevel            string
-	ConsoleLog          bool
-	Debug               bool
-	NostrRelays         []string
-	EnvVarForPrivateKey string // To store the name of the env var holding the private key
+	APIEndpoint          string
+	APIKey               string
+	PrivateKey           keys.Key // Prints as "<redacted>"; log PrivateKey.Npub() instead
+	ProcessingLanguage   string
+	LogDir               string
+	LogLevel             string
+	ConsoleLog           bool
+	Debug                bool
+	NostrRelays          []string
+	EnvVarForPrivateKey  string               // To store the name of the env var holding the private key
+	KeyFile              string               // File holding the private key, read if the env var is empty (e.g. a Docker secret)
+	KeyPasswordEnv       string               // Env var holding the password of an ncryptsec private key
+	KeyPasswordFile      string               // File holding the password of an ncryptsec private key
+	LedgerPath           string               // Path of the embedded publish ledger database
+	ScheduleStart        string               // Daemon mode: local time of the first daily posting slot, "HH:MM"
+	ScheduleInterval     time.Duration        // Daemon mode: spacing between posting slots
+	MetricsAddr          string               // Daemon mode: listen address of the Prometheus /metrics endpoint, empty to disable
+	PushgatewayURL       string               // One-shot mode: Pushgateway to push run metrics to, empty to disable
+	PushgatewayJob       string               // Job name used when pushing to the Pushgateway
+	MetricsRetentionDays int                  // Exported metrics files older than this are deleted after each run, 0 keeps everything
+	BackfillPace         time.Duration        // Backfill mode: wait after each published event, 0 for none
+	BunkerURL            string               // NIP-46 bunker:// URI of a remote signer; when set, the private key only authenticates the bot to it
+	BunkerEnv            string               // Env var the selected profile reads BunkerURL from
+	SignerTimeout        time.Duration        // Remote signer: how long to wait for each answer
+	CalendarTitle        string               // Title of the NIP-52 calendar listing the published calendar events, empty to publish none
+	ImageMaxBytes        int64                // Largest image downloaded to inspect it, in bytes; larger images are not posted
+	ImageMaxPerEvent     int                  // Most images of an API event's media posted in one picture event
+	VideoMaxBytes        int64                // Largest video downloaded to inspect it, in bytes; larger videos are not posted
+	BlossomServer        string               // Blossom server the posted images are stored on, empty to link the original URLs
+	NIP96Server          string               // NIP-96 server the posted images are stored on, instead of a Blossom server
+	ProcessImages        bool                 // Scale down and re-encode images without metadata before storing them, with variants and a thumbnail
+	ImageProcessing      media.ProcessOptions // Limits and format of processed images
+	Cards                bool                 // Post a quote card as the picture of events without images
+	Card                 card.Style           // How quote cards look; a profile's "card" template replaces Card.Template
+
+	ConfigFile string              // Path of the YAML or TOML config file, empty if settings come only from the environment
+	Profile    string              // Name of the selected config file profile, empty if none is selected
+	KindRelays map[string][]string // Relays for one event kind, e.g. "kind20", replacing NostrRelays for it
+	Templates  map[string]string   // Content template per event kind, empty to use the built-in content
+	Profiles   []Profile           // Every profile declared in the config file, sorted by name
+
+	defaultRelays []string    // Top-level relays before a profile was merged in
+	keySource     keys.Source // Where PrivateKey was loaded from
+	keyErr        error       // Why loading PrivateKey failed, reported by Validate
 }
 
 // Validate checks the configuration for any errors.
 func (c *Config) Validate() error {
+	if len(c.Profiles) > 1 && c.Profile == "" {
+		return fmt.Errorf("the config file declares several profiles (%s); select one with --profile or BOT_PROFILE", strings.Join(c.ProfileNames(), ", "))
+	}
+	if c.keyErr != nil {
+		return fmt.Errorf("invalid PrivateKey: %w", c.keyErr)
+	}
+	if c.BunkerURL != "" {
+		if _, err := signer.ParseBunkerURL(c.BunkerURL); err != nil {
+			return fmt.Errorf("invalid BunkerURL: %w", err)
+		}
+	} else if c.BunkerEnv != "" {
+		return fmt.Errorf("BunkerURL is required: %s is not set", c.BunkerEnv)
+	}
+	if c.BunkerURL == "" && c.PrivateKey.IsZero() && !c.keySource.IsZero() {
+		return fmt.Errorf("PrivateKey is required: %s is not set", c.keySource.Describe())
+	}
+	if c.BunkerURL == "" && c.PrivateKey.IsZero() {
+		return fmt.Errorf("PrivateKey is required: name the env var holding it (ENV_VAR or --key-env), a --key-file or a BOT_BUNKER_URL, or select a profile with key_env, key_file or bunker_env")
+	}
+	if len(c.NostrRelays) == 0 {
+		return fmt.Errorf("NostrRelays are required")
+	}
+	return c.ValidateSettings()
+}
+
+// ValidateSettings checks everything except what only publishing needs (private key, relays).
+func (c *Config) ValidateSettings() error {
 	if c.APIEndpoint == "" {
 		return fmt.Errorf("APIEndpoint is required")
 	}
 	if c.APIKey == "" {
 		return fmt.Errorf("APIKey is required")
 	}
-	if c.PrivateKey == "" {
-		return fmt.Errorf("PrivateKey is required")
-	}
 	if c.ProcessingLanguage == "" {
 		return fmt.Errorf("ProcessingLanguage is required")
 	}
-	if c.ProcessingLanguage != "en" {
-		return fmt.Errorf("Invalid BOT_PROCESSING_LANGUAGE '%s'. Must be 'en'", c.ProcessingLanguage)
+	if !isLanguageCode(c.ProcessingLanguage) {
+		return fmt.Errorf("Invalid BOT_PROCESSING_LANGUAGE '%s'. Must be a lowercase language code, e.g. 'en' or 'ru'", c.ProcessingLanguage)
 	}
-	if len(c.NostrRelays) == 0 {
-		return fmt.Errorf("NostrRelays are required")
+	if c.LedgerPath == "" {
+		return fmt.Errorf("LedgerPath is required")
 	}
-	return nil
+	if _, err := time.Parse("15:04", c.ScheduleStart); err != nil {
+		return fmt.Errorf("Invalid BOT_SCHEDULE_START '%s'. Must be HH:MM", c.ScheduleStart)
+	}
+	if c.ScheduleInterval <= 0 {
+		return fmt.Errorf("ScheduleInterval must be positive")
+	}
+	if c.PushgatewayURL != "" && !strings.HasPrefix(c.PushgatewayURL, "http://") && !strings.HasPrefix(c.PushgatewayURL, "https://") {
+		return fmt.Errorf("Invalid BOT_PUSHGATEWAY_URL '%s'. Must start with http:// or https://", c.PushgatewayURL)
+	}
+	if c.PushgatewayURL != "" && c.PushgatewayJob == "" {
+		return fmt.Errorf("PushgatewayJob is required when BOT_PUSHGATEWAY_URL is set")
+	}
+	if c.BackfillPace < 0 {
+		return fmt.Errorf("BackfillPace must not be negative")
+	}
+	if c.MetricsRetentionDays < 0 {
+		return fmt.Errorf("MetricsRetentionDays must not be negative")
+	}
+	if c.SignerTimeout <= 0 {
+		return fmt.Errorf("SignerTimeout must be positive")
+	}
+	if c.ImageMaxBytes <= 0 {
+		return fmt.Errorf("ImageMaxBytes must be positive")
+	}
+	if c.VideoMaxBytes <= 0 {
+		return fmt.Errorf("VideoMaxBytes must be positive")
+	}
+	if c.ImageMaxPerEvent <= 0 {
+		return fmt.Errorf("ImageMaxPerEvent must be positive")
+	}
+	if c.BlossomServer != "" && !isHTTPURL(c.BlossomServer) {
+		return fmt.Errorf("Invalid BOT_BLOSSOM_SERVER '%s'. Must start with http:// or https://", c.BlossomServer)
+	}
+	if c.NIP96Server != "" && !isHTTPURL(c.NIP96Server) {
+		return fmt.Errorf("Invalid BOT_NIP96_SERVER '%s'. Must start with http:// or https://", c.NIP96Server)
+	}
+	if c.BlossomServer != "" && c.NIP96Server != "" {
+		return fmt.Errorf("BOT_BLOSSOM_SERVER and BOT_NIP96_SERVER cannot both be set. Choose one media server")
+	}
+	if c.ProcessImages && c.BlossomServer == "" && c.NIP96Server == "" {
+		return fmt.Errorf("BOT_IMAGE_PROCESS needs a media server to store the processed images on. Set BOT_BLOSSOM_SERVER or BOT_NIP96_SERVER")
+	}
+	if c.ProcessImages {
+		if err := c.ImageProcessing.Validate(); err != nil {
+			return fmt.Errorf("invalid image processing settings: %w", err)
+		}
+	}
+	if c.Cards && c.BlossomServer == "" && c.NIP96Server == "" {
+		return fmt.Errorf("BOT_CARDS needs a media server to store the cards on. Set BOT_BLOSSOM_SERVER or BOT_NIP96_SERVER")
+	}
+	if c.Cards {
+		if err := c.Card.Validate(); err != nil {
+			return fmt.Errorf("invalid cards settings: %w", err)
+		}
+	}
+	return c.validateProfiles()
 }
 
+// Override changes one setting after the environment has been read, e.g. from a
+// command-line flag. An error means the new value is invalid.
+type Override func(cfg *Config) error
+
 // LoadConfig loads configuration from environment variables and command-line arguments.
-func LoadConfig(envVarForPrivateKeyName string) (*Config, error) {
-	cfg := &Config{
-		EnvVarForPrivateKey: envVarForPrivateKeyName,
+// The overrides are applied in order before the configuration is validated.
+func LoadConfig(envVarForPrivateKeyName string, overrides ...Override) (*Config, error) {
+	cfg, err := Read(envVarForPrivateKeyName, overrides...)
+	if err != nil {
+		return nil, err
 	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadPreviewConfig loads the configuration for commands that never sign anything.
+// The private key is read from envVarForPrivateKeyName if given, but is not required.
+func LoadPreviewConfig(envVarForPrivateKeyName string, overrides ...Override) (*Config, error) {
+	cfg, err := Read(envVarForPrivateKeyName, overrides...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.ValidateSettings(); err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	}
+	return cfg, nil
+}
 
+// Read loads the configuration and applies the overrides, without validating the result.
+// Settings are layered: defaults, then the config file (BOT_CONFIG_FILE), then environment
+// variables, then the selected profile (BOT_PROFILE), then the overrides.
+// It is meant for showing the effective configuration.
+func Read(envVarForPrivateKeyName string, overrides ...Override) (*Config, error) {
+	cfg, profile, err := readBase(envVarForPrivateKeyName, overrides)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.finish(profile, overrides); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readBase reads every layer below the profile: defaults, the config file and environment
+// variables. It also returns the name of the profile to select, which may be empty.
+func readBase(envVarForPrivateKeyName string, overrides []Override) (*Config, string, error) {
 	// Attempt to load .env file, but don't make it fatal if it doesn't exist.
 	_ = godotenv.Load()
 
-	cfg.APIEndpoint = os.Getenv("BOT_API_ENDPOINT")
-	cfg.APIKey = os.Getenv("BOT_API_KEY")
-	cfg.PrivateKey = os.Getenv(cfg.EnvVarForPrivateKey)
-	cfg.ProcessingLanguage = os.Getenv("BOT_PROCESSING_LANGUAGE")
+	// Overrides may choose the config file and profile, so resolve those before anything else.
+	source := &Config{ConfigFile: os.Getenv("BOT_CONFIG_FILE"), Profile: os.Getenv("BOT_PROFILE")}
+	for _, override := range overrides {
+		if err := override(source); err != nil {
+			return nil, "", err
+		}
+	}
 
-	cfg.LogDir = os.Getenv("BOT_LOG_DIR")
-	if cfg.LogDir == "" {
-		cfg.LogDir = "logs" // Default log directory
+	cfg := defaults()
+	cfg.EnvVarForPrivateKey = envVarForPrivateKeyName
+	cfg.ConfigFile = source.ConfigFile
+	cfg.KeyFile = source.KeyFile // A key file given on the command line wins over the profile's key
+	if cfg.ConfigFile != "" {
+		file, err := readFile(cfg.ConfigFile)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := file.apply(cfg); err != nil {
+			return nil, "", fmt.Errorf("config file %s: %w", cfg.ConfigFile, err)
+		}
 	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, "", err
+	}
+	cfg.defaultRelays = cfg.NostrRelays
+	return cfg, source.Profile, nil
+}
 
-	cfg.LogLevel = os.Getenv("BOT_LOG_LEVEL")
-	if cfg.LogLevel == "" {
-		cfg.LogLevel = "info" // Default log level
+// finish merges the named profile into the configuration, applies the overrides and
+// loads the private key. A key that fails to load is reported by Validate, so the
+// configuration can still be shown.
+func (c *Config) finish(profile string, overrides []Override) error {
+	if err := c.selectProfile(profile); err != nil {
+		return err
+	}
+	for _, override := range overrides {
+		if err := override(c); err != nil {
+			return err
+		}
 	}
 
-	consoleLog := os.Getenv("BOT_CONSOLE_LOG")
-	if consoleLog == "true" {
-		cfg.ConsoleLog = true
+	c.keySource = keys.Source{
+		Env:          c.EnvVarForPrivateKey,
+		File:         c.KeyFile,
+		PasswordEnv:  c.KeyPasswordEnv,
+		PasswordFile: c.KeyPasswordFile,
+	}.WithDefaults()
+	if !c.keySource.IsZero() {
+		key, err := keys.Load(c.keySource)
+		if err != nil && !errors.Is(err, keys.ErrNotSet) {
+			c.keyErr = err
+		}
+		c.PrivateKey = key
 	}
+	return nil
+}
 
-	debugEnv := os.Getenv("BOT_DEBUG")
-	if debugEnv == "true" {
-		cfg.Debug = true
+// KeyError returns why the private key could not be loaded, or nil. Validate reports it too.
+func (c *Config) KeyError() error {
+	return c.keyErr
+}
+
+// LoadProfiles loads the configurations of every bot identity the process should run.
+// With a profile selected, or fewer than two declared, that is the single configuration
+// LoadConfig returns. With several profiles declared and none selected, it is one
+// configuration per profile, each validated as if that profile had been selected, so
+// one process can post every language with its own key, relays and schedule.
+func LoadProfiles(envVarForPrivateKeyName string, overrides ...Override) ([]*Config, error) {
+	return loadProfiles(envVarForPrivateKeyName, (*Config).Validate, overrides)
+}
+
+// LoadPreviewProfiles is LoadProfiles for commands that never sign anything: the private
+// keys are read if available but not required.
+func LoadPreviewProfiles(envVarForPrivateKeyName string, overrides ...Override) ([]*Config, error) {
+	return loadProfiles(envVarForPrivateKeyName, (*Config).ValidateSettings, overrides)
+}
+
+func loadProfiles(envVarForPrivateKeyName string, validate func(*Config) error, overrides []Override) ([]*Config, error) {
+	base, profile, err := readBase(envVarForPrivateKeyName, overrides)
+	if err != nil {
+		return nil, err
+	}
+	if profile != "" || len(base.Profiles) < 2 {
+		if err := base.finish(profile, overrides); err != nil {
+			return nil, err
+		}
+		if err := validate(base); err != nil {
+			return nil, fmt.Errorf("configuration validation failed: %w", err)
+		}
+		return []*Config{base}, nil
+	}
+	if envVarForPrivateKeyName != "" {
+		return nil, fmt.Errorf("the private key env var %s cannot be used for all profiles (%s); each profile posts with its own key_env. Select one with --profile or BOT_PROFILE", envVarForPrivateKeyName, strings.Join(base.ProfileNames(), ", "))
 	}
 
-	nostrRelaysEnv := os.Getenv("NOSTR_RELAYS")
-	if nostrRelaysEnv != "" {
-		cfg.NostrRelays = strings.Split(nostrRelaysEnv, ",")
-		// Trim whitespace from each relay URL, and filter out empty strings.
-		validRelays := make([]string, 0, len(cfg.NostrRelays))
-		for _, relay := range cfg.NostrRelays {
-			trimmedRelay := strings.TrimSpace(relay)
-			if trimmedRelay != "" {
-				validRelays = append(validRelays, trimmedRelay)
+	cfgs := make([]*Config, 0, len(base.Profiles))
+	keyProfiles := make(map[string]string) // Public key -> first profile using it
+	for _, p := range base.Profiles {
+		cfg := *base
+		if err := cfg.finish(p.Name, overrides); err != nil {
+			return nil, err
+		}
+		if cfg.BunkerURL != "" && p.BunkerEnv == "" {
+			return nil, fmt.Errorf("the bunker URL given on the command line cannot be used for all profiles (%s); each profile signs with its own bunker_env. Select one with --profile or BOT_PROFILE", strings.Join(base.ProfileNames(), ", "))
+		}
+		if err := validate(&cfg); err != nil {
+			return nil, fmt.Errorf("configuration validation failed for profile %s: %w", p.Name, err)
+		}
+		pubkey := cfg.PrivateKey.PublicKey()
+		if cfg.BunkerURL != "" {
+			pubkey = "" // Only the client key of a remote signer; the identity is checked once connected.
+		}
+		if other, ok := keyProfiles[pubkey]; ok && pubkey != "" {
+			return nil, fmt.Errorf("profiles %s and %s use the same private key; each profile run in one process needs its own identity", other, p.Name)
+		}
+		keyProfiles[pubkey] = p.Name
+		cfgs = append(cfgs, &cfg)
+	}
+	return cfgs, nil
+}
+
+// Redacted returns a copy of the configuration with the secrets masked, safe to print.
+// The private key always prints redacted, and the bunker URL without its secret.
+func (c *Config) Redacted() Config {
+	redacted := *c
+	redacted.NostrRelays = append([]string(nil), c.NostrRelays...)
+	redacted.APIKey = redact(c.APIKey)
+	redacted.BunkerURL = signer.RedactBunkerURL(c.BunkerURL)
+	return redacted
+}
+
+// redact masks a secret, keeping only whether it is set.
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "<redacted>"
+}
+
+// defaults returns the settings used when neither the config file nor the environment sets them.
+func defaults() *Config {
+	return &Config{
+		LogDir:           "logs",
+		LogLevel:         "info",
+		LedgerPath:       "data/ledger.db",
+		ScheduleStart:    "15:00",          // Default first posting slot for daemon mode
+		ScheduleInterval: 30 * time.Minute, // Same spacing as the one-shot wait between events
+		PushgatewayJob:   "calendar_bot",
+		BackfillPace:     5 * time.Minute, // Faster than the daily 30 minutes, but still spread out
+		SignerTimeout:    30 * time.Second,
+		ImageMaxBytes:    media.DefaultMaxBytes,
+		ImageMaxPerEvent: nostr.DefaultMaxImages,
+		VideoMaxBytes:    media.DefaultMaxVideoBytes,
+		ImageProcessing:  media.DefaultProcessOptions(),
+		Card:             card.DefaultStyle(),
+	}
+}
+
+// applyEnv overrides the settings with every environment variable that is set.
+func (c *Config) applyEnv() error {
+	setString(&c.APIEndpoint, os.Getenv("BOT_API_ENDPOINT"))
+	setString(&c.APIKey, os.Getenv("BOT_API_KEY"))
+	setString(&c.ProcessingLanguage, os.Getenv("BOT_PROCESSING_LANGUAGE"))
+	setString(&c.LogDir, os.Getenv("BOT_LOG_DIR"))
+	setString(&c.LogLevel, os.Getenv("BOT_LOG_LEVEL"))
+	setString(&c.LedgerPath, os.Getenv("BOT_LEDGER_PATH"))
+	setString(&c.ScheduleStart, os.Getenv("BOT_SCHEDULE_START"))
+
+	if intervalEnv := os.Getenv("BOT_SCHEDULE_INTERVAL"); intervalEnv != "" {
+		interval, err := time.ParseDuration(intervalEnv)
+		if err != nil {
+			return fmt.Errorf("invalid BOT_SCHEDULE_INTERVAL '%s': %w", intervalEnv, err)
+		}
+		c.ScheduleInterval = interval
+	}
+
+	setString(&c.MetricsAddr, os.Getenv("BOT_METRICS_ADDR"))
+	setString(&c.PushgatewayURL, os.Getenv("BOT_PUSHGATEWAY_URL"))
+	setString(&c.PushgatewayJob, os.Getenv("BOT_PUSHGATEWAY_JOB"))
+
+	if paceEnv := os.Getenv("BOT_BACKFILL_PACE"); paceEnv != "" {
+		pace, err := time.ParseDuration(paceEnv)
+		if err != nil {
+			return fmt.Errorf("invalid BOT_BACKFILL_PACE '%s': %w", paceEnv, err)
+		}
+		c.BackfillPace = pace
+	}
+
+	setString(&c.CalendarTitle, os.Getenv("BOT_CALENDAR_TITLE"))
+	setString(&c.BunkerURL, os.Getenv("BOT_BUNKER_URL"))
+	if timeoutEnv := os.Getenv("BOT_SIGNER_TIMEOUT"); timeoutEnv != "" {
+		timeout, err := time.ParseDuration(timeoutEnv)
+		if err != nil {
+			return fmt.Errorf("invalid BOT_SIGNER_TIMEOUT '%s': %w", timeoutEnv, err)
+		}
+		c.SignerTimeout = timeout
+	}
+
+	if maxBytesEnv := os.Getenv("BOT_IMAGE_MAX_BYTES"); maxBytesEnv != "" {
+		maxBytes, err := strconv.ParseInt(maxBytesEnv, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid BOT_IMAGE_MAX_BYTES '%s': %w", maxBytesEnv, err)
+		}
+		c.ImageMaxBytes = maxBytes
+	}
+
+	if videoMaxEnv := os.Getenv("BOT_VIDEO_MAX_BYTES"); videoMaxEnv != "" {
+		videoMax, err := strconv.ParseInt(videoMaxEnv, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid BOT_VIDEO_MAX_BYTES '%s': %w", videoMaxEnv, err)
+		}
+		c.VideoMaxBytes = videoMax
+	}
+
+	if maxImagesEnv := os.Getenv("BOT_IMAGE_MAX_PER_EVENT"); maxImagesEnv != "" {
+		maxImages, err := strconv.Atoi(maxImagesEnv)
+		if err != nil {
+			return fmt.Errorf("invalid BOT_IMAGE_MAX_PER_EVENT '%s': %w", maxImagesEnv, err)
+		}
+		c.ImageMaxPerEvent = maxImages
+	}
+
+	if processEnv := os.Getenv("BOT_IMAGE_PROCESS"); processEnv != "" {
+		c.ProcessImages = processEnv == "true"
+	}
+	for _, setting := range []struct {
+		env string
+		dst *int
+	}{
+		{"BOT_IMAGE_MAX_WIDTH", &c.ImageProcessing.MaxWidth},
+		{"BOT_IMAGE_MAX_HEIGHT", &c.ImageProcessing.MaxHeight},
+		{"BOT_IMAGE_QUALITY", &c.ImageProcessing.Quality},
+		{"BOT_IMAGE_THUMB_SIZE", &c.ImageProcessing.ThumbSize},
+	} {
+		if value := os.Getenv(setting.env); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s '%s': %w", setting.env, value, err)
 			}
+			*setting.dst = n
+		}
+	}
+	if outputMaxEnv := os.Getenv("BOT_IMAGE_OUTPUT_MAX_BYTES"); outputMaxEnv != "" {
+		outputMax, err := strconv.ParseInt(outputMaxEnv, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid BOT_IMAGE_OUTPUT_MAX_BYTES '%s': %w", outputMaxEnv, err)
 		}
-		cfg.NostrRelays = validRelays
+		c.ImageProcessing.MaxBytes = outputMax
 	}
 
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	c.setMediaServer(os.Getenv("BOT_BLOSSOM_SERVER"), os.Getenv("BOT_NIP96_SERVER"))
+	if cardsEnv := os.Getenv("BOT_CARDS"); cardsEnv != "" {
+		c.Cards = cardsEnv == "true"
 	}
+	setString(&c.Card.Font, os.Getenv("BOT_CARD_FONT"))
+	setString(&c.Card.BoldFont, os.Getenv("BOT_CARD_BOLD_FONT"))
+	setString(&c.Card.Logo, os.Getenv("BOT_CARD_LOGO"))
 
-	return cfg, nil
-} 
\ No newline at end of file
+	if retentionEnv := os.Getenv("BOT_METRICS_RETENTION_DAYS"); retentionEnv != "" {
+		retention, err := strconv.Atoi(retentionEnv)
+		if err != nil {
+			return fmt.Errorf("invalid BOT_METRICS_RETENTION_DAYS '%s': %w", retentionEnv, err)
+		}
+		c.MetricsRetentionDays = retention
+	}
+
+	if consoleLog := os.Getenv("BOT_CONSOLE_LOG"); consoleLog != "" {
+		c.ConsoleLog = consoleLog == "true"
+	}
+	if debugEnv := os.Getenv("BOT_DEBUG"); debugEnv != "" {
+		c.Debug = debugEnv == "true"
+	}
+
+	if nostrRelaysEnv := os.Getenv("NOSTR_RELAYS"); nostrRelaysEnv != "" {
+		// Trim whitespace from each relay URL, and filter out empty strings.
+		c.NostrRelays = trimList(strings.Split(nostrRelaysEnv, ","))
+	}
+
+	for i := range c.Profiles {
+		if err := c.Profiles[i].applyEnv(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
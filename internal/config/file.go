@@ -0,0 +1,308 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the layout of the optional YAML or TOML config file. Every field is
+// optional; settings left out keep their defaults, and environment variables still
+// override what the file sets. Secrets (API key, private keys) are never read from the
+// file itself: profiles name the env var that holds their key.
+type fileConfig struct {
+	API      fileAPI                `yaml:"api" toml:"api"`
+	Relays   []string               `yaml:"relays" toml:"relays"` // Default relays of every profile
+	Log      fileLog                `yaml:"log" toml:"log"`
+	Ledger   string                 `yaml:"ledger" toml:"ledger"`
+	Schedule fileSchedule           `yaml:"schedule" toml:"schedule"` // Default schedule of every profile
+	Metrics  fileMetrics            `yaml:"metrics" toml:"metrics"`
+	Backfill fileBackfill           `yaml:"backfill" toml:"backfill"`
+	Signer   fileSigner             `yaml:"signer" toml:"signer"`
+	Calendar fileCalendar           `yaml:"calendar" toml:"calendar"` // Default calendar of every profile
+	Images   fileImages             `yaml:"images" toml:"images"`
+	Videos   fileVideos             `yaml:"videos" toml:"videos"`
+	Media    fileMedia              `yaml:"media" toml:"media"` // Default media server of every profile
+	Cards    fileCards              `yaml:"cards" toml:"cards"`
+	Profiles map[string]fileProfile `yaml:"profiles" toml:"profiles"`
+}
+
+type fileAPI struct {
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+}
+
+type fileLog struct {
+	Dir     string `yaml:"dir" toml:"dir"`
+	Level   string `yaml:"level" toml:"level"`
+	Console *bool  `yaml:"console" toml:"console"`
+	Debug   *bool  `yaml:"debug" toml:"debug"`
+}
+
+type fileSchedule struct {
+	Start    string `yaml:"start" toml:"start"`
+	Interval string `yaml:"interval" toml:"interval"`
+}
+
+type fileMetrics struct {
+	Addr           string `yaml:"addr" toml:"addr"`
+	PushgatewayURL string `yaml:"pushgateway_url" toml:"pushgateway_url"`
+	PushgatewayJob string `yaml:"pushgateway_job" toml:"pushgateway_job"`
+	RetentionDays  *int   `yaml:"retention_days" toml:"retention_days"`
+}
+
+type fileBackfill struct {
+	Pace string `yaml:"pace" toml:"pace"`
+}
+
+type fileSigner struct {
+	Timeout string `yaml:"timeout" toml:"timeout"`
+}
+
+type fileVideos struct {
+	MaxBytes *int64 `yaml:"max_bytes" toml:"max_bytes"`
+}
+
+type fileImages struct {
+	MaxBytes       *int64 `yaml:"max_bytes" toml:"max_bytes"`
+	MaxPerEvent    *int   `yaml:"max_per_event" toml:"max_per_event"`
+	Process        *bool  `yaml:"process" toml:"process"`
+	MaxWidth       int    `yaml:"max_width" toml:"max_width"`
+	MaxHeight      int    `yaml:"max_height" toml:"max_height"`
+	OutputMaxBytes int64  `yaml:"output_max_bytes" toml:"output_max_bytes"`
+	Quality        int    `yaml:"quality" toml:"quality"`
+	ThumbSize      *int   `yaml:"thumb_size" toml:"thumb_size"`
+}
+
+type fileMedia struct {
+	Blossom string `yaml:"blossom" toml:"blossom"`
+	NIP96   string `yaml:"nip96" toml:"nip96"`
+}
+
+type fileCards struct {
+	Enabled  *bool      `yaml:"enabled" toml:"enabled"`
+	Width    int        `yaml:"width" toml:"width"`
+	Height   int        `yaml:"height" toml:"height"`
+	Font     string     `yaml:"font" toml:"font"`
+	BoldFont string     `yaml:"bold_font" toml:"bold_font"`
+	Logo     string     `yaml:"logo" toml:"logo"`
+	Colors   fileColors `yaml:"colors" toml:"colors"`
+	Template string     `yaml:"template" toml:"template"`
+}
+
+type fileColors struct {
+	Background string `yaml:"background" toml:"background"`
+	Foreground string `yaml:"foreground" toml:"foreground"`
+	Accent     string `yaml:"accent" toml:"accent"`
+}
+
+type fileCalendar struct {
+	Title string `yaml:"title" toml:"title"`
+}
+
+type fileProfile struct {
+	Language    string              `yaml:"language" toml:"language"`
+	KeyEnv      string              `yaml:"key_env" toml:"key_env"`
+	KeyFile     string              `yaml:"key_file" toml:"key_file"`
+	KeyPassEnv  string              `yaml:"key_password_env" toml:"key_password_env"`
+	KeyPassFile string              `yaml:"key_password_file" toml:"key_password_file"`
+	BunkerEnv   string              `yaml:"bunker_env" toml:"bunker_env"`
+	Relays      []string            `yaml:"relays" toml:"relays"`
+	KindRelays  map[string][]string `yaml:"kind_relays" toml:"kind_relays"`
+	Templates   map[string]string   `yaml:"templates" toml:"templates"`
+	Schedule    fileSchedule        `yaml:"schedule" toml:"schedule"`
+	Calendar    fileCalendar        `yaml:"calendar" toml:"calendar"`
+	Media       fileMedia           `yaml:"media" toml:"media"`
+}
+
+// readFile decodes the config file at path. The format is chosen by the extension:
+// .yaml or .yml for YAML, .toml for TOML. Unknown keys are rejected, so a typo does not
+// silently fall back to a default.
+func readFile(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file fileConfig
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), &file)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("config file %s: %s: unknown key", path, undecoded[0])
+		}
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported extension '%s'. Must be .yaml, .yml or .toml", path, ext)
+	}
+	return &file, nil
+}
+
+// apply copies the settings the file sets into cfg and builds its profiles, sorted by name.
+// Duration errors name the path of the offending key, e.g. profiles.en.schedule.interval.
+func (f *fileConfig) apply(cfg *Config) error {
+	setString(&cfg.APIEndpoint, f.API.Endpoint)
+	if len(f.Relays) > 0 {
+		cfg.NostrRelays = trimList(f.Relays)
+	}
+	setString(&cfg.LogDir, f.Log.Dir)
+	setString(&cfg.LogLevel, f.Log.Level)
+	if f.Log.Console != nil {
+		cfg.ConsoleLog = *f.Log.Console
+	}
+	if f.Log.Debug != nil {
+		cfg.Debug = *f.Log.Debug
+	}
+	setString(&cfg.LedgerPath, f.Ledger)
+	setString(&cfg.ScheduleStart, f.Schedule.Start)
+	if err := setDuration(&cfg.ScheduleInterval, f.Schedule.Interval, "schedule.interval"); err != nil {
+		return err
+	}
+	setString(&cfg.MetricsAddr, f.Metrics.Addr)
+	setString(&cfg.PushgatewayURL, f.Metrics.PushgatewayURL)
+	setString(&cfg.PushgatewayJob, f.Metrics.PushgatewayJob)
+	if f.Metrics.RetentionDays != nil {
+		cfg.MetricsRetentionDays = *f.Metrics.RetentionDays
+	}
+	if err := setDuration(&cfg.BackfillPace, f.Backfill.Pace, "backfill.pace"); err != nil {
+		return err
+	}
+	if err := setDuration(&cfg.SignerTimeout, f.Signer.Timeout, "signer.timeout"); err != nil {
+		return err
+	}
+	setString(&cfg.CalendarTitle, f.Calendar.Title)
+	if f.Images.MaxBytes != nil {
+		cfg.ImageMaxBytes = *f.Images.MaxBytes
+	}
+	if f.Images.MaxPerEvent != nil {
+		cfg.ImageMaxPerEvent = *f.Images.MaxPerEvent
+	}
+	if f.Videos.MaxBytes != nil {
+		cfg.VideoMaxBytes = *f.Videos.MaxBytes
+	}
+	if f.Images.Process != nil {
+		cfg.ProcessImages = *f.Images.Process
+	}
+	if f.Images.MaxWidth != 0 {
+		cfg.ImageProcessing.MaxWidth = f.Images.MaxWidth
+	}
+	if f.Images.MaxHeight != 0 {
+		cfg.ImageProcessing.MaxHeight = f.Images.MaxHeight
+	}
+	if f.Images.OutputMaxBytes != 0 {
+		cfg.ImageProcessing.MaxBytes = f.Images.OutputMaxBytes
+	}
+	if f.Images.Quality != 0 {
+		cfg.ImageProcessing.Quality = f.Images.Quality
+	}
+	if f.Images.ThumbSize != nil {
+		cfg.ImageProcessing.ThumbSize = *f.Images.ThumbSize // 0 turns thumbnails off
+	}
+	cfg.setMediaServer(f.Media.Blossom, f.Media.NIP96)
+	if f.Cards.Enabled != nil {
+		cfg.Cards = *f.Cards.Enabled
+	}
+	if f.Cards.Width != 0 {
+		cfg.Card.Width = f.Cards.Width
+	}
+	if f.Cards.Height != 0 {
+		cfg.Card.Height = f.Cards.Height
+	}
+	setString(&cfg.Card.Font, f.Cards.Font)
+	setString(&cfg.Card.BoldFont, f.Cards.BoldFont)
+	setString(&cfg.Card.Logo, f.Cards.Logo)
+	setString(&cfg.Card.Background, f.Cards.Colors.Background)
+	setString(&cfg.Card.Foreground, f.Cards.Colors.Foreground)
+	setString(&cfg.Card.Accent, f.Cards.Colors.Accent)
+	setString(&cfg.Card.Template, f.Cards.Template)
+
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cfg.Profiles = make([]Profile, 0, len(names))
+	for _, name := range names {
+		fp := f.Profiles[name]
+		profile := Profile{
+			Name:            name,
+			Language:        fp.Language,
+			KeyEnv:          fp.KeyEnv,
+			KeyFile:         fp.KeyFile,
+			KeyPasswordEnv:  fp.KeyPassEnv,
+			KeyPasswordFile: fp.KeyPassFile,
+			BunkerEnv:       fp.BunkerEnv,
+			Relays:          trimList(fp.Relays),
+			Templates:       fp.Templates,
+			ScheduleStart:   fp.Schedule.Start,
+			CalendarTitle:   fp.Calendar.Title,
+			BlossomServer:   fp.Media.Blossom,
+			NIP96Server:     fp.Media.NIP96,
+		}
+		if len(fp.KindRelays) > 0 {
+			profile.KindRelays = make(map[string][]string, len(fp.KindRelays))
+			for kind, relays := range fp.KindRelays {
+				profile.KindRelays[kind] = trimList(relays)
+			}
+		}
+		if err := setDuration(&profile.ScheduleInterval, fp.Schedule.Interval, "profiles."+name+".schedule.interval"); err != nil {
+			return err
+		}
+		cfg.Profiles = append(cfg.Profiles, profile)
+	}
+	return nil
+}
+
+// setMediaServer sets the media server if either kind is given. A layer naming one kind
+// replaces the other kind set by the layers below, so a profile can switch from Blossom
+// to NIP-96; naming both in one layer is reported by Validate.
+func (c *Config) setMediaServer(blossom string, nip96 string) {
+	if blossom != "" || nip96 != "" {
+		c.BlossomServer, c.NIP96Server = blossom, nip96
+	}
+}
+
+func setString(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
+
+func setDuration(dst *time.Duration, value string, path string) error {
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s: invalid duration '%s'", path, value)
+	}
+	*dst = d
+	return nil
+}
+
+// trimList trims whitespace from each item and drops empty ones.
+func trimList(items []string) []string {
+	trimmed := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			trimmed = append(trimmed, item)
+		}
+	}
+	return trimmed
+}
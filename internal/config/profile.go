@@ -0,0 +1,261 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// EventKinds are the kind names that kind_relays may be set for.
+var EventKinds = []string{"kind1", "kind20", "kind21", "kind22", "kind30023", "kind31922", "kind31924"}
+
+// TemplateKinds are the kind names that templates may be set for. The calendar (kind31924)
+// has no content of its own; "card" is the text of the quote cards.
+var TemplateKinds = []string{"kind1", "kind20", "kind21", "kind22", "kind30023", "kind31922", "card"}
+
+// Profile is one bot identity declared in the config file: a language posted with one
+// key to one set of relays on one schedule.
+type Profile struct {
+	Name             string
+	Language         string
+	KeyEnv           string              // Env var holding the profile's private key
+	KeyFile          string              // File holding the private key, read if KeyEnv is empty or unset
+	KeyPasswordEnv   string              // Env var holding the password of an ncryptsec key
+	KeyPasswordFile  string              // File holding the password of an ncryptsec key
+	BunkerEnv        string              // Env var holding the bunker:// URI of a remote signer holding the key
+	Relays           []string            // Relays of every kind, empty to use the top-level relays
+	KindRelays       map[string][]string // Relays for one kind, e.g. "kind20", replacing Relays for it
+	Templates        map[string]string   // Content template per kind, see bot.Templates
+	ScheduleStart    string              // Daemon mode: first posting slot, empty to use the top-level one
+	ScheduleInterval time.Duration       // Daemon mode: slot spacing, zero to use the top-level one
+	CalendarTitle    string              // Title of the profile's NIP-52 calendar, empty to use the top-level one
+	BlossomServer    string              // Blossom server the profile's images are stored on, empty to use the top-level one
+	NIP96Server      string              // NIP-96 server the profile's images are stored on, instead of a Blossom server
+}
+
+// envPrefix returns the prefix of the env vars overriding this profile's settings,
+// e.g. BOT_PROFILE_EN_TEST_ for the profile "en-test".
+func (p *Profile) envPrefix() string {
+	var b strings.Builder
+	b.WriteString("BOT_PROFILE_")
+	for _, r := range strings.ToUpper(p.Name) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	b.WriteRune('_')
+	return b.String()
+}
+
+// applyEnv overrides the profile's settings from BOT_PROFILE_<NAME>_* env vars.
+func (p *Profile) applyEnv() error {
+	prefix := p.envPrefix()
+	setString(&p.Language, os.Getenv(prefix+"LANGUAGE"))
+	setString(&p.KeyEnv, os.Getenv(prefix+"KEY_ENV"))
+	setString(&p.KeyFile, os.Getenv(prefix+"KEY_FILE"))
+	setString(&p.BunkerEnv, os.Getenv(prefix+"BUNKER_ENV"))
+	if relays := os.Getenv(prefix + "RELAYS"); relays != "" {
+		p.Relays = trimList(strings.Split(relays, ","))
+	}
+	setString(&p.ScheduleStart, os.Getenv(prefix+"SCHEDULE_START"))
+	setString(&p.CalendarTitle, os.Getenv(prefix+"CALENDAR_TITLE"))
+	if blossom, nip96 := os.Getenv(prefix+"BLOSSOM_SERVER"), os.Getenv(prefix+"NIP96_SERVER"); blossom != "" || nip96 != "" {
+		p.BlossomServer, p.NIP96Server = blossom, nip96
+	}
+	if err := setDuration(&p.ScheduleInterval, os.Getenv(prefix+"SCHEDULE_INTERVAL"), prefix+"SCHEDULE_INTERVAL"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validate checks the profile and returns one error per problem, each prefixed with
+// the path of the setting in the config file. defaultRelays are the top-level relays.
+func (p *Profile) validate(defaultRelays []string) []error {
+	path := "profiles." + p.Name
+	var errs []error
+	fail := func(field string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s.%s: %s", path, field, fmt.Sprintf(format, args...)))
+	}
+
+	switch {
+	case p.Language == "":
+		fail("language", "is required")
+	case !isLanguageCode(p.Language):
+		fail("language", "invalid language '%s'. Must be a lowercase language code, e.g. 'en' or 'ru'", p.Language)
+	}
+	if p.KeyEnv == "" && p.KeyFile == "" && p.BunkerEnv == "" {
+		fail("key_env", "is required unless key_file or bunker_env is set (the env var or file holding the profile's private key)")
+	}
+	if p.KeyPasswordEnv != "" && p.KeyPasswordFile != "" {
+		fail("key_password_file", "cannot be set together with key_password_env")
+	}
+	if len(p.Relays) == 0 && len(defaultRelays) == 0 {
+		fail("relays", "is required when no top-level relays are set")
+	}
+	for i, relay := range p.Relays {
+		if !isRelayURL(relay) {
+			fail(fmt.Sprintf("relays[%d]", i), "invalid relay URL '%s'. Must start with ws:// or wss://", relay)
+		}
+	}
+	for _, kind := range SortedKeys(p.KindRelays) {
+		relays := p.KindRelays[kind]
+		if !slices.Contains(EventKinds, kind) {
+			fail("kind_relays."+kind, "unknown kind. Must be one of %s", strings.Join(EventKinds, ", "))
+			continue
+		}
+		if len(relays) == 0 {
+			fail("kind_relays."+kind, "must list at least one relay")
+		}
+		for i, relay := range relays {
+			if !isRelayURL(relay) {
+				fail(fmt.Sprintf("kind_relays.%s[%d]", kind, i), "invalid relay URL '%s'. Must start with ws:// or wss://", relay)
+			}
+		}
+	}
+	for _, kind := range SortedKeys(p.Templates) {
+		text := p.Templates[kind]
+		if !slices.Contains(TemplateKinds, kind) {
+			fail("templates."+kind, "unknown kind. Must be one of %s", strings.Join(TemplateKinds, ", "))
+			continue
+		}
+		if _, err := template.New(kind).Parse(text); err != nil {
+			fail("templates."+kind, "%v", err)
+		}
+	}
+	if p.ScheduleStart != "" {
+		if _, err := time.Parse("15:04", p.ScheduleStart); err != nil {
+			fail("schedule.start", "invalid time '%s'. Must be HH:MM", p.ScheduleStart)
+		}
+	}
+	if p.ScheduleInterval < 0 {
+		fail("schedule.interval", "must be positive")
+	}
+	if p.BlossomServer != "" && !isHTTPURL(p.BlossomServer) {
+		fail("media.blossom", "invalid server URL '%s'. Must start with http:// or https://", p.BlossomServer)
+	}
+	if p.NIP96Server != "" && !isHTTPURL(p.NIP96Server) {
+		fail("media.nip96", "invalid server URL '%s'. Must start with http:// or https://", p.NIP96Server)
+	}
+	if p.BlossomServer != "" && p.NIP96Server != "" {
+		fail("media.nip96", "cannot be set together with media.blossom")
+	}
+	return errs
+}
+
+// selectProfile merges the profile called name into the top-level settings, so the rest
+// of the bot runs as that identity. An empty name selects the only profile if the file
+// declares exactly one. The private key env var given on the command line, if any, wins
+// over the profile's key settings. The remote signer is the profile's: BOT_BUNKER_URL is
+// ignored once profiles are declared.
+func (c *Config) selectProfile(name string) error {
+	if len(c.Profiles) == 0 {
+		if name != "" {
+			return fmt.Errorf("profile '%s' is selected but no config file declares profiles", name)
+		}
+		return nil
+	}
+	if name == "" {
+		if len(c.Profiles) > 1 {
+			return nil // Nothing selected yet; Validate asks for a selection if one is needed.
+		}
+		name = c.Profiles[0].Name
+	}
+
+	var profile *Profile
+	for i := range c.Profiles {
+		if c.Profiles[i].Name == name {
+			profile = &c.Profiles[i]
+		}
+	}
+	if profile == nil {
+		return fmt.Errorf("unknown profile '%s'. The config file declares: %s", name, strings.Join(c.ProfileNames(), ", "))
+	}
+
+	c.Profile = profile.Name
+	c.ProcessingLanguage = profile.Language
+	if len(profile.Relays) > 0 {
+		c.NostrRelays = profile.Relays
+	}
+	c.KindRelays = profile.KindRelays
+	c.Templates = profile.Templates
+	if text, ok := profile.Templates["card"]; ok {
+		c.Card.Template = text
+	}
+	setString(&c.ScheduleStart, profile.ScheduleStart)
+	setString(&c.CalendarTitle, profile.CalendarTitle)
+	c.setMediaServer(profile.BlossomServer, profile.NIP96Server)
+	if profile.ScheduleInterval > 0 {
+		c.ScheduleInterval = profile.ScheduleInterval
+	}
+	// A top-level BOT_BUNKER_URL would turn the profile's own key into the client key of
+	// that bunker's identity, so only the profile's bunker_env selects a remote signer.
+	c.BunkerEnv = profile.BunkerEnv
+	c.BunkerURL = ""
+	if profile.BunkerEnv != "" {
+		c.BunkerURL = os.Getenv(profile.BunkerEnv)
+	}
+	if c.EnvVarForPrivateKey == "" && c.KeyFile == "" {
+		c.EnvVarForPrivateKey = profile.KeyEnv
+		c.KeyFile = profile.KeyFile
+		c.KeyPasswordEnv = profile.KeyPasswordEnv
+		c.KeyPasswordFile = profile.KeyPasswordFile
+	}
+	return nil
+}
+
+// ProfileNames returns the names of the declared profiles in order.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for _, profile := range c.Profiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// validateProfiles checks every declared profile and reports all problems at once.
+func (c *Config) validateProfiles() error {
+	var errs []error
+	for i := range c.Profiles {
+		errs = append(errs, c.Profiles[i].validate(c.defaultRelays)...)
+	}
+	return errors.Join(errs...)
+}
+
+// SortedKeys returns the keys of m in order, e.g. to report errors in a stable order.
+func SortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isRelayURL(relay string) bool {
+	return strings.HasPrefix(relay, "ws://") || strings.HasPrefix(relay, "wss://")
+}
+
+func isHTTPURL(server string) bool {
+	return strings.HasPrefix(server, "http://") || strings.HasPrefix(server, "https://")
+}
+
+// isLanguageCode reports whether language looks like an ISO 639 code the API accepts,
+// i.e. two or three lowercase letters.
+func isLanguageCode(language string) bool {
+	if len(language) < 2 || len(language) > 3 {
+		return false
+	}
+	for _, r := range language {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
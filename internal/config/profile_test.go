@@ -0,0 +1,257 @@
+package config
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileValidate(t *testing.T) {
+	valid := func() Profile {
+		return Profile{Name: "en", Language: "en", KeyEnv: "EN_KEY"}
+	}
+	defaultRelays := []string{"wss://relay.example"}
+	tests := []struct {
+		name          string
+		modify        func(p *Profile)
+		defaultRelays []string
+		want          []string // Substrings of the expected errors, in order
+	}{
+		{name: "valid", modify: func(p *Profile) {}, defaultRelays: defaultRelays},
+		{name: "key file instead of key env", modify: func(p *Profile) { p.KeyEnv, p.KeyFile = "", "/run/secrets/en" }, defaultRelays: defaultRelays},
+		{name: "bunker instead of key env", modify: func(p *Profile) { p.KeyEnv, p.BunkerEnv = "", "EN_BUNKER" }, defaultRelays: defaultRelays},
+		{
+			name:          "missing language",
+			modify:        func(p *Profile) { p.Language = "" },
+			defaultRelays: defaultRelays,
+			want:          []string{"profiles.en.language: is required"},
+		},
+		{
+			name:          "invalid language",
+			modify:        func(p *Profile) { p.Language = "EN" },
+			defaultRelays: defaultRelays,
+			want:          []string{"profiles.en.language: invalid language 'EN'"},
+		},
+		{
+			name:          "no key",
+			modify:        func(p *Profile) { p.KeyEnv = "" },
+			defaultRelays: defaultRelays,
+			want:          []string{"profiles.en.key_env: is required"},
+		},
+		{
+			name:          "two password sources",
+			modify:        func(p *Profile) { p.KeyPasswordEnv, p.KeyPasswordFile = "EN_PASSWORD", "/run/secrets/password" },
+			defaultRelays: defaultRelays,
+			want:          []string{"profiles.en.key_password_file: cannot be set together"},
+		},
+		{
+			name:   "no relays anywhere",
+			modify: func(p *Profile) {},
+			want:   []string{"profiles.en.relays: is required"},
+		},
+		{
+			name:   "own relays without top-level relays",
+			modify: func(p *Profile) { p.Relays = []string{"wss://own.example"} },
+		},
+		{
+			name:          "invalid relay",
+			modify:        func(p *Profile) { p.Relays = []string{"wss://ok.example", "https://relay.example"} },
+			defaultRelays: defaultRelays,
+			want:          []string{"profiles.en.relays[1]: invalid relay URL 'https://relay.example'"},
+		},
+		{
+			name: "kind relays",
+			modify: func(p *Profile) {
+				p.KindRelays = map[string][]string{"kind20": {"wss://pics.example"}, "kind3": {"wss://x.example"}, "kind1": {}, "kind21": {"video.example"}}
+			},
+			defaultRelays: defaultRelays,
+			want: []string{
+				"profiles.en.kind_relays.kind1: must list at least one relay",
+				"profiles.en.kind_relays.kind21[0]: invalid relay URL 'video.example'",
+				"profiles.en.kind_relays.kind3: unknown kind",
+			},
+		},
+		{
+			name: "templates",
+			modify: func(p *Profile) {
+				p.Templates = map[string]string{"kind1": "{{.Title}}", "card": "{{.Title", "kind7": "x"}
+			},
+			defaultRelays: defaultRelays,
+			want:          []string{"profiles.en.templates.card: template: card", "profiles.en.templates.kind7: unknown kind"},
+		},
+		{
+			name:          "schedule",
+			modify:        func(p *Profile) { p.ScheduleStart, p.ScheduleInterval = "25:00", -time.Minute },
+			defaultRelays: defaultRelays,
+			want:          []string{"profiles.en.schedule.start: invalid time '25:00'", "profiles.en.schedule.interval: must be positive"},
+		},
+		{
+			name:          "media servers",
+			modify:        func(p *Profile) { p.BlossomServer, p.NIP96Server = "blossom.example", "https://nip96.example" },
+			defaultRelays: defaultRelays,
+			want:          []string{"profiles.en.media.blossom: invalid server URL 'blossom.example'", "profiles.en.media.nip96: cannot be set together with media.blossom"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.modify(&p)
+			errs := p.validate(tt.defaultRelays)
+			if len(errs) != len(tt.want) {
+				t.Fatalf("validate() = %v, want %d errors", errors.Join(errs...), len(tt.want))
+			}
+			for i, err := range errs {
+				if !strings.Contains(err.Error(), tt.want[i]) {
+					t.Errorf("error %d = %q, want one containing %q", i, err, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSelectProfile(t *testing.T) {
+	t.Setenv("EN_BUNKER", "bunker://abc?relay=wss://bunker.example")
+	profiles := func() []Profile {
+		return []Profile{
+			{Name: "en", Language: "en", KeyEnv: "EN_KEY", BunkerEnv: "EN_BUNKER", Relays: []string{"wss://en.example"}, CalendarTitle: "English"},
+			{Name: "ru", Language: "ru", KeyEnv: "RU_KEY", KeyFile: "/run/secrets/ru", ScheduleInterval: time.Hour},
+		}
+	}
+	base := func() *Config {
+		return &Config{
+			ProcessingLanguage: "de",
+			NostrRelays:        []string{"wss://top.example"},
+			ScheduleInterval:   30 * time.Minute,
+			CalendarTitle:      "Top",
+			Profiles:           profiles(),
+		}
+	}
+	tests := []struct {
+		name    string
+		config  func() *Config
+		profile string
+		check   func(t *testing.T, c *Config)
+		wantErr string
+	}{
+		{
+			name:    "profile selected without profiles",
+			config:  func() *Config { return &Config{} },
+			profile: "en",
+			wantErr: "no config file declares profiles",
+		},
+		{
+			name:    "unknown profile",
+			config:  base,
+			profile: "fr",
+			wantErr: "unknown profile 'fr'. The config file declares: en, ru",
+		},
+		{
+			name:   "nothing selected among several",
+			config: base,
+			check: func(t *testing.T, c *Config) {
+				if c.Profile != "" || c.ProcessingLanguage != "de" {
+					t.Errorf("got profile %q language %q, want the top-level settings", c.Profile, c.ProcessingLanguage)
+				}
+			},
+		},
+		{
+			name: "only profile selected by default",
+			config: func() *Config {
+				c := base()
+				c.Profiles = c.Profiles[1:]
+				return c
+			},
+			check: func(t *testing.T, c *Config) {
+				if c.Profile != "ru" || c.ProcessingLanguage != "ru" {
+					t.Errorf("got profile %q language %q, want ru", c.Profile, c.ProcessingLanguage)
+				}
+			},
+		},
+		{
+			name:    "profile settings replace top-level ones",
+			config:  base,
+			profile: "en",
+			check: func(t *testing.T, c *Config) {
+				if !slices.Equal(c.NostrRelays, []string{"wss://en.example"}) || c.CalendarTitle != "English" || c.ScheduleInterval != 30*time.Minute {
+					t.Errorf("got relays %v title %q interval %s", c.NostrRelays, c.CalendarTitle, c.ScheduleInterval)
+				}
+				if c.EnvVarForPrivateKey != "EN_KEY" || c.BunkerURL != "bunker://abc?relay=wss://bunker.example" {
+					t.Errorf("got key env %q bunker %q, want the profile's", c.EnvVarForPrivateKey, c.BunkerURL)
+				}
+			},
+		},
+		{
+			name:    "unset profile settings keep top-level ones",
+			config:  base,
+			profile: "ru",
+			check: func(t *testing.T, c *Config) {
+				if !slices.Equal(c.NostrRelays, []string{"wss://top.example"}) || c.CalendarTitle != "Top" || c.ScheduleInterval != time.Hour {
+					t.Errorf("got relays %v title %q interval %s", c.NostrRelays, c.CalendarTitle, c.ScheduleInterval)
+				}
+				if c.EnvVarForPrivateKey != "RU_KEY" || c.KeyFile != "/run/secrets/ru" {
+					t.Errorf("got key env %q file %q, want the profile's", c.EnvVarForPrivateKey, c.KeyFile)
+				}
+			},
+		},
+		{
+			name: "key given on the command line wins",
+			config: func() *Config {
+				c := base()
+				c.EnvVarForPrivateKey = "CLI_KEY"
+				return c
+			},
+			profile: "ru",
+			check: func(t *testing.T, c *Config) {
+				if c.EnvVarForPrivateKey != "CLI_KEY" || c.KeyFile != "" {
+					t.Errorf("got key env %q file %q, want CLI_KEY only", c.EnvVarForPrivateKey, c.KeyFile)
+				}
+			},
+		},
+		{
+			name: "top-level bunker URL does not reach a profile without bunker_env",
+			config: func() *Config {
+				c := base()
+				c.BunkerURL = "bunker://top?relay=wss://bunker.example"
+				return c
+			},
+			profile: "ru",
+			check: func(t *testing.T, c *Config) {
+				if c.BunkerURL != "" || c.BunkerEnv != "" {
+					t.Errorf("got bunker %q from %q, want none", c.BunkerURL, c.BunkerEnv)
+				}
+			},
+		},
+		{
+			name: "profile bunker replaces the top-level one",
+			config: func() *Config {
+				c := base()
+				c.BunkerURL = "bunker://top?relay=wss://bunker.example"
+				return c
+			},
+			profile: "en",
+			check: func(t *testing.T, c *Config) {
+				if c.BunkerURL != "bunker://abc?relay=wss://bunker.example" || c.BunkerEnv != "EN_BUNKER" {
+					t.Errorf("got bunker %q from %q, want the profile's", c.BunkerURL, c.BunkerEnv)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.config()
+			err := c.selectProfile(tt.profile)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("selectProfile(%q) error = %v, want one containing %q", tt.profile, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectProfile(%q): %v", tt.profile, err)
+			}
+			tt.check(t, c)
+		})
+	}
+}
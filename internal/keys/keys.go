@@ -0,0 +1,233 @@
+package keys
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/nbd-wtf/go-nostr/nip49"
+)
+
+// Key is a loaded Nostr private key. The key signs events itself, and printing or encoding
+// it yields "<redacted>", so it cannot end up in logs or configuration dumps by accident.
+// Use Npub to identify it; Secret is only for libraries that need the raw key.
+type Key struct {
+	secret string // Hex
+	pubkey string // Hex
+	npub   string
+}
+
+// Parse parses a private key given as 64 hex characters, a NIP-19 nsec or a NIP-49
+// ncryptsec. password is only called for an ncryptsec. Errors never include the key.
+func Parse(value string, password func() (string, error)) (Key, error) {
+	value = strings.TrimSpace(value)
+	var secret string
+	switch {
+	case strings.HasPrefix(value, "nsec1"):
+		prefix, decoded, err := nip19.Decode(value)
+		if err != nil || prefix != "nsec" {
+			return Key{}, errors.New("invalid nsec private key")
+		}
+		secret = decoded.(string)
+	case strings.HasPrefix(value, "ncryptsec1"):
+		pass, err := password()
+		if err != nil {
+			return Key{}, err
+		}
+		secret, err = nip49.Decrypt(value, pass)
+		if err != nil {
+			return Key{}, errors.New("failed to decrypt ncryptsec private key: wrong password or corrupted key")
+		}
+	case len(value) == 64 && isHex(value):
+		secret = strings.ToLower(value)
+	default:
+		return Key{}, errors.New("unrecognized private key format. Must be 64 hex characters, an nsec or an ncryptsec")
+	}
+
+	if !inCurveRange(secret) {
+		return Key{}, errors.New("invalid private key: not a valid secp256k1 secret")
+	}
+	pubkey, err := nostr.GetPublicKey(secret)
+	if err != nil {
+		return Key{}, errors.New("invalid private key: not a valid secp256k1 secret")
+	}
+	npub, err := nip19.EncodePublicKey(pubkey)
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	return Key{secret: secret, pubkey: pubkey, npub: npub}, nil
+}
+
+// IsZero reports whether no key is loaded.
+func (k Key) IsZero() bool {
+	return k.secret == ""
+}
+
+// PublicKey returns the hex public key.
+func (k Key) PublicKey() string {
+	return k.pubkey
+}
+
+// Npub returns the NIP-19 npub of the public key, the form to log.
+func (k Key) Npub() string {
+	return k.npub
+}
+
+// Sign sets the event's pubkey, ID and signature.
+func (k Key) Sign(ev *nostr.Event) error {
+	if k.IsZero() {
+		return errors.New("no private key loaded")
+	}
+	return ev.Sign(k.secret)
+}
+
+// Secret returns the hex private key, for libraries that sign with it themselves (e.g. the
+// NIP-46 client). Never log or print it.
+func (k Key) Secret() string {
+	return k.secret
+}
+
+// Equal reports whether both keys are the same identity, whatever format they were loaded from.
+func (k Key) Equal(other Key) bool {
+	return k.pubkey == other.pubkey
+}
+
+// String returns "<redacted>" for a loaded key and "" otherwise.
+func (k Key) String() string {
+	if k.IsZero() {
+		return ""
+	}
+	return "<redacted>"
+}
+
+// GoString keeps %#v from printing the secret.
+func (k Key) GoString() string {
+	return k.String()
+}
+
+// MarshalText keeps encoders (JSON, YAML, log fields) from writing the secret.
+func (k Key) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// LooksSecret reports whether value looks like a private key in one of the formats Parse
+// accepts, so debug dumps can leave it out whatever its env var is called.
+func LooksSecret(value string) bool {
+	value = strings.TrimSpace(value)
+	return strings.HasPrefix(value, "nsec1") || strings.HasPrefix(value, "ncryptsec1") ||
+		(len(value) == 64 && isHex(value))
+}
+
+// curveOrder is the order n of secp256k1 in lowercase hex. A private key must lie in [1, n-1].
+const curveOrder = "fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141"
+
+// inCurveRange reports whether the 64 lowercase hex characters of secret are a number in
+// [1, n-1]. The signing library reduces other values modulo n instead of rejecting them.
+func inCurveRange(secret string) bool {
+	return secret != strings.Repeat("0", 64) && secret < curveOrder
+}
+
+func isHex(value string) bool {
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+// Source says where to load a key from. Env is the usual way; a key file (e.g. a Docker
+// secret under /run/secrets) is used when the env var is empty. The password of an
+// ncryptsec key is read from PasswordEnv or PasswordFile.
+type Source struct {
+	Env          string // Env var holding the key
+	File         string // File holding the key
+	PasswordEnv  string // Env var holding the ncryptsec password
+	PasswordFile string // File holding the ncryptsec password
+}
+
+// WithDefaults fills in the conventional companions of the key's env var: <Env>_FILE for
+// the key file, and <Env>_PASSWORD and <Env>_PASSWORD_FILE for the ncryptsec password.
+func (s Source) WithDefaults() Source {
+	if s.Env == "" {
+		return s
+	}
+	if s.File == "" {
+		s.File = os.Getenv(s.Env + "_FILE")
+	}
+	if s.PasswordEnv == "" && s.PasswordFile == "" {
+		if os.Getenv(s.Env+"_PASSWORD") != "" {
+			s.PasswordEnv = s.Env + "_PASSWORD"
+		} else {
+			s.PasswordFile = os.Getenv(s.Env + "_PASSWORD_FILE")
+		}
+	}
+	return s
+}
+
+// IsZero reports whether the source names no env var or file.
+func (s Source) IsZero() bool {
+	return s.Env == "" && s.File == ""
+}
+
+// Describe names where the key is read from, for error messages.
+func (s Source) Describe() string {
+	switch {
+	case s.Env != "" && s.File != "":
+		return fmt.Sprintf("%s (or file %s)", s.Env, s.File)
+	case s.File != "":
+		return "file " + s.File
+	default:
+		return s.Env
+	}
+}
+
+// ErrNotSet is returned by Load when the source's env var and file are both empty.
+var ErrNotSet = errors.New("private key is not set")
+
+// Load reads and parses the key from the source. Errors name the source but never include
+// the key or password.
+func Load(s Source) (Key, error) {
+	value := ""
+	if s.Env != "" {
+		value = os.Getenv(s.Env)
+	}
+	if value == "" && s.File != "" {
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return Key{}, fmt.Errorf("failed to read key file: %w", err)
+		}
+		value = string(data)
+	}
+	if strings.TrimSpace(value) == "" {
+		return Key{}, fmt.Errorf("%s: %w", s.Describe(), ErrNotSet)
+	}
+
+	key, err := Parse(value, s.password)
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", s.Describe(), err)
+	}
+	return key, nil
+}
+
+// password returns the ncryptsec password from the source.
+func (s Source) password() (string, error) {
+	switch {
+	case s.PasswordEnv != "":
+		if password := os.Getenv(s.PasswordEnv); password != "" {
+			return password, nil
+		}
+		return "", fmt.Errorf("ncryptsec key needs a password but %s is not set", s.PasswordEnv)
+	case s.PasswordFile != "":
+		data, err := os.ReadFile(s.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %w", err)
+		}
+		// Only the line break editors and `echo` add is removed; a password may contain spaces.
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case s.Env != "":
+		return "", fmt.Errorf("ncryptsec key needs a password: set %s_PASSWORD or %s_PASSWORD_FILE", s.Env, s.Env)
+	default:
+		return "", errors.New("ncryptsec key needs a password: set key_password_env or key_password_file")
+	}
+}
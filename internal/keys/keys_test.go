@@ -0,0 +1,166 @@
+package keys
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/nbd-wtf/go-nostr/nip49"
+)
+
+const testSecret = "67dea2ed018072d675f5415ecfaed7d2597555e202d85b3d65ea4e58d2d92ffa"
+
+func testFormats(t *testing.T) (nsec string, ncryptsec string) {
+	t.Helper()
+	nsec, err := nip19.EncodePrivateKey(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ncryptsec, err = nip49.Encrypt(testSecret, "correct horse", 4, nip49.ClientDoesNotTrackThisData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nsec, ncryptsec
+}
+
+func password(value string) func() (string, error) {
+	return func() (string, error) { return value, nil }
+}
+
+func TestParse(t *testing.T) {
+	nsec, ncryptsec := testFormats(t)
+	wantPubkey, err := nostr.GetPublicKey(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noPassword := func() (string, error) { return "", errors.New("no password configured") }
+
+	tests := []struct {
+		name     string
+		value    string
+		password func() (string, error)
+		wantErr  string
+	}{
+		{name: "hex", value: testSecret},
+		{name: "upper case hex", value: strings.ToUpper(testSecret)},
+		{name: "hex with line break", value: testSecret + "\n"},
+		{name: "nsec", value: nsec},
+		{name: "nsec with spaces", value: "  " + nsec + " "},
+		{name: "ncryptsec", value: ncryptsec, password: password("correct horse")},
+		{name: "ncryptsec with wrong password", value: ncryptsec, password: password("battery staple"), wantErr: "wrong password or corrupted key"},
+		{name: "ncryptsec without password", value: ncryptsec, password: noPassword, wantErr: "no password configured"},
+		{name: "corrupted nsec", value: nsec[:len(nsec)-1] + "q", wantErr: "invalid nsec private key"},
+		{name: "npub", value: "npub1" + nsec[5:], wantErr: "unrecognized private key format"},
+		{name: "short hex", value: testSecret[:62], wantErr: "unrecognized private key format"},
+		{name: "not hex", value: "zz" + testSecret[2:], wantErr: "unrecognized private key format"},
+		{name: "zero secret", value: strings.Repeat("0", 64), wantErr: "not a valid secp256k1 secret"},
+		{name: "secret equal to the curve order", value: strings.ToUpper(curveOrder), wantErr: "not a valid secp256k1 secret"},
+		{name: "secret above the curve order", value: strings.Repeat("f", 64), wantErr: "not a valid secp256k1 secret"},
+		{name: "empty", value: "", wantErr: "unrecognized private key format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := Parse(tt.value, tt.password)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				if tt.value != "" && strings.Contains(err.Error(), strings.TrimSpace(tt.value)) {
+					t.Errorf("Parse() error %q includes the key", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(): %v", err)
+			}
+			if key.Secret() != testSecret || key.PublicKey() != wantPubkey || !strings.HasPrefix(key.Npub(), "npub1") {
+				t.Errorf("Parse() = secret %s pubkey %s npub %s, want the test key", key.Secret(), key.PublicKey(), key.Npub())
+			}
+		})
+	}
+}
+
+func TestKeyRedacted(t *testing.T) {
+	key, err := Parse(testSecret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(struct{ Key Key }{key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, printed := range []string{key.String(), fmt.Sprintf("%v %+v %#v %s", key, key, key, key), string(encoded)} {
+		if strings.Contains(printed, testSecret) || !strings.Contains(printed, "redacted") {
+			t.Errorf("printed key as %q, want <redacted>", printed)
+		}
+	}
+	if (Key{}).String() != "" {
+		t.Errorf("empty key prints as %q, want nothing", Key{}.String())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	nsec, ncryptsec := testFormats(t)
+	dir := t.TempDir()
+	writeFile := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	keyFile := writeFile("key", nsec+"\n")
+	encryptedFile := writeFile("encrypted", ncryptsec+"\n")
+	passwordFile := writeFile("password", "correct horse\n")
+	t.Setenv("TEST_KEY_SET", testSecret)
+	t.Setenv("TEST_KEY_EMPTY", "")
+	t.Setenv("TEST_KEY_ENCRYPTED", ncryptsec)
+	t.Setenv("TEST_KEY_ENCRYPTED_PASSWORD", "correct horse")
+
+	tests := []struct {
+		name    string
+		source  Source
+		wantErr string
+	}{
+		{name: "env", source: Source{Env: "TEST_KEY_SET", File: keyFile}},
+		{name: "file when the env var is empty", source: Source{Env: "TEST_KEY_EMPTY", File: keyFile}},
+		{name: "file only", source: Source{File: keyFile}},
+		{name: "ncryptsec with password env", source: Source{Env: "TEST_KEY_ENCRYPTED", PasswordEnv: "TEST_KEY_ENCRYPTED_PASSWORD"}},
+		{name: "ncryptsec file with password file", source: Source{File: encryptedFile, PasswordFile: passwordFile}},
+		{name: "ncryptsec with default password env", source: Source{Env: "TEST_KEY_ENCRYPTED"}.WithDefaults()},
+		{name: "ncryptsec without password", source: Source{File: encryptedFile}, wantErr: "file " + encryptedFile + ": ncryptsec key needs a password"},
+		{name: "ncryptsec with unset password env", source: Source{Env: "TEST_KEY_ENCRYPTED", PasswordEnv: "TEST_KEY_UNSET"}, wantErr: "TEST_KEY_UNSET is not set"},
+		{name: "nothing set", source: Source{Env: "TEST_KEY_EMPTY"}, wantErr: "TEST_KEY_EMPTY: private key is not set"},
+		{name: "missing file", source: Source{Env: "TEST_KEY_EMPTY", File: filepath.Join(dir, "missing")}, wantErr: "failed to read key file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := Load(tt.source)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load(): %v", err)
+			}
+			if key.Secret() != testSecret {
+				t.Errorf("Load() loaded another key")
+			}
+		})
+	}
+}
+
+func TestLoadNotSet(t *testing.T) {
+	_, err := Load(Source{Env: "TEST_KEY_UNSET"})
+	if !errors.Is(err, ErrNotSet) {
+		t.Errorf("Load() error = %v, want ErrNotSet", err)
+	}
+}
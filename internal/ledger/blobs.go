@@ -0,0 +1,64 @@
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// blobsBucket caches the media the bot stored on media servers, keyed by server and hash.
+// Blobs are content-addressed, so the cache is shared by every publishing pubkey.
+var blobsBucket = []byte("blobs")
+
+// Blob is an image stored on a media server, recorded so it is uploaded only once.
+type Blob struct {
+	Server   string    `json:"server"`            // Base URL of the media server
+	SHA256   string    `json:"sha256"`            // Hex SHA-256 of the original image
+	Variant  string    `json:"variant,omitempty"` // Processing the copy was made with (media.ProcessOptions.Variant), empty for the original bytes
+	URL      string    `json:"url"`               // Where the server serves the image
+	Fields   []string  `json:"fields,omitempty"`  // imeta fields describing the copy, see media.Stored
+	StoredAt time.Time `json:"storedAt"`
+}
+
+func blobKey(server string, hash string, variant string) []byte {
+	if variant != "" {
+		return []byte(server + "/" + hash + "/" + variant)
+	}
+	return []byte(server + "/" + hash)
+}
+
+// Blob returns the blob with the given hash and variant stored on server, or nil if there
+// is none.
+func (l *Ledger) Blob(server string, hash string, variant string) (*Blob, error) {
+	var blob *Blob
+	err := l.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(blobsBucket).Get(blobKey(server, hash, variant))
+		if data == nil {
+			return nil
+		}
+		blob = &Blob{}
+		return json.Unmarshal(data, blob)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s of %s: %w", hash, server, err)
+	}
+	return blob, nil
+}
+
+// RecordBlob stores a blob, replacing any earlier record of the same hash and variant on
+// the same server.
+func (l *Ledger) RecordBlob(blob Blob) error {
+	data, err := json.Marshal(blob)
+	if err != nil {
+		return fmt.Errorf("failed to encode blob %s: %w", blob.SHA256, err)
+	}
+	err = l.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(blobsBucket).Put(blobKey(blob.Server, blob.SHA256, blob.Variant), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record blob %s of %s: %w", blob.SHA256, blob.Server, err)
+	}
+	return nil
+}
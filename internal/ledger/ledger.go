@@ -0,0 +1,356 @@
+package ledger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"calendar-bot/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+	bolt "go.etcd.io/bbolt"
+)
+
+// publishesBucket is the top-level bucket holding one nested bucket per publishing pubkey.
+var publishesBucket = []byte("publishes")
+
+// queuesBucket holds the remaining work of an interrupted run, keyed by publishing pubkey.
+var queuesBucket = []byte("queues")
+
+// Entry is the ledger record for one API event published as one Nostr kind on one day.
+// The signed event is stored so an interrupted publish can be resumed with the exact same
+// event ID on the relays that have not received it yet.
+type Entry struct {
+	APIEventID   uint                 `json:"apiEventID"`
+	Date         string               `json:"date"` // Posting date, YYYY-MM-DD
+	Kind         string               `json:"kind"` // "kind1", "kind20", ...
+	NostrEventID string               `json:"nostrEventID"`
+	Event        nostr.Event          `json:"event"`
+	Relays       map[string]time.Time `json:"relays"` // Relay URL -> time of successful publish
+	CreatedAt    time.Time            `json:"createdAt"`
+	UpdatedAt    time.Time            `json:"updatedAt"`
+
+	// DeletionEventID is the NIP-09 deletion request sent for the event, empty if it was
+	// never deleted. A deleted entry still counts as published so it is not posted again.
+	DeletionEventID string     `json:"deletionEventID,omitempty"`
+	DeletedAt       *time.Time `json:"deletedAt,omitempty"`
+}
+
+// Published reports whether the event reached at least one relay.
+func (e *Entry) Published() bool {
+	return len(e.Relays) > 0
+}
+
+// MissingRelays returns the relays from the given list that have not acknowledged the event yet.
+func (e *Entry) MissingRelays(relays []string) []string {
+	missing := make([]string, 0, len(relays))
+	for _, relayURL := range relays {
+		if _, ok := e.Relays[relayURL]; !ok {
+			missing = append(missing, relayURL)
+		}
+	}
+	return missing
+}
+
+// Ledger is an embedded on-disk record of every event the bot has published.
+// Records are scoped by the publishing pubkey so test and production identities
+// can safely share one ledger file.
+type Ledger struct {
+	db     *bolt.DB
+	pubkey string
+}
+
+// Open opens (or creates) the ledger file at path for the given publishing pubkey.
+func Open(path string, pubkey string) (*Ledger, error) {
+	if pubkey == "" {
+		return nil, fmt.Errorf("pubkey is required to open the publish ledger")
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create ledger directory %s: %w", dir, err)
+		}
+	}
+
+	// The timeout keeps a second bot instance from blocking forever on the file lock.
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger %s: %w", path, err)
+	}
+
+	l, err := (&Ledger{db: db}).ForPubkey(pubkey)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// ForPubkey returns a ledger for another publishing pubkey that shares this ledger's file,
+// so several identities run by one process can use one ledger (bbolt locks the file, so
+// it cannot be opened twice). Only the ledger returned by Open should be closed.
+func (l *Ledger) ForPubkey(pubkey string) (*Ledger, error) {
+	if pubkey == "" {
+		return nil, fmt.Errorf("pubkey is required to open the publish ledger")
+	}
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(publishesBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := root.CreateBucketIfNotExists([]byte(pubkey)); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(queuesBucket); err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(blobsBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ledger buckets: %w", err)
+	}
+	return &Ledger{db: l.db, pubkey: pubkey}, nil
+}
+
+// Close closes the underlying database file, shared by every ledger derived with ForPubkey.
+func (l *Ledger) Close() error {
+	return l.db.Close()
+}
+
+// entryKey builds the lookup key for an entry. Dates sort lexically, which keeps
+// one day's entries adjacent in the bucket.
+func entryKey(date string, kind string, apiEventID uint) []byte {
+	return []byte(date + "/" + kind + "/" + strconv.FormatUint(uint64(apiEventID), 10))
+}
+
+func (l *Ledger) bucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	root := tx.Bucket(publishesBucket)
+	if root == nil {
+		return nil, errors.New("ledger is missing the publishes bucket")
+	}
+	b := root.Bucket([]byte(l.pubkey))
+	if b == nil {
+		return nil, fmt.Errorf("ledger is missing the bucket for pubkey %s", l.pubkey)
+	}
+	return b, nil
+}
+
+// Get returns the entry for the given API event, posting date and kind, or nil if there is none.
+func (l *Ledger) Get(apiEventID uint, date string, kind string) (*Entry, error) {
+	var entry *Entry
+	err := l.db.View(func(tx *bolt.Tx) error {
+		b, err := l.bucket(tx)
+		if err != nil {
+			return err
+		}
+		data := b.Get(entryKey(date, kind, apiEventID))
+		if data == nil {
+			return nil
+		}
+		entry = &Entry{}
+		return json.Unmarshal(data, entry)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ledger entry for event %d (%s, %s): %w", apiEventID, date, kind, err)
+	}
+	return entry, nil
+}
+
+// RecordSigned stores a freshly signed event before it is sent to any relay.
+// An existing entry for the same key is replaced, since a new signature means a new event ID.
+func (l *Ledger) RecordSigned(apiEventID uint, date string, kind string, ev nostr.Event) (*Entry, error) {
+	now := time.Now().UTC()
+	entry := &Entry{
+		APIEventID:   apiEventID,
+		Date:         date,
+		Kind:         kind,
+		NostrEventID: ev.ID,
+		Event:        ev,
+		Relays:       make(map[string]time.Time),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		return l.put(tx, entry)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record signed event %s in ledger: %w", ev.ID, err)
+	}
+	return entry, nil
+}
+
+// RecordRelay marks the entry's event as accepted by relayURL.
+func (l *Ledger) RecordRelay(apiEventID uint, date string, kind string, relayURL string) error {
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		b, err := l.bucket(tx)
+		if err != nil {
+			return err
+		}
+		data := b.Get(entryKey(date, kind, apiEventID))
+		if data == nil {
+			return errors.New("no signed event recorded")
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		if entry.Relays == nil {
+			entry.Relays = make(map[string]time.Time)
+		}
+		entry.Relays[relayURL] = time.Now().UTC()
+		entry.UpdatedAt = time.Now().UTC()
+		return l.put(tx, &entry)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record relay %s for event %d (%s, %s): %w", relayURL, apiEventID, date, kind, err)
+	}
+	return nil
+}
+
+// Entries returns every entry recorded for the given posting date, in key order.
+func (l *Ledger) Entries(date string) ([]*Entry, error) {
+	entries := make([]*Entry, 0)
+	err := l.db.View(func(tx *bolt.Tx) error {
+		b, err := l.bucket(tx)
+		if err != nil {
+			return err
+		}
+		prefix := []byte(date + "/")
+		c := b.Cursor()
+		for k, data := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, data = c.Next() {
+			entry := &Entry{}
+			if err := json.Unmarshal(data, entry); err != nil {
+				return fmt.Errorf("entry %s: %w", k, err)
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ledger entries for %s: %w", date, err)
+	}
+	return entries, nil
+}
+
+// EntriesOfKind returns every entry of the given kind across all posting dates, in key
+// order, e.g. to list every calendar event the bot has published.
+func (l *Ledger) EntriesOfKind(kind string) ([]*Entry, error) {
+	entries := make([]*Entry, 0)
+	infix := []byte("/" + kind + "/")
+	err := l.db.View(func(tx *bolt.Tx) error {
+		b, err := l.bucket(tx)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, data []byte) error {
+			if !bytes.Contains(k, infix) {
+				return nil
+			}
+			entry := &Entry{}
+			if err := json.Unmarshal(data, entry); err != nil {
+				return fmt.Errorf("entry %s: %w", k, err)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s ledger entries: %w", kind, err)
+	}
+	return entries, nil
+}
+
+// RecordDeleted marks the entry's event as deleted by the given NIP-09 deletion request.
+func (l *Ledger) RecordDeleted(apiEventID uint, date string, kind string, deletionEventID string) error {
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		b, err := l.bucket(tx)
+		if err != nil {
+			return err
+		}
+		data := b.Get(entryKey(date, kind, apiEventID))
+		if data == nil {
+			return errors.New("no signed event recorded")
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		entry.DeletionEventID = deletionEventID
+		entry.DeletedAt = &now
+		entry.UpdatedAt = now
+		return l.put(tx, &entry)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record deletion of event %d (%s, %s): %w", apiEventID, date, kind, err)
+	}
+	return nil
+}
+
+func (l *Ledger) put(tx *bolt.Tx, entry *Entry) error {
+	b, err := l.bucket(tx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return b.Put(entryKey(entry.Date, entry.Kind, entry.APIEventID), data)
+}
+
+// Queue is the list of events an interrupted run had not finished, saved so
+// the next start can resume from that point.
+type Queue struct {
+	Date    string            `json:"date"` // Posting date, YYYY-MM-DD
+	Events  []models.APIEvent `json:"events"`
+	SavedAt time.Time         `json:"savedAt"`
+}
+
+// SaveQueue persists the remaining events of the run for date, replacing any earlier queue.
+func (l *Ledger) SaveQueue(date string, events []models.APIEvent) error {
+	data, err := json.Marshal(Queue{Date: date, Events: events, SavedAt: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to encode remaining queue: %w", err)
+	}
+	err = l.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(queuesBucket).Put([]byte(l.pubkey), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save remaining queue: %w", err)
+	}
+	return nil
+}
+
+// LoadQueue returns the saved queue, or nil if the last run finished its work.
+func (l *Ledger) LoadQueue() (*Queue, error) {
+	var queue *Queue
+	err := l.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(queuesBucket).Get([]byte(l.pubkey))
+		if data == nil {
+			return nil
+		}
+		queue = &Queue{}
+		return json.Unmarshal(data, queue)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load remaining queue: %w", err)
+	}
+	return queue, nil
+}
+
+// ClearQueue removes the saved queue once its work is done.
+func (l *Ledger) ClearQueue() error {
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(queuesBucket).Delete([]byte(l.pubkey))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear remaining queue: %w", err)
+	}
+	return nil
+}
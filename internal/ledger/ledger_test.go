@@ -0,0 +1,217 @@
+package ledger
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"calendar-bot/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func openTestLedger(t *testing.T, pubkey string) *Ledger {
+	t.Helper()
+	l, err := Open(filepath.Join(t.TempDir(), "ledger.db"), pubkey)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestLedgerRecordAndGet(t *testing.T) {
+	const date, kind = "2026-01-03", "kind1"
+	tests := []struct {
+		name          string
+		signed        bool
+		relays        []string
+		wantEntry     bool
+		wantPublished bool
+		wantMissing   []string
+	}{
+		{name: "nothing recorded"},
+		{name: "signed, not sent", signed: true, wantEntry: true, wantMissing: []string{"wss://a", "wss://b"}},
+		{name: "accepted by one relay", signed: true, relays: []string{"wss://a"}, wantEntry: true, wantPublished: true, wantMissing: []string{"wss://b"}},
+		{name: "accepted by every relay", signed: true, relays: []string{"wss://a", "wss://b"}, wantEntry: true, wantPublished: true, wantMissing: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := openTestLedger(t, "pub")
+			ev := nostr.Event{ID: "abc", Kind: 1, Content: "hello"}
+			if tt.signed {
+				if _, err := l.RecordSigned(7, date, kind, ev); err != nil {
+					t.Fatalf("RecordSigned: %v", err)
+				}
+			}
+			for _, relay := range tt.relays {
+				if err := l.RecordRelay(7, date, kind, relay); err != nil {
+					t.Fatalf("RecordRelay: %v", err)
+				}
+			}
+
+			entry, err := l.Get(7, date, kind)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if (entry != nil) != tt.wantEntry {
+				t.Fatalf("Get returned entry %v, want entry: %v", entry, tt.wantEntry)
+			}
+			if entry == nil {
+				return
+			}
+			if entry.NostrEventID != "abc" || entry.Event.Content != "hello" {
+				t.Errorf("entry holds event %q %q, want the signed event", entry.NostrEventID, entry.Event.Content)
+			}
+			if got := entry.Published(); got != tt.wantPublished {
+				t.Errorf("Published() = %v, want %v", got, tt.wantPublished)
+			}
+			if got := entry.MissingRelays([]string{"wss://a", "wss://b"}); !slices.Equal(got, tt.wantMissing) {
+				t.Errorf("MissingRelays() = %v, want %v", got, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestLedgerKeys(t *testing.T) {
+	l := openTestLedger(t, "pub")
+	if _, err := l.RecordSigned(7, "2026-01-03", "kind1", nostr.Event{ID: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		apiEventID uint
+		date       string
+		kind       string
+	}{
+		{"other API event", 8, "2026-01-03", "kind1"},
+		{"other posting date", 7, "2027-01-03", "kind1"},
+		{"other kind", 7, "2026-01-03", "kind20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := l.Get(tt.apiEventID, tt.date, tt.kind)
+			if err != nil || entry != nil {
+				t.Errorf("Get = %v, %v; want nil, nil", entry, err)
+			}
+		})
+	}
+}
+
+func TestLedgerRecordSignedReplacesEntry(t *testing.T) {
+	l := openTestLedger(t, "pub")
+	if _, err := l.RecordSigned(7, "2026-01-03", "kind1", nostr.Event{ID: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.RecordRelay(7, "2026-01-03", "kind1", "wss://a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.RecordSigned(7, "2026-01-03", "kind1", nostr.Event{ID: "second"}); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := l.Get(7, "2026-01-03", "kind1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.NostrEventID != "second" || entry.Published() {
+		t.Errorf("got event %s published %v, want the new unpublished event", entry.NostrEventID, entry.Published())
+	}
+}
+
+func TestLedgerRecordRelayWithoutSignedEvent(t *testing.T) {
+	l := openTestLedger(t, "pub")
+	if err := l.RecordRelay(7, "2026-01-03", "kind1", "wss://a"); err == nil {
+		t.Error("RecordRelay succeeded without a signed event")
+	}
+}
+
+func TestLedgerScopesByPubkey(t *testing.T) {
+	l := openTestLedger(t, "pub1")
+	other, err := l.ForPubkey("pub2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.RecordSigned(7, "2026-01-03", "kind1", nostr.Event{ID: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := other.Get(7, "2026-01-03", "kind1"); err != nil || entry != nil {
+		t.Errorf("other pubkey sees entry %v, %v; want nil, nil", entry, err)
+	}
+}
+
+func TestLedgerQueue(t *testing.T) {
+	l := openTestLedger(t, "pub1")
+	other, err := l.ForPubkey("pub2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		save  map[*Ledger][]models.APIEvent
+		clear *Ledger
+		want  map[*Ledger][]uint // nil means no queue
+	}{
+		{
+			name: "no queue saved",
+			want: map[*Ledger][]uint{l: nil, other: nil},
+		},
+		{
+			name: "queue of one pubkey",
+			save: map[*Ledger][]models.APIEvent{l: {{ID: 1}, {ID: 2}}},
+			want: map[*Ledger][]uint{l: {1, 2}, other: nil},
+		},
+		{
+			name: "queues of both pubkeys",
+			save: map[*Ledger][]models.APIEvent{l: {{ID: 1}}, other: {{ID: 3}}},
+			want: map[*Ledger][]uint{l: {1}, other: {3}},
+		},
+		{
+			name:  "cleared queue of one pubkey",
+			save:  map[*Ledger][]models.APIEvent{l: {{ID: 1}}, other: {{ID: 3}}},
+			clear: l,
+			want:  map[*Ledger][]uint{l: nil, other: {3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, ledger := range []*Ledger{l, other} {
+				if err := ledger.ClearQueue(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for ledger, events := range tt.save {
+				if err := ledger.SaveQueue("2026-01-03", events); err != nil {
+					t.Fatalf("SaveQueue: %v", err)
+				}
+			}
+			if tt.clear != nil {
+				if err := tt.clear.ClearQueue(); err != nil {
+					t.Fatalf("ClearQueue: %v", err)
+				}
+			}
+			for ledger, wantIDs := range tt.want {
+				queue, err := ledger.LoadQueue()
+				if err != nil {
+					t.Fatalf("LoadQueue(%s): %v", ledger.pubkey, err)
+				}
+				if wantIDs == nil {
+					if queue != nil {
+						t.Errorf("LoadQueue(%s) = %v, want no queue", ledger.pubkey, queue)
+					}
+					continue
+				}
+				if queue == nil {
+					t.Fatalf("LoadQueue(%s) = nil, want events %v", ledger.pubkey, wantIDs)
+				}
+				var ids []uint
+				for _, ev := range queue.Events {
+					ids = append(ids, ev.ID)
+				}
+				if queue.Date != "2026-01-03" || !slices.Equal(ids, wantIDs) {
+					t.Errorf("LoadQueue(%s) = %s %v, want 2026-01-03 %v", ledger.pubkey, queue.Date, ids, wantIDs)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Registers the decoders image.Decode uses
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"time"
+
+	_ "golang.org/x/image/webp"
+)
+
+// DefaultMaxBytes is the default limit on the size of a downloaded image.
+const DefaultMaxBytes = 10 << 20
+
+// Download timeouts. Whether the longer video timeout applies is decided by the first
+// bytes, so a slow image host is given up on as early as before videos were supported.
+const (
+	imageTimeout = 30 * time.Second
+	videoTimeout = 5 * time.Minute
+)
+
+// maxPixels bounds the images that are decoded for their blurhash, so a small file
+// declaring huge dimensions cannot exhaust memory.
+const maxPixels = 50_000_000
+
+var (
+	// ErrTooLarge is returned for media larger than the Fetcher's limit.
+	ErrTooLarge = errors.New("media exceeds the size limit")
+	// ErrUnsupportedType is returned for content that is not an image format the bot posts.
+	ErrUnsupportedType = errors.New("unsupported media type")
+	// ErrUndecodable is returned for images and videos whose content does not match their format.
+	ErrUndecodable = errors.New("undecodable media")
+	// ErrVideo is returned when media inspected as an image is a video.
+	ErrVideo = errors.New("media is a video")
+)
+
+// Reason returns a short label for why media was rejected, e.g. for metrics:
+// "too_large", "unsupported_type", "undecodable" or "download_failed".
+func Reason(err error) string {
+	switch {
+	case errors.Is(err, ErrTooLarge):
+		return "too_large"
+	case errors.Is(err, ErrUnsupportedType):
+		return "unsupported_type"
+	case errors.Is(err, ErrUndecodable):
+		return "undecodable"
+	default:
+		return "download_failed"
+	}
+}
+
+// Image is what the bot knows about an image after downloading and inspecting it.
+type Image struct {
+	URL       string
+	MediaType string   // Sniffed from the content, e.g. "image/png"
+	SHA256    string   // Hex SHA-256 of the downloaded bytes
+	Size      int64    // In bytes
+	Width     int      // 0 if the format cannot be decoded (AVIF)
+	Height    int      // 0 if the format cannot be decoded (AVIF)
+	Blurhash  string   // Empty if the format cannot be decoded (AVIF)
+	Extra     []string // Further imeta fields, "<key> <value>", e.g. from a media server
+}
+
+// Dim returns the dimensions as "<width>x<height>", or "" if they are unknown.
+func (img Image) Dim() string {
+	if img.Width == 0 || img.Height == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", img.Width, img.Height)
+}
+
+// Fetcher downloads media with a size limit.
+type Fetcher struct {
+	client        *http.Client
+	maxBytes      int64
+	maxVideoBytes int64
+}
+
+// NewFetcher creates a Fetcher that refuses videos larger than maxVideoBytes and any
+// other media larger than maxBytes. Images must download within 30 seconds, videos
+// within 5 minutes.
+func NewFetcher(maxBytes int64, maxVideoBytes int64) *Fetcher {
+	return &Fetcher{
+		client:        &http.Client{}, // Timeouts are per download, see download
+		maxBytes:      maxBytes,
+		maxVideoBytes: maxVideoBytes,
+	}
+}
+
+// Download returns the body served at mediaURL. The first bytes decide whether the
+// video or the image limit applies; bodies larger than it are refused without reading
+// them to the end.
+func (f *Fetcher) Download(ctx context.Context, mediaURL string) ([]byte, error) {
+	data, _, err := f.download(ctx, mediaURL)
+	return data, err
+}
+
+// download is Download, also reporting whether the first bytes are a video's, even if
+// the download failed after them. It is given up on after imageTimeout, or videoTimeout
+// once the first bytes turn out to be a video's.
+func (f *Fetcher) download(ctx context.Context, mediaURL string) (data []byte, isVideo bool, err error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	imageTimer := time.AfterFunc(imageTimeout, func() { cancel(fmt.Errorf("timed out after %v", imageTimeout)) })
+	defer imageTimer.Stop()
+	videoTimer := time.AfterFunc(videoTimeout, func() { cancel(fmt.Errorf("video timed out after %v", videoTimeout)) })
+	defer videoTimer.Stop()
+	failed := func(err error) error {
+		if cause := context.Cause(ctx); cause != nil && cause != ctx.Err() {
+			err = cause // One of the timeouts, not the caller's cancellation
+		}
+		return fmt.Errorf("failed to download %s: %w", mediaURL, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mediaURL, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create request for %s: %w", mediaURL, err)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, false, failed(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("%s returned status %d", mediaURL, resp.StatusCode)
+	}
+	if resp.ContentLength > max(f.maxBytes, f.maxVideoBytes) {
+		return nil, false, fmt.Errorf("%s is %d bytes: %w of %d bytes", mediaURL, resp.ContentLength, ErrTooLarge, max(f.maxBytes, f.maxVideoBytes))
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(resp.Body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, false, failed(err)
+	}
+	limit := f.maxBytes
+	if isVideo = SniffVideoType(head[:n]) != ""; isVideo {
+		limit = f.maxVideoBytes
+		imageTimer.Stop()
+	}
+	if resp.ContentLength > limit {
+		return nil, isVideo, fmt.Errorf("%s is %d bytes: %w of %d bytes", mediaURL, resp.ContentLength, ErrTooLarge, limit)
+	}
+	rest, err := io.ReadAll(io.LimitReader(resp.Body, max(0, limit+1-int64(n))))
+	if err != nil {
+		return nil, isVideo, failed(err)
+	}
+	data = append(head[:n], rest...)
+	if int64(len(data)) > limit {
+		return nil, isVideo, fmt.Errorf("%s: %w of %d bytes", mediaURL, ErrTooLarge, limit)
+	}
+	return data, isVideo, nil
+}
+
+// FetchMedia downloads the media at mediaURL and inspects it as a video if its bytes
+// are in a video format, and as an image otherwise. isVideo tells which it is, also for
+// videos over the size limit.
+func (f *Fetcher) FetchMedia(ctx context.Context, mediaURL string) (img Image, video Video, isVideo bool, err error) {
+	data, isVideo, err := f.download(ctx, mediaURL)
+	if err != nil {
+		return Image{}, Video{}, isVideo, err
+	}
+	if isVideo {
+		video, err = InspectVideo(mediaURL, data)
+		return Image{}, video, true, err
+	}
+	img, err = InspectImage(mediaURL, data)
+	return img, Video{}, false, err
+}
+
+// InspectImage sniffs the format of the image bytes downloaded from imageURL and
+// returns their hash, size, dimensions and blurhash. The file extension and the
+// Content-Type the server claimed are ignored: only the bytes count.
+func InspectImage(imageURL string, data []byte) (Image, error) {
+	mediaType := SniffImageType(data)
+	if mediaType == "" {
+		return Image{}, fmt.Errorf("%s: %w %s", imageURL, ErrUnsupportedType, http.DetectContentType(data))
+	}
+	hash := sha256.Sum256(data)
+	img := Image{
+		URL:       imageURL,
+		MediaType: mediaType,
+		SHA256:    hex.EncodeToString(hash[:]),
+		Size:      int64(len(data)),
+	}
+	if mediaType == "image/avif" {
+		return img, nil // No AVIF decoder; posted without dimensions and blurhash
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, fmt.Errorf("%s: %w: %s header: %w", imageURL, ErrUndecodable, mediaType, err)
+	}
+	if config.Width*config.Height > maxPixels {
+		return Image{}, fmt.Errorf("%s is %dx%d pixels: %w of %d pixels", imageURL, config.Width, config.Height, ErrTooLarge, maxPixels)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, fmt.Errorf("%s: %w: %s: %w", imageURL, ErrUndecodable, mediaType, err)
+	}
+	img.Width, img.Height = config.Width, config.Height
+	img.Blurhash = Blurhash(decoded, 4, 3)
+	return img, nil
+}
+
+// SniffImageType returns the media type of the image format the bytes are in, or "" if
+// they are not in a format the bot posts: JPEG, PNG (including APNG), GIF, WebP or AVIF.
+func SniffImageType(data []byte) string {
+	// net/http sniffs everything but AVIF, an ISO BMFF file with an "avif" or "avis" brand
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		if brand := string(data[8:12]); brand == "avif" || brand == "avis" {
+			return "image/avif"
+		}
+	}
+	switch mediaType := http.DetectContentType(data); mediaType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return mediaType
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,311 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Formats processed images are encoded in.
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png" // Images with transparency, which JPEG has none of
+)
+
+// maxSide is the longest side processed images and thumbnails may be given.
+const maxSide = 1 << 14
+
+// thumbQuality is the JPEG quality of thumbnails.
+const thumbQuality = 80
+
+// ProcessOptions are the limits processed images are made to fit.
+type ProcessOptions struct {
+	MaxWidth  int // Larger images are scaled down to fit MaxWidth x MaxHeight, keeping their aspect ratio
+	MaxHeight int
+	MaxBytes  int64 // Largest processed image; quality and then size are lowered to fit
+	Quality   int   // JPEG quality, 1 to 100
+	ThumbSize int   // Longest side of the thumbnail, 0 for none
+}
+
+// DefaultProcessOptions returns the options used for the settings a configuration leaves out.
+func DefaultProcessOptions() ProcessOptions {
+	return ProcessOptions{
+		MaxWidth:  2048,
+		MaxHeight: 2048,
+		MaxBytes:  2 << 20,
+		Quality:   85,
+		ThumbSize: 320,
+	}
+}
+
+// Validate checks the options.
+func (o ProcessOptions) Validate() error {
+	var errs []error
+	if o.MaxWidth < 16 || o.MaxHeight < 16 || o.MaxWidth > maxSide || o.MaxHeight > maxSide {
+		errs = append(errs, fmt.Errorf("maximum dimensions %dx%d are out of range. Must be 16 to %d pixels", o.MaxWidth, o.MaxHeight, maxSide))
+	}
+	if o.MaxBytes <= 0 {
+		errs = append(errs, fmt.Errorf("maximum size must be positive"))
+	}
+	if o.Quality < 1 || o.Quality > 100 {
+		errs = append(errs, fmt.Errorf("quality %d is out of range. Must be 1 to 100", o.Quality))
+	}
+	if o.ThumbSize != 0 && (o.ThumbSize < 16 || o.ThumbSize > maxSide) {
+		errs = append(errs, fmt.Errorf("thumbnail size %d is out of range. Must be 0 or 16 to %d pixels", o.ThumbSize, maxSide))
+	}
+	return errors.Join(errs...)
+}
+
+// Variant names the options, so copies made with other options are told apart.
+func (o ProcessOptions) Variant() string {
+	return fmt.Sprintf("jpeg-q%d-%dx%d-%db-thumb%d", o.Quality, o.MaxWidth, o.MaxHeight, o.MaxBytes, o.ThumbSize)
+}
+
+// Processed is an image made fit for posting, in every variant the imeta tag links.
+type Processed struct {
+	Image   []byte // JPEG, or PNG if the image has transparency; within the options' limits, without metadata
+	Preview []byte // JPEG of a PNG Image at the same dimensions, for imeta "image"; nil for a JPEG Image or if larger than MaxBytes
+	Thumb   []byte // JPEG of at most ThumbSize pixels on its longest side, nil if off
+}
+
+// Processor re-encodes downloaded images: it turns them upright, scales them down to the
+// maximum dimensions and encodes them afresh, which drops EXIF (including GPS
+// positions), XMP and other metadata.
+type Processor struct {
+	options ProcessOptions
+}
+
+// NewProcessor creates a Processor with the given options, which must be valid.
+func NewProcessor(options ProcessOptions) *Processor {
+	return &Processor{options: options}
+}
+
+// Options returns the processor's options.
+func (p *Processor) Options() ProcessOptions {
+	return p.options
+}
+
+// Processable reports whether images of the media type can be processed. Animated GIFs
+// would lose their animation and AVIF cannot be decoded, so those are posted as they are.
+func Processable(mediaType string) bool {
+	return mediaType == "image/jpeg" || mediaType == "image/png" || mediaType == "image/webp"
+}
+
+// Process decodes the image and returns its processed variants.
+func (p *Processor) Process(data []byte) (Processed, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Processed{}, fmt.Errorf("%w: %w", ErrUndecodable, err)
+	}
+	if config.Width*config.Height > maxPixels {
+		return Processed{}, fmt.Errorf("image is %dx%d pixels: %w of %d pixels", config.Width, config.Height, ErrTooLarge, maxPixels)
+	}
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Processed{}, fmt.Errorf("%w: %w", ErrUndecodable, err)
+	}
+	if format == "jpeg" {
+		src = orient(src, jpegOrientation(data))
+	}
+
+	mainFormat := FormatJPEG
+	if !opaque(src) {
+		mainFormat = FormatPNG // JPEG has no transparency
+	}
+
+	// Scale down until the image fits MaxBytes: JPEG first trades quality for size, down
+	// to 50, before the dimensions shrink by a fifth per attempt.
+	width, height := fit(src.Bounds().Dx(), src.Bounds().Dy(), p.options.MaxWidth, p.options.MaxHeight)
+	quality := p.options.Quality
+	for attempt := 0; ; attempt++ {
+		scaled := scale(src, width, height)
+		main, err := encode(scaled, mainFormat, quality)
+		if err != nil {
+			return Processed{}, err
+		}
+		if int64(len(main)) > p.options.MaxBytes {
+			if attempt == 20 || width <= 16 || height <= 16 {
+				return Processed{}, fmt.Errorf("processed image is %d bytes: %w of %d bytes", len(main), ErrTooLarge, p.options.MaxBytes)
+			}
+			if mainFormat == FormatJPEG && quality > 50 {
+				quality = max(50, quality-10)
+			} else {
+				width, height = max(16, width*4/5), max(16, height*4/5)
+			}
+			continue
+		}
+
+		processed := Processed{Image: main}
+		if mainFormat == FormatPNG {
+			if processed.Preview, err = encode(scaled, FormatJPEG, quality); err != nil {
+				return Processed{}, err
+			}
+			if int64(len(processed.Preview)) > p.options.MaxBytes {
+				processed.Preview = nil
+			}
+		}
+		if p.options.ThumbSize > 0 {
+			thumbWidth, thumbHeight := fit(width, height, p.options.ThumbSize, p.options.ThumbSize)
+			if processed.Thumb, err = encode(scale(scaled, thumbWidth, thumbHeight), FormatJPEG, thumbQuality); err != nil {
+				return Processed{}, err
+			}
+		}
+		return processed, nil
+	}
+}
+
+// fit returns the largest dimensions within maxWidth x maxHeight with the aspect ratio
+// of width x height, or width x height if they already fit.
+func fit(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= maxWidth && height <= maxHeight {
+		return width, height
+	}
+	if width*maxHeight > height*maxWidth {
+		return maxWidth, max(1, height*maxWidth/width)
+	}
+	return max(1, width*maxHeight/height), maxHeight
+}
+
+// scale returns img resized to width x height, or img itself if it has that size.
+func scale(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() == width && bounds.Dy() == height {
+		return img
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+func encode(img image.Image, format string, quality int) ([]byte, error) {
+	var out bytes.Buffer
+	var err error
+	if format == FormatPNG {
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&out, img)
+	} else {
+		if !opaque(img) {
+			img = flatten(img)
+		}
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", format, err)
+	}
+	return out.Bytes(), nil
+}
+
+// opaque reports whether every pixel of img is fully opaque.
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return true // Formats without an alpha channel
+}
+
+// flatten draws img over a white background, for formats without transparency.
+func flatten(img image.Image) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+	return dst
+}
+
+// orient returns img turned the way its EXIF orientation (1-8) says it is displayed,
+// since the re-encoded image has no EXIF to say so.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	transposed := orientation >= 5 // Orientations 5-8 swap width and height
+	dw, dh := w, h
+	if transposed {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // Rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // Mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // Rotated 90° clockwise to display
+				dx, dy = h-1-y, x
+			case 7: // Mirrored along the top-right diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotated 90° counter-clockwise to display
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG file, or 1 (upright) if it has none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xda || length < 2 || i+2+length > len(data) {
+			return 1 // Image data starts; metadata comes before it
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xe1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag (0x0112) of the first IFD of a TIFF header.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := range entries {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
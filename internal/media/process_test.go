@@ -0,0 +1,233 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// exifSegment returns an APP1 segment whose first IFD holds an orientation tag, preceded
+// by another tag so the orientation is not the first entry.
+func exifSegment(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+2*12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 2)
+	order.PutUint16(tiff[10:], 0x010f) // Make
+	order.PutUint16(tiff[22:], 0x0112) // Orientation
+	order.PutUint16(tiff[24:], 3)      // SHORT
+	order.PutUint32(tiff[26:], 1)
+	order.PutUint16(tiff[30:], orientation)
+	return segment(0xe1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+func segment(marker byte, payload []byte) []byte {
+	seg := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// testJPEG returns a JPEG file with the given segments inserted after its start marker.
+func testJPEG(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte{0xff, 0xd8}
+	for _, seg := range segments {
+		data = append(data, seg...)
+	}
+	return append(data, buf.Bytes()[2:]...)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	rotated := exifSegment(binary.LittleEndian, 6)
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no EXIF", testJPEG(t), 1},
+		{"little-endian EXIF", testJPEG(t, rotated), 6},
+		{"big-endian EXIF", testJPEG(t, exifSegment(binary.BigEndian, 8)), 8},
+		{"EXIF after JFIF", testJPEG(t, segment(0xe0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")), rotated), 6},
+		{"XMP instead of EXIF", testJPEG(t, segment(0xe1, []byte("http://ns.adobe.com/xap/1.0/\x00"))), 1},
+		{"truncated EXIF segment", testJPEG(t, segment(0xe1, rotated[4:30])), 1},
+		{"segment longer than the file", append([]byte{0xff, 0xd8}, rotated[:len(rotated)-4]...), 1},
+		{"segment length below 2", append([]byte{0xff, 0xd8, 0xff, 0xe1, 0, 1}, rotated...), 1},
+		{"not a JPEG", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"empty", nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("jpegOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEXIFOrientation(t *testing.T) {
+	tiff := exifSegment(binary.BigEndian, 3)[10:] // Without the marker, length and "Exif\0\0"
+	withOffset := func(offset uint32) []byte {
+		data := bytes.Clone(tiff)
+		binary.BigEndian.PutUint32(data[4:], offset)
+		return data
+	}
+	withEntries := func(entries uint16) []byte {
+		data := bytes.Clone(tiff)
+		binary.BigEndian.PutUint16(data[8:], entries)
+		return data
+	}
+	tests := []struct {
+		name string
+		tiff []byte
+		want int
+	}{
+		{"orientation", tiff, 3},
+		{"unknown byte order", append([]byte("XX"), tiff[2:]...), 1},
+		{"shorter than the header", tiff[:7], 1},
+		{"IFD inside the header", withOffset(4), 1},
+		{"IFD past the end", withOffset(uint32(len(tiff))), 1},
+		{"entries past the end", withEntries(200), 3},
+		{"entry cut short", tiff[:len(tiff)-10], 1},
+		{"no orientation entry", withEntries(1), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exifOrientation(tt.tiff); got != tt.want {
+				t.Errorf("exifOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		width, height, maxWidth, maxHeight int
+		wantWidth, wantHeight              int
+	}{
+		{800, 600, 1024, 1024, 800, 600},
+		{1024, 1024, 1024, 1024, 1024, 1024},
+		{4000, 3000, 1024, 1024, 1024, 768},
+		{3000, 4000, 1024, 1024, 768, 1024},
+		{2000, 1000, 1000, 1000, 1000, 500},
+		{1000, 2000, 1000, 500, 250, 500},
+		{1600, 900, 800, 800, 800, 450},
+		{100000, 10, 1000, 1000, 1000, 1},
+		{10, 100000, 1000, 1000, 1, 1000},
+	}
+	for _, tt := range tests {
+		w, h := fit(tt.width, tt.height, tt.maxWidth, tt.maxHeight)
+		if w != tt.wantWidth || h != tt.wantHeight {
+			t.Errorf("fit(%d, %d, %d, %d) = %dx%d, want %dx%d", tt.width, tt.height, tt.maxWidth, tt.maxHeight, w, h, tt.wantWidth, tt.wantHeight)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3x2 image with a red top-left pixel, displayed 2x3 or 3x2 after turning
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	red := color.NRGBA{R: 0xff, A: 0xff}
+	src.Set(0, 0, red)
+	tests := []struct {
+		orientation int
+		size        image.Point
+		red         image.Point
+	}{
+		{1, image.Pt(3, 2), image.Pt(0, 0)},
+		{2, image.Pt(3, 2), image.Pt(2, 0)},
+		{3, image.Pt(3, 2), image.Pt(2, 1)},
+		{4, image.Pt(3, 2), image.Pt(0, 1)},
+		{5, image.Pt(2, 3), image.Pt(0, 0)},
+		{6, image.Pt(2, 3), image.Pt(1, 0)},
+		{7, image.Pt(2, 3), image.Pt(1, 2)},
+		{8, image.Pt(2, 3), image.Pt(0, 2)},
+		{9, image.Pt(3, 2), image.Pt(0, 0)},
+	}
+	for _, tt := range tests {
+		img := orient(src, tt.orientation)
+		if size := img.Bounds().Size(); size != tt.size {
+			t.Errorf("orientation %d: size %v, want %v", tt.orientation, size, tt.size)
+			continue
+		}
+		if got := color.NRGBAModel.Convert(img.At(tt.red.X, tt.red.Y)); got != red {
+			t.Errorf("orientation %d: pixel %v is %v, want red", tt.orientation, tt.red, got)
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	encodePNG := func(img image.Image) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	photo := image.NewNRGBA(image.Rect(0, 0, 600, 400))
+	transparent := image.NewNRGBA(image.Rect(0, 0, 600, 400))
+	for y := range 400 {
+		for x := range 600 {
+			photo.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x ^ y), A: 0xff})
+			transparent.SetNRGBA(x, y, color.NRGBA{R: 0xff, A: uint8(x * y)})
+		}
+	}
+	var rotatedJPEG bytes.Buffer
+	if err := jpeg.Encode(&rotatedJPEG, image.NewGray(image.Rect(0, 0, 60, 40)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultProcessOptions()
+	options.MaxWidth, options.MaxHeight, options.ThumbSize = 300, 300, 100
+	tests := []struct {
+		name        string
+		data        []byte
+		wantType    string
+		wantDim     string
+		wantPreview bool
+		wantThumb   string
+	}{
+		{"opaque PNG becomes JPEG", encodePNG(photo), "image/jpeg", "300x200", false, "100x66"},
+		{"transparent PNG stays PNG with a JPEG copy", encodePNG(transparent), "image/png", "300x200", true, "100x66"},
+		{"JPEG turned upright", append(append([]byte{0xff, 0xd8}, exifSegment(binary.BigEndian, 6)...), rotatedJPEG.Bytes()[2:]...), "image/jpeg", "40x60", false, "40x60"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processed, err := NewProcessor(options).Process(tt.data)
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			img, err := InspectImage("", processed.Image)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.MediaType != tt.wantType || img.Dim() != tt.wantDim {
+				t.Errorf("image is %s %s, want %s %s", img.MediaType, img.Dim(), tt.wantType, tt.wantDim)
+			}
+			if (processed.Preview != nil) != tt.wantPreview {
+				t.Errorf("preview present: %v, want %v", processed.Preview != nil, tt.wantPreview)
+			}
+			if processed.Preview != nil {
+				preview, err := InspectImage("", processed.Preview)
+				if err != nil || preview.MediaType != "image/jpeg" || preview.Dim() != tt.wantDim {
+					t.Errorf("preview is %s %s (%v), want image/jpeg %s", preview.MediaType, preview.Dim(), err, tt.wantDim)
+				}
+			}
+			thumb, err := InspectImage("", processed.Thumb)
+			if err != nil || thumb.MediaType != "image/jpeg" || thumb.Dim() != tt.wantThumb {
+				t.Errorf("thumbnail is %s %s (%v), want image/jpeg %s", thumb.MediaType, thumb.Dim(), err, tt.wantThumb)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package media
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Store keeps copies of the posted images on a media server, so posts do not depend on
+// the hosts the images came from.
+type Store interface {
+	// Server returns the server's base URL, which identifies it in logs and caches.
+	Server() string
+	// Store copies img, downloaded and inspected from img.URL, to the server. download
+	// returns the image's bytes for servers that cannot fetch img.URL themselves.
+	Store(ctx context.Context, img Image, download func(ctx context.Context) ([]byte, error)) (Stored, error)
+}
+
+// Stored is an image's copy on a media server.
+type Stored struct {
+	URL string
+	// Fields are imeta fields describing the copy, "<key> <value>" like NIP-94 tags, e.g.
+	// "x <hash>" and "dim 800x600" of an image the server converted, or "thumb <url>".
+	// They replace the original's values. Empty if the copy is identical to the original.
+	Fields []string
+}
+
+// Apply returns the description of the image's copy: the image with the copy's URL and
+// the fields the server reported.
+func (img Image) Apply(stored Stored) Image {
+	img.URL = stored.URL
+	img.Extra = append([]string(nil), img.Extra...)
+	for _, field := range stored.Fields {
+		key, value, ok := strings.Cut(field, " ")
+		if !ok || value == "" {
+			continue
+		}
+		switch key {
+		case "url":
+			// The copy's URL is stored.URL
+		case "m":
+			img.MediaType = value
+		case "x":
+			img.SHA256 = value
+		case "size":
+			if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+				img.Size = size
+			}
+		case "dim":
+			width, height, _ := strings.Cut(value, "x")
+			w, errW := strconv.Atoi(width)
+			h, errH := strconv.Atoi(height)
+			if errW == nil && errH == nil {
+				img.Width, img.Height = w, h
+			}
+		case "blurhash":
+			img.Blurhash = value
+		default:
+			img.Extra = append(img.Extra, field)
+		}
+	}
+	return img
+}
@@ -0,0 +1,405 @@
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+)
+
+// DefaultMaxVideoBytes is the default limit on the size of a downloaded video.
+const DefaultMaxVideoBytes = 100 << 20
+
+// sniffLen is how much of a download is read before its format decides the size limit.
+const sniffLen = 512
+
+// Video is what the bot knows about a video after downloading and inspecting it.
+type Video struct {
+	URL       string
+	MediaType string        // Sniffed from the content: "video/mp4", "video/quicktime" or "video/webm"
+	SHA256    string        // Hex SHA-256 of the downloaded bytes
+	Size      int64         // In bytes
+	Width     int           // As displayed, after the track's rotation; 0 if unknown
+	Height    int           // As displayed, after the track's rotation; 0 if unknown
+	Duration  time.Duration // 0 if the file does not say
+}
+
+// Dim returns the dimensions as "<width>x<height>", or "" if they are unknown.
+func (v Video) Dim() string {
+	if v.Width == 0 || v.Height == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", v.Width, v.Height)
+}
+
+// Portrait reports whether the video is taller than it is wide.
+func (v Video) Portrait() bool {
+	return v.Height > v.Width
+}
+
+// InspectVideo parses the container of the video bytes downloaded from videoURL and
+// returns their hash, size, dimensions and duration. Like images, videos are recognized
+// by their bytes only.
+func InspectVideo(videoURL string, data []byte) (Video, error) {
+	mediaType := SniffVideoType(data)
+	if mediaType == "" {
+		return Video{}, fmt.Errorf("%s: %w: not an MP4, QuickTime or WebM video", videoURL, ErrUnsupportedType)
+	}
+	hash := sha256.Sum256(data)
+	video := Video{
+		URL:       videoURL,
+		MediaType: mediaType,
+		SHA256:    hex.EncodeToString(hash[:]),
+		Size:      int64(len(data)),
+	}
+	var err error
+	if mediaType == "video/webm" {
+		err = parseWebM(data, &video)
+	} else {
+		err = parseMP4(data, &video)
+	}
+	if err != nil {
+		return Video{}, fmt.Errorf("%s: %w: %s: %w", videoURL, ErrUndecodable, mediaType, err)
+	}
+	if video.Width == 0 || video.Height == 0 {
+		return Video{}, fmt.Errorf("%s: %w: %s has no video track", videoURL, ErrUndecodable, mediaType)
+	}
+	return video, nil
+}
+
+// SniffVideoType returns the media type of the video format the bytes are in, or "" if
+// they are not in a format the bot posts: MP4, QuickTime (MOV) or WebM. The first
+// sniffLen bytes are enough.
+func SniffVideoType(data []byte) string {
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		switch brand := string(data[8:12]); brand {
+		case "avif", "avis", "heic", "heix", "mif1", "msf1":
+			return "" // Image formats in the same container
+		case "qt  ":
+			return "video/quicktime"
+		default:
+			return "video/mp4"
+		}
+	}
+	if len(data) >= 8 {
+		// Old QuickTime files start with a movie or media box instead of "ftyp"
+		switch string(data[4:8]) {
+		case "moov", "mdat", "wide", "free", "skip", "pnot":
+			return "video/quicktime"
+		}
+	}
+	if bytes.HasPrefix(data, []byte{0x1a, 0x45, 0xdf, 0xa3}) && webmDocType(data) == "webm" {
+		return "video/webm" // Other Matroska files are not WebM
+	}
+	return ""
+}
+
+// --- MP4 and QuickTime ---
+
+// mp4Box is one box (atom) of an ISO BMFF file: its type and content.
+type mp4Box struct {
+	kind    string
+	content []byte
+}
+
+// mp4Boxes splits data into the boxes it consists of.
+func mp4Boxes(data []byte) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("truncated box header")
+		}
+		size, header := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+		switch size {
+		case 0: // Up to the end of the file
+			size = uint64(len(data))
+		case 1: // 64-bit size after the type
+			if len(data) < 16 {
+				return nil, fmt.Errorf("truncated box header")
+			}
+			size, header = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < header || size > uint64(len(data)) {
+			if string(data[4:8]) == "mdat" {
+				break // A cut-off media data box only holds samples
+			}
+			return nil, fmt.Errorf("box %q of %d bytes exceeds its container", data[4:8], size)
+		}
+		boxes = append(boxes, mp4Box{kind: string(data[4:8]), content: data[header:size]})
+		data = data[size:]
+	}
+	return boxes, nil
+}
+
+// mp4Child returns the first box of the given type among boxes, or nil.
+func mp4Child(boxes []mp4Box, kind string) []byte {
+	for _, box := range boxes {
+		if box.kind == kind {
+			return box.content
+		}
+	}
+	return nil
+}
+
+// parseMP4 reads the duration from the movie header and the displayed dimensions from
+// the header of the first video track.
+func parseMP4(data []byte, video *Video) error {
+	top, err := mp4Boxes(data)
+	if err != nil {
+		return err
+	}
+	moov := mp4Child(top, "moov")
+	if moov == nil {
+		return fmt.Errorf("no movie box")
+	}
+	movie, err := mp4Boxes(moov)
+	if err != nil {
+		return err
+	}
+
+	var timescale uint32
+	if mvhd := mp4Child(movie, "mvhd"); len(mvhd) >= 20 {
+		var duration uint64
+		if mvhd[0] == 1 && len(mvhd) >= 32 {
+			timescale, duration = binary.BigEndian.Uint32(mvhd[20:]), binary.BigEndian.Uint64(mvhd[24:])
+		} else if mvhd[0] == 0 {
+			timescale, duration = binary.BigEndian.Uint32(mvhd[12:]), uint64(binary.BigEndian.Uint32(mvhd[16:]))
+		}
+		if duration == 0 || duration == math.MaxUint32 || duration == math.MaxUint64 {
+			duration = mp4FragmentDuration(movie) // Fragmented files leave it to mvex
+		}
+		if timescale > 0 {
+			video.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+		}
+	}
+
+	for _, trak := range movie {
+		if trak.kind != "trak" {
+			continue
+		}
+		track, err := mp4Boxes(trak.content)
+		if err != nil {
+			return err
+		}
+		if !mp4IsVideoTrack(track) {
+			continue
+		}
+		tkhd := mp4Child(track, "tkhd")
+		offset := 4 + 20 // Version and flags, then the version 0 times, ID and duration
+		if len(tkhd) > 0 && tkhd[0] == 1 {
+			offset = 4 + 32
+		}
+		if len(tkhd) < offset+52+8 {
+			return fmt.Errorf("truncated track header")
+		}
+		matrix := tkhd[offset+16:]
+		width := int(binary.BigEndian.Uint32(tkhd[offset+52:]) >> 16) // 16.16 fixed point
+		height := int(binary.BigEndian.Uint32(tkhd[offset+56:]) >> 16)
+		if a, d := binary.BigEndian.Uint32(matrix), binary.BigEndian.Uint32(matrix[16:]); a == 0 && d == 0 {
+			width, height = height, width // Rotated by 90 or 270 degrees, as phones record portrait video
+		}
+		video.Width, video.Height = width, height
+		return nil
+	}
+	return nil
+}
+
+// mp4IsVideoTrack reports whether the track's media handler is "vide".
+func mp4IsVideoTrack(track []mp4Box) bool {
+	mdia, err := mp4Boxes(mp4Child(track, "mdia"))
+	if err != nil {
+		return false
+	}
+	hdlr := mp4Child(mdia, "hdlr")
+	return len(hdlr) >= 12 && string(hdlr[8:12]) == "vide"
+}
+
+// mp4FragmentDuration returns the duration of a fragmented file from its movie extends
+// header, in the movie's timescale, or 0.
+func mp4FragmentDuration(movie []mp4Box) uint64 {
+	mvex, err := mp4Boxes(mp4Child(movie, "mvex"))
+	if err != nil {
+		return 0
+	}
+	mehd := mp4Child(mvex, "mehd")
+	switch {
+	case len(mehd) >= 12 && mehd[0] == 1:
+		return binary.BigEndian.Uint64(mehd[4:])
+	case len(mehd) >= 8:
+		return uint64(binary.BigEndian.Uint32(mehd[4:]))
+	default:
+		return 0
+	}
+}
+
+// --- WebM ---
+
+// EBML element IDs of the WebM elements the bot reads.
+const (
+	ebmlHeader        = 0x1a45dfa3
+	ebmlDocType       = 0x4282
+	ebmlSegment       = 0x18538067
+	ebmlInfo          = 0x1549a966
+	ebmlTimecodeScale = 0x2ad7b1
+	ebmlDuration      = 0x4489
+	ebmlTracks        = 0x1654ae6b
+	ebmlTrackEntry    = 0xae
+	ebmlTrackType     = 0x83
+	ebmlVideo         = 0xe0
+	ebmlPixelWidth    = 0xb0
+	ebmlPixelHeight   = 0xba
+	ebmlCluster       = 0x1f43b675
+)
+
+// ebmlElement is one EBML element: its ID and content. Elements of unknown size, as
+// written by live encoders, reach to the end of their parent.
+type ebmlElement struct {
+	id      uint64
+	content []byte
+}
+
+// ebmlVint reads a variable-length integer. The length marker bit is kept for IDs and
+// removed for sizes; all value bits set means an unknown size.
+func ebmlVint(data []byte, keepMarker bool) (value uint64, length int, unknown bool, err error) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0, false, fmt.Errorf("invalid variable-length integer")
+	}
+	length = 1
+	for mask := byte(0x80); data[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > len(data) {
+		return 0, 0, false, fmt.Errorf("truncated variable-length integer")
+	}
+	value = uint64(data[0])
+	if !keepMarker {
+		value &= uint64(0xff) >> length
+	}
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+	}
+	return value, length, !keepMarker && value == 1<<(7*length)-1, nil
+}
+
+// ebmlElements splits data into the elements it consists of, stopping at the first
+// element of the stop ID, whose content is not needed. On error, the elements before
+// the broken one are returned with it.
+func ebmlElements(data []byte, stop uint64) ([]ebmlElement, error) {
+	var elements []ebmlElement
+	for len(data) > 0 {
+		id, idLength, _, err := ebmlVint(data, true)
+		if err != nil {
+			return elements, err
+		}
+		if id == stop {
+			break
+		}
+		size, sizeLength, unknown, err := ebmlVint(data[idLength:], false)
+		if err != nil {
+			return elements, err
+		}
+		start := idLength + sizeLength
+		end := uint64(len(data))
+		if !unknown {
+			if size > uint64(len(data)-start) {
+				return elements, fmt.Errorf("element %#x of %d bytes exceeds its parent", id, size)
+			}
+			end = uint64(start) + size
+		}
+		elements = append(elements, ebmlElement{id: id, content: data[start:end]})
+		data = data[end:]
+	}
+	return elements, nil
+}
+
+// ebmlChild returns the content of the first element of the given ID, or nil.
+func ebmlChild(elements []ebmlElement, id uint64) []byte {
+	for _, element := range elements {
+		if element.id == id {
+			return element.content
+		}
+	}
+	return nil
+}
+
+// ebmlUint decodes an unsigned integer element, or returns fallback if it is missing.
+func ebmlUint(content []byte, fallback uint64) uint64 {
+	if len(content) == 0 || len(content) > 8 {
+		return fallback
+	}
+	var value uint64
+	for _, b := range content {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+// webmDocType returns the document type declared in the EBML header, e.g. "webm". The
+// header is complete in the first bytes of a file.
+func webmDocType(data []byte) string {
+	elements, _ := ebmlElements(data, 0)
+	if len(elements) == 0 || elements[0].id != ebmlHeader {
+		return ""
+	}
+	header, _ := ebmlElements(elements[0].content, 0)
+	return string(bytes.TrimRight(ebmlChild(header, ebmlDocType), "\x00"))
+}
+
+// parseWebM reads the duration from the segment info and the dimensions from the first
+// video track.
+func parseWebM(data []byte, video *Video) error {
+	top, err := ebmlElements(data, 0)
+	if err != nil {
+		return err
+	}
+	segment := ebmlChild(top, ebmlSegment)
+	if segment == nil {
+		return fmt.Errorf("no segment")
+	}
+	children, err := ebmlElements(segment, ebmlCluster)
+	if err != nil {
+		return err
+	}
+
+	if info, err := ebmlElements(ebmlChild(children, ebmlInfo), 0); err == nil {
+		scale := ebmlUint(ebmlChild(info, ebmlTimecodeScale), 1_000_000) // Nanoseconds per tick
+		var ticks float64
+		switch duration := ebmlChild(info, ebmlDuration); len(duration) {
+		case 4:
+			ticks = float64(math.Float32frombits(binary.BigEndian.Uint32(duration)))
+		case 8:
+			ticks = math.Float64frombits(binary.BigEndian.Uint64(duration))
+		}
+		if ticks > 0 && !math.IsInf(ticks, 0) && !math.IsNaN(ticks) {
+			video.Duration = time.Duration(ticks * float64(scale))
+		}
+	}
+
+	tracks, err := ebmlElements(ebmlChild(children, ebmlTracks), 0)
+	if err != nil {
+		return err
+	}
+	for _, entry := range tracks {
+		if entry.id != ebmlTrackEntry {
+			continue
+		}
+		fields, err := ebmlElements(entry.content, 0)
+		if err != nil {
+			return err
+		}
+		if ebmlUint(ebmlChild(fields, ebmlTrackType), 0) != 1 { // 1 is video
+			continue
+		}
+		settings, err := ebmlElements(ebmlChild(fields, ebmlVideo), 0)
+		if err != nil {
+			return err
+		}
+		video.Width = int(ebmlUint(ebmlChild(settings, ebmlPixelWidth), 0))
+		video.Height = int(ebmlUint(ebmlChild(settings, ebmlPixelHeight), 0))
+		return nil
+	}
+	return nil
+}
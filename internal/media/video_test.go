@@ -0,0 +1,237 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// box returns an MP4 box of the given type holding the concatenated content.
+func box(kind string, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(b, kind...), body...)
+}
+
+func u32(values ...uint32) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// mvhd returns a version 0 movie header with the given timescale and duration.
+func mvhd(timescale, duration uint32) []byte {
+	return box("mvhd", u32(0, 0, 0, timescale, duration), make([]byte, 80))
+}
+
+// trak returns a track of the given handler whose version 0 header says width x height,
+// rotated by 90 degrees if rotated is set.
+func trak(handler string, width, height uint32, rotated bool) []byte {
+	matrix := u32(0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000)
+	if rotated {
+		matrix = u32(0, 0x10000, 0, 0xffff0000, 0, 0, 0, 0, 0x40000000)
+	}
+	tkhd := box("tkhd", u32(0, 0, 0, 1, 0, 0, 0, 0, 0, 0), matrix, u32(width<<16, height<<16))
+	hdlr := box("hdlr", u32(0, 0), []byte(handler), make([]byte, 13))
+	return box("trak", tkhd, box("mdia", hdlr))
+}
+
+func testMP4(brand string, moov ...[]byte) []byte {
+	return bytes.Join([][]byte{
+		box("ftyp", []byte(brand), u32(0), []byte("isommp41")),
+		box("moov", moov...),
+		box("mdat", make([]byte, 64)),
+	}, nil)
+}
+
+// ebml returns an EBML element with the given ID holding the concatenated content.
+func ebml(id uint64, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	var b []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if id>>shift > 0 {
+			b = append(b, byte(id>>shift))
+		}
+	}
+	b = append(b, 0x01) // 8-byte size
+	b = append(b, binary.BigEndian.AppendUint64(nil, uint64(len(body)))[1:]...)
+	return append(b, body...)
+}
+
+func ebmlUintElement(id uint64, value uint64) []byte {
+	return ebml(id, binary.BigEndian.AppendUint64(nil, value))
+}
+
+func ebmlFloatElement(id uint64, value float64) []byte {
+	return ebml(id, binary.BigEndian.AppendUint64(nil, math.Float64bits(value)))
+}
+
+func testWebM(docType string, segment ...[]byte) []byte {
+	return append(ebml(ebmlHeader, ebml(ebmlDocType, []byte(docType))), ebml(ebmlSegment, segment...)...)
+}
+
+func webmTrack(trackType uint64, width, height uint64) []byte {
+	return ebml(ebmlTrackEntry, ebmlUintElement(ebmlTrackType, trackType),
+		ebml(ebmlVideo, ebmlUintElement(ebmlPixelWidth, width), ebmlUintElement(ebmlPixelHeight, height)))
+}
+
+func TestSniffVideoType(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"MP4", testMP4("isom"), "video/mp4"},
+		{"QuickTime", testMP4("qt  "), "video/quicktime"},
+		{"old QuickTime", box("moov", mvhd(600, 600)), "video/quicktime"},
+		{"HEIC image", testMP4("heic"), ""},
+		{"AVIF image", testMP4("avif"), ""},
+		{"WebM", testWebM("webm"), "video/webm"},
+		{"Matroska", testWebM("matroska"), ""},
+		{"EBML header cut short", testWebM("webm")[:6], ""},
+		{"ftyp cut short", testMP4("isom")[:10], ""},
+		{"PNG", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SniffVideoType(tt.data); got != tt.want {
+				t.Errorf("SniffVideoType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInspectVideo(t *testing.T) {
+	fragmented := box("mvex", box("mehd", u32(0, 90000)))
+	tests := []struct {
+		name         string
+		data         []byte
+		wantType     string
+		wantDim      string
+		wantDuration time.Duration
+		wantErr      error
+	}{
+		{
+			name:         "MP4",
+			data:         testMP4("isom", mvhd(1000, 12500), trak("vide", 1920, 1080, false)),
+			wantType:     "video/mp4",
+			wantDim:      "1920x1080",
+			wantDuration: 12500 * time.Millisecond,
+		},
+		{
+			name:         "rotated portrait MP4",
+			data:         testMP4("isom", mvhd(600, 9000), trak("vide", 1920, 1080, true)),
+			wantType:     "video/mp4",
+			wantDim:      "1080x1920",
+			wantDuration: 15 * time.Second,
+		},
+		{
+			name:         "audio track before the video track",
+			data:         testMP4("qt  ", mvhd(1000, 1000), trak("soun", 0, 0, false), trak("vide", 640, 480, false)),
+			wantType:     "video/quicktime",
+			wantDim:      "640x480",
+			wantDuration: time.Second,
+		},
+		{
+			name:         "fragmented MP4",
+			data:         testMP4("iso5", mvhd(1000, 0), fragmented, trak("vide", 720, 1280, false)),
+			wantType:     "video/mp4",
+			wantDim:      "720x1280",
+			wantDuration: 90 * time.Second,
+		},
+		{
+			name:     "MP4 without duration",
+			data:     testMP4("isom", trak("vide", 1280, 720, false)),
+			wantType: "video/mp4",
+			wantDim:  "1280x720",
+		},
+		{
+			name:         "MP4 with the media data cut off",
+			data:         cutOff(testMP4("isom", mvhd(1000, 2000), trak("vide", 320, 240, false)), 32),
+			wantType:     "video/mp4",
+			wantDim:      "320x240",
+			wantDuration: 2 * time.Second,
+		},
+		{name: "MP4 without video track", data: testMP4("isom", mvhd(1000, 1000), trak("soun", 0, 0, false)), wantErr: ErrUndecodable},
+		{name: "MP4 without movie box", data: testMP4("isom")[:24], wantErr: ErrUndecodable},
+		{name: "MP4 with truncated track header", data: testMP4("isom", box("trak", box("tkhd", u32(0, 0, 0)), box("mdia", box("hdlr", u32(0, 0), []byte("vide")))))},
+		{
+			name:         "WebM",
+			data:         testWebM("webm", ebml(ebmlInfo, ebmlUintElement(ebmlTimecodeScale, 1_000_000), ebmlFloatElement(ebmlDuration, 8000)), ebml(ebmlTracks, webmTrack(2, 0, 0), webmTrack(1, 720, 1280)), ebml(ebmlCluster, make([]byte, 32))),
+			wantType:     "video/webm",
+			wantDim:      "720x1280",
+			wantDuration: 8 * time.Second,
+		},
+		{
+			name:         "WebM with a float32 duration and the default timecode scale",
+			data:         testWebM("webm", ebml(ebmlInfo, ebml(ebmlDuration, u32(math.Float32bits(1500)))), ebml(ebmlTracks, webmTrack(1, 640, 360))),
+			wantType:     "video/webm",
+			wantDim:      "640x360",
+			wantDuration: 1500 * time.Millisecond,
+		},
+		{
+			name: "live WebM with a segment of unknown size",
+			data: append(append(ebml(ebmlHeader, ebml(ebmlDocType, []byte("webm"))), 0x18, 0x53, 0x80, 0x67, 0xff),
+				ebml(ebmlTracks, webmTrack(1, 1280, 720))...),
+			wantType: "video/webm",
+			wantDim:  "1280x720",
+		},
+		{name: "WebM without video track", data: testWebM("webm", ebml(ebmlTracks, webmTrack(2, 0, 0))), wantErr: ErrUndecodable},
+		{name: "WebM without segment", data: ebml(ebmlHeader, ebml(ebmlDocType, []byte("webm"))), wantErr: ErrUndecodable},
+		{name: "not a video", data: []byte("GIF89a"), wantErr: ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantType == "" && tt.wantErr == nil {
+				tt.wantErr = ErrUndecodable
+			}
+			video, err := InspectVideo("https://example.com/video", tt.data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("InspectVideo() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InspectVideo(): %v", err)
+			}
+			if video.MediaType != tt.wantType || video.Dim() != tt.wantDim || video.Duration != tt.wantDuration || video.Size != int64(len(tt.data)) || len(video.SHA256) != 64 {
+				t.Errorf("InspectVideo() = %+v, want %s %s %s", video, tt.wantType, tt.wantDim, tt.wantDuration)
+			}
+		})
+	}
+}
+
+// TestInspectVideoTruncated cuts valid files at every length: parsing must fail or
+// succeed, never panic, and the header boxes must be complete to succeed.
+func TestInspectVideoTruncated(t *testing.T) {
+	files := map[string][]byte{
+		"MP4": testMP4("isom", mvhd(1000, 1000), trak("vide", 1080, 1920, false)),
+		"WebM": testWebM("webm", ebml(ebmlInfo, ebmlFloatElement(ebmlDuration, 1000)),
+			ebml(ebmlTracks, webmTrack(1, 640, 360)), ebml(ebmlCluster, make([]byte, 32))),
+	}
+	for name, data := range files {
+		t.Run(name, func(t *testing.T) {
+			complete, err := InspectVideo("https://example.com/video", data)
+			if err != nil {
+				t.Fatalf("InspectVideo() of the whole file: %v", err)
+			}
+			for n := range len(data) {
+				video, err := InspectVideo("https://example.com/video", data[:n])
+				if err == nil && video.Dim() != complete.Dim() {
+					t.Errorf("cut at %d bytes: got %s, want %s or an error", n, video.Dim(), complete.Dim())
+				}
+			}
+		})
+	}
+}
+
+func cutOff(data []byte, n int) []byte {
+	return data[:len(data)-n]
+}
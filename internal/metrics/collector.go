@@ -3,94 +3,311 @@ package metrics
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"os"
 	"time"
 
 	"github.com/rs/zerolog/log" // Assuming global logger is okay for LogSummary
 )
 
-// Collector stores metrics about bot operation.
-// It includes fields for both general operation and NIP-68 specific events.
+// Event kinds used as the "kind" label of the event counters. They match the kind
+// names used in the publish ledger.
+const (
+	KindNote       = "kind1"     // Kind 1 text note
+	KindPicture    = "kind20"    // NIP-68 picture event
+	KindVideo      = "kind21"    // NIP-71 video event
+	KindShortVideo = "kind22"    // NIP-71 short-form portrait video event
+	KindArticle    = "kind30023" // NIP-23 long-form article
+
+	KindCalendarEvent = "kind31922" // NIP-52 date-based calendar event
+	KindCalendar      = "kind31924" // NIP-52 calendar listing the calendar events
+)
+
+// EventResult is what happened to one kind of one calendar event during a run.
+type EventResult string
+
+const (
+	ResultPosted           EventResult = "posted"            // Published to at least one relay
+	ResultFailed           EventResult = "failed"            // Building, signing or publishing failed
+	ResultSkipped          EventResult = "skipped"           // The event does not qualify for this kind
+	ResultAlreadyPublished EventResult = "already_published" // Found in the publish ledger, not posted again
+)
+
+// Collector stores metrics about one bot run. All methods are safe for concurrent use.
 type Collector struct {
-	// Existing fields from main.go
-	EventsPosted      int                    `json:"eventsPosted"` // Renamed for clarity, was Kind 1 implicitly
-	EventsSkipped     int                    `json:"eventsSkipped"`
-	EventsFailed      int                    `json:"eventsFailed"`  // Renamed for clarity, was Kind 1 implicitly
-	RelaySuccesses    map[string]int         `json:"relaySuccesses"`
-	RelayFailures     map[string]int         `json:"relayFailures"`
-	RelaySuccessTimes map[string][]time.Duration `json:"relaySuccessTimes,omitempty"`
-
-	// New NIP-68 specific metrics fields
-	Kind1EventsPosted    int `json:"kind1EventsPosted"`
-	Kind1EventsFailed    int `json:"kind1EventsFailed"`
-	Kind20EventsPosted   int `json:"kind20EventsPosted"`
-	Kind20EventsFailed   int `json:"kind20EventsFailed"`
-	Kind20EventsSkipped  int `json:"kind20EventsSkipped"` // No olas tag or invalid image
-	ImageValidationFails int `json:"imageValidationFails"`
-}
-
-// NewCollector initializes a new MetricsCollector.
+	startedAt time.Time
+
+	events               *CounterVec // kind, result
+	eventsDateMismatch   *Counter
+	imageValidationFails *Counter
+	invalidImages        *CounterVec // reason
+	invalidImageURLs     *CounterVec // url, reason; snapshot only, one series per URL is too many for Prometheus
+	videoValidationFails *Counter
+	invalidVideos        *CounterVec // reason
+	invalidVideoURLs     *CounterVec // url, reason; snapshot only, like invalidImageURLs
+
+	relayPublishes *CounterVec   // relay, result
+	relayOutcomes  *CounterVec   // relay, outcome
+	relayNotices   *CounterVec   // relay
+	relayConnect   *HistogramVec // relay
+	relayPublish   *HistogramVec // relay
+	relayFailure   *HistogramVec // relay
+
+	// Registered instruments, in exposition order
+	counters      []*Counter
+	counterVecs   []*CounterVec
+	histogramVecs []*HistogramVec
+}
+
+// NewCollector initializes a new Collector for a run starting now.
 func NewCollector() *Collector {
-	return &Collector{
-		RelaySuccesses:    make(map[string]int),
-		RelayFailures:     make(map[string]int),
-		RelaySuccessTimes: make(map[string][]time.Duration),
-		// NIP-68 fields will be zero-initialized by default
+	mc := &Collector{
+		startedAt:            time.Now().UTC(),
+		events:               NewCounterVec("calendar_bot_events_total", "Calendar events processed in the current run, by Nostr kind and result.", "kind", "result"),
+		eventsDateMismatch:   NewCounter("calendar_bot_events_date_mismatch_total", "API events skipped because their date did not match the requested day."),
+		imageValidationFails: NewCounter("calendar_bot_image_validation_failures_total", "Media URLs that failed image validation."),
+		invalidImages:        NewCounterVec("calendar_bot_invalid_images_total", "Media URLs that failed image validation, by reason.", "reason"),
+		invalidImageURLs:     NewCounterVec("calendar_bot_invalid_image_urls_total", "Media URLs that failed image validation, by URL and reason.", "url", "reason"),
+		videoValidationFails: NewCounter("calendar_bot_video_validation_failures_total", "Video URLs that failed video validation."),
+		invalidVideos:        NewCounterVec("calendar_bot_invalid_videos_total", "Video URLs that failed video validation, by reason.", "reason"),
+		invalidVideoURLs:     NewCounterVec("calendar_bot_invalid_video_urls_total", "Video URLs that failed video validation, by URL and reason.", "url", "reason"),
+		relayPublishes:       NewCounterVec("calendar_bot_relay_publishes_total", "Relay publish attempts, by relay and result.", "relay", "result"),
+		relayOutcomes:        NewCounterVec("calendar_bot_relay_outcomes_total", "Classified relay OK responses, by relay and outcome.", "relay", "outcome"),
+		relayNotices:         NewCounterVec("calendar_bot_relay_notices_total", "NOTICE messages received, by relay.", "relay"),
+		relayConnect:         NewHistogramVec("calendar_bot_relay_connect_duration_seconds", "Time to open a new relay connection.", "relay"),
+		relayPublish:         NewHistogramVec("calendar_bot_relay_publish_duration_seconds", "Publish to OK round trip of accepted events.", "relay"),
+		relayFailure:         NewHistogramVec("calendar_bot_relay_failure_duration_seconds", "Time until a failed publish attempt gave up.", "relay"),
+	}
+	mc.counters = []*Counter{mc.eventsDateMismatch, mc.imageValidationFails, mc.videoValidationFails}
+	mc.counterVecs = []*CounterVec{mc.events, mc.invalidImages, mc.invalidVideos, mc.relayPublishes, mc.relayOutcomes, mc.relayNotices}
+	mc.histogramVecs = []*HistogramVec{mc.relayConnect, mc.relayPublish, mc.relayFailure}
+
+	// Create the event series up front so every run reports them, even when zero.
+	for _, result := range []EventResult{ResultPosted, ResultFailed, ResultAlreadyPublished} {
+		mc.events.Add(0, KindNote, string(result))
 	}
+	for _, kind := range []string{KindPicture, KindVideo, KindShortVideo} {
+		for _, result := range []EventResult{ResultPosted, ResultFailed, ResultSkipped, ResultAlreadyPublished} {
+			mc.events.Add(0, kind, string(result))
+		}
+	}
+	for _, result := range []EventResult{ResultPosted, ResultFailed, ResultAlreadyPublished} {
+		mc.events.Add(0, KindArticle, string(result))
+	}
+	for _, result := range []EventResult{ResultPosted, ResultFailed, ResultAlreadyPublished} {
+		mc.events.Add(0, KindCalendarEvent, string(result))
+	}
+	return mc
+}
+
+// RecordEvent counts one calendar event of the given kind with the given result.
+func (mc *Collector) RecordEvent(kind string, result EventResult) {
+	mc.events.Inc(kind, string(result))
+}
+
+// EventCount returns how many events of the given kind ended with the given result.
+func (mc *Collector) EventCount(kind string, result EventResult) int {
+	return mc.events.Value(kind, string(result))
+}
+
+// RecordDateMismatch counts an API event skipped because its date did not match the requested day.
+func (mc *Collector) RecordDateMismatch() {
+	mc.eventsDateMismatch.Inc()
+}
+
+// RecordImageValidationFailure counts a media URL that failed image validation, and why,
+// e.g. "too_large" (see media.Reason).
+func (mc *Collector) RecordImageValidationFailure(mediaURL string, reason string) {
+	mc.imageValidationFails.Inc()
+	mc.invalidImages.Inc(reason)
+	mc.invalidImageURLs.Inc(mediaURL, reason)
+}
+
+// RecordVideoValidationFailure counts a video URL that failed video validation, and why,
+// e.g. "undecodable" (see media.Reason).
+func (mc *Collector) RecordVideoValidationFailure(mediaURL string, reason string) {
+	mc.videoValidationFails.Inc()
+	mc.invalidVideos.Inc(reason)
+	mc.invalidVideoURLs.Inc(mediaURL, reason)
 }
 
-// RecordRelaySuccess records a successful relay publish.
+// RecordRelaySuccess records a successful relay publish and its publish to OK round-trip time.
 func (mc *Collector) RecordRelaySuccess(relayURL string, duration time.Duration) {
-	mc.RelaySuccesses[relayURL]++
+	mc.relayPublishes.Inc(relayURL, "success")
 	if duration > 0 { // Only record times if a valid duration is provided
-		mc.RelaySuccessTimes[relayURL] = append(mc.RelaySuccessTimes[relayURL], duration)
+		mc.relayPublish.Observe(duration, relayURL)
+	}
+}
+
+// RecordRelayFailure records a failed relay publish and how long it took to fail.
+func (mc *Collector) RecordRelayFailure(relayURL string, duration time.Duration) {
+	mc.relayPublishes.Inc(relayURL, "failure")
+	if duration > 0 {
+		mc.relayFailure.Observe(duration, relayURL)
 	}
 }
 
-// RecordRelayFailure records a failed relay publish.
-func (mc *Collector) RecordRelayFailure(relayURL string) {
-	mc.RelayFailures[relayURL]++
+// RecordRelayConnect records the time it took to open a new connection to a relay.
+func (mc *Collector) RecordRelayConnect(relayURL string, duration time.Duration) {
+	mc.relayConnect.Observe(duration, relayURL)
+}
+
+// RecordRelayOutcome records the classified response of a relay to a publish
+// (accepted, duplicate, blocked, rate-limited, ...).
+func (mc *Collector) RecordRelayOutcome(relayURL string, outcome string) {
+	mc.relayOutcomes.Inc(relayURL, outcome)
+}
+
+// RecordRelayNotice records a NOTICE message received from a relay.
+func (mc *Collector) RecordRelayNotice(relayURL string) {
+	mc.relayNotices.Inc(relayURL)
+}
+
+// Snapshot returns a consistent copy of the collected metrics.
+func (mc *Collector) Snapshot() Snapshot {
+	s := Snapshot{
+		SchemaVersion:        SchemaVersion,
+		StartedAt:            mc.startedAt,
+		FinishedAt:           time.Now().UTC(),
+		Events:               make(map[string]map[string]int),
+		EventsDateMismatch:   mc.eventsDateMismatch.Value(),
+		ImageValidationFails: mc.imageValidationFails.Value(),
+		InvalidImages:        make(map[string]map[string]int),
+		VideoValidationFails: mc.videoValidationFails.Value(),
+		InvalidVideos:        make(map[string]map[string]int),
+		Relays:               make(map[string]RelaySnapshot),
+	}
+	mc.invalidImageURLs.Each(func(labelValues []string, count int) {
+		url, reason := labelValues[0], labelValues[1]
+		if s.InvalidImages[url] == nil {
+			s.InvalidImages[url] = make(map[string]int)
+		}
+		s.InvalidImages[url][reason] = count
+	})
+	mc.invalidVideoURLs.Each(func(labelValues []string, count int) {
+		url, reason := labelValues[0], labelValues[1]
+		if s.InvalidVideos[url] == nil {
+			s.InvalidVideos[url] = make(map[string]int)
+		}
+		s.InvalidVideos[url][reason] = count
+	})
+	mc.events.Each(func(labelValues []string, count int) {
+		kind, result := labelValues[0], labelValues[1]
+		if s.Events[kind] == nil {
+			s.Events[kind] = make(map[string]int)
+		}
+		s.Events[kind][result] = count
+	})
+
+	relay := func(url string) RelaySnapshot {
+		r, ok := s.Relays[url]
+		if !ok {
+			r.Outcomes = make(map[string]int)
+		}
+		return r
+	}
+	mc.relayPublishes.Each(func(labelValues []string, count int) {
+		r := relay(labelValues[0])
+		if labelValues[1] == "success" {
+			r.Successes = count
+		} else {
+			r.Failures = count
+		}
+		s.Relays[labelValues[0]] = r
+	})
+	mc.relayOutcomes.Each(func(labelValues []string, count int) {
+		r := relay(labelValues[0])
+		r.Outcomes[labelValues[1]] = count
+		s.Relays[labelValues[0]] = r
+	})
+	mc.relayNotices.Each(func(labelValues []string, count int) {
+		r := relay(labelValues[0])
+		r.Notices = count
+		s.Relays[labelValues[0]] = r
+	})
+	for _, h := range []*HistogramVec{mc.relayConnect, mc.relayPublish, mc.relayFailure} {
+		h.Each(func(labelValues []string, _ []time.Duration) {
+			s.Relays[labelValues[0]] = relay(labelValues[0])
+		})
+	}
+	for url, r := range s.Relays {
+		r.Latency = RelayLatency{
+			Connect: mc.relayConnect.Summary(url),
+			Publish: mc.relayPublish.Summary(url),
+			Failure: mc.relayFailure.Summary(url),
+		}
+		s.Relays[url] = r
+	}
+	return s
 }
 
 // LogSummary logs a summary of collected metrics using the global logger.
-// This will need to be updated to show the new NIP-68 fields.
 func (mc *Collector) LogSummary() {
+	s := mc.Snapshot()
 	log.Info().
-		Int("eventsPostedTotal_DEPRECATED", mc.EventsPosted). // Mark old fields for review/removal
-		Int("eventsSkippedTotal", mc.EventsSkipped).
-		Int("eventsFailedTotal_DEPRECATED", mc.EventsFailed).   // Mark old fields for review/removal
-		Int("kind1EventsPosted", mc.Kind1EventsPosted).
-		Int("kind1EventsFailed", mc.Kind1EventsFailed).
-		Int("kind20EventsPosted", mc.Kind20EventsPosted).
-		Int("kind20EventsFailed", mc.Kind20EventsFailed).
-		Int("kind20EventsSkipped", mc.Kind20EventsSkipped).
-		Int("imageValidationFails", mc.ImageValidationFails).
-		Interface("relaySuccessesPerRelay", mc.RelaySuccesses).
-		Interface("relayFailuresPerRelay", mc.RelayFailures).
+		Int("kind1EventsPosted", s.Events[KindNote][string(ResultPosted)]).
+		Int("kind1EventsFailed", s.Events[KindNote][string(ResultFailed)]).
+		Int("kind1EventsAlreadyPublished", s.Events[KindNote][string(ResultAlreadyPublished)]).
+		Int("kind20EventsPosted", s.Events[KindPicture][string(ResultPosted)]).
+		Int("kind20EventsFailed", s.Events[KindPicture][string(ResultFailed)]).
+		Int("kind20EventsSkipped", s.Events[KindPicture][string(ResultSkipped)]).
+		Int("kind20EventsAlreadyPublished", s.Events[KindPicture][string(ResultAlreadyPublished)]).
+		Int("kind21EventsPosted", s.Events[KindVideo][string(ResultPosted)]).
+		Int("kind21EventsFailed", s.Events[KindVideo][string(ResultFailed)]).
+		Int("kind21EventsAlreadyPublished", s.Events[KindVideo][string(ResultAlreadyPublished)]).
+		Int("kind22EventsPosted", s.Events[KindShortVideo][string(ResultPosted)]).
+		Int("kind22EventsFailed", s.Events[KindShortVideo][string(ResultFailed)]).
+		Int("kind22EventsAlreadyPublished", s.Events[KindShortVideo][string(ResultAlreadyPublished)]).
+		Int("kind30023EventsPosted", s.Events[KindArticle][string(ResultPosted)]).
+		Int("kind30023EventsFailed", s.Events[KindArticle][string(ResultFailed)]).
+		Int("kind30023EventsAlreadyPublished", s.Events[KindArticle][string(ResultAlreadyPublished)]).
+		Int("kind31922EventsPosted", s.Events[KindCalendarEvent][string(ResultPosted)]).
+		Int("kind31922EventsFailed", s.Events[KindCalendarEvent][string(ResultFailed)]).
+		Int("kind31922EventsAlreadyPublished", s.Events[KindCalendarEvent][string(ResultAlreadyPublished)]).
+		Int("eventsDateMismatch", s.EventsDateMismatch).
+		Int("imageValidationFails", s.ImageValidationFails).
+		Int("videoValidationFails", s.VideoValidationFails).
+		Interface("events", s.Events).
 		Msg("Run Metrics Summary")
 
-	// Example of logging average times, can be expanded
-	for relay, times := range mc.RelaySuccessTimes {
-		if len(times) > 0 {
-			var totalDuration time.Duration
-			for _, t := range times {
-				totalDuration += t
-			}
-			avgDuration := totalDuration / time.Duration(len(times))
-			log.Debug().Str("relayURL", relay).Dur("averageSuccessfulPublishTimeMs", avgDuration).Int("successfulPublishCount", len(times)).Msg("Relay Performance Detail")
-		}
+	for relay, r := range s.Relays {
+		log.Info().
+			Str("relayURL", relay).
+			Int("successes", r.Successes).
+			Int("failures", r.Failures).
+			Interface("outcomes", r.Outcomes).
+			Int("notices", r.Notices).
+			Int("publishCount", r.Latency.Publish.Count).
+			Float64("publishP50Ms", r.Latency.Publish.P50Ms).
+			Float64("publishP90Ms", r.Latency.Publish.P90Ms).
+			Float64("publishP99Ms", r.Latency.Publish.P99Ms).
+			Int("connectCount", r.Latency.Connect.Count).
+			Float64("connectP50Ms", r.Latency.Connect.P50Ms).
+			Float64("connectP90Ms", r.Latency.Connect.P90Ms).
+			Int("failureCount", r.Latency.Failure.Count).
+			Float64("failureP50Ms", r.Latency.Failure.P50Ms).
+			Msg("Relay Performance Detail")
 	}
 }
 
-// ExportMetrics saves the collected metrics to a JSON file.
+// ExportMetrics saves a snapshot of the collected metrics to a JSON file.
 func (mc *Collector) ExportMetrics(filePath string) error {
-	data, err := json.MarshalIndent(mc, "", "  ")
+	data, err := json.MarshalIndent(mc.Snapshot(), "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal metrics to JSON: %w", err)
 	}
-	err = ioutil.WriteFile(filePath, data, 0644) // Standard file permissions
+	err = os.WriteFile(filePath, data, 0644) // Standard file permissions
 	if err != nil {
 		return fmt.Errorf("failed to write metrics JSON to file %s: %w", filePath, err)
 	}
 	return nil
-} 
\ No newline at end of file
+}
+
+// ExportToDir saves the collected metrics into dir as <prefix>_<timestamp>.json,
+// creating the directory if needed. Returns the path of the written file.
+func (mc *Collector) ExportToDir(dir string, prefix string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create metrics directory %s: %w", dir, err)
+	}
+	filePath := fmt.Sprintf("%s/metrics_%s_%s.json", dir, prefix, time.Now().Format(exportTimeLayout))
+	return filePath, mc.ExportMetrics(filePath)
+}
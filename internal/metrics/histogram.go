@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the latency histograms, chosen to
+// cover everything from a fast local relay to the publish timeout.
+var LatencyBuckets = []time.Duration{
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	25 * time.Second,
+}
+
+// BucketCount is one cumulative histogram bucket: the number of samples at or below LeMs.
+// The last bucket has LeMs set to -1 and counts every sample (+Inf).
+type BucketCount struct {
+	LeMs  float64 `json:"leMs"`
+	Count int     `json:"count"`
+}
+
+// LatencySummary is the exported form of a set of latency samples.
+type LatencySummary struct {
+	Count   int           `json:"count"`
+	MinMs   float64       `json:"minMs"`
+	MeanMs  float64       `json:"meanMs"`
+	P50Ms   float64       `json:"p50Ms"`
+	P90Ms   float64       `json:"p90Ms"`
+	P99Ms   float64       `json:"p99Ms"`
+	MaxMs   float64       `json:"maxMs"`
+	Buckets []BucketCount `json:"buckets"`
+}
+
+// RelayLatency groups the latency summaries of one relay.
+type RelayLatency struct {
+	Connect LatencySummary `json:"connect"` // Time to open a new connection
+	Publish LatencySummary `json:"publish"` // Publish to OK round trip of accepted events
+	Failure LatencySummary `json:"failure"` // Time until a publish attempt failed
+}
+
+// SummarizeLatencies computes percentiles and cumulative buckets for the given samples.
+func SummarizeLatencies(samples []time.Duration) LatencySummary {
+	summary := LatencySummary{Count: len(samples), Buckets: make([]BucketCount, 0, len(LatencyBuckets)+1)}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for _, bound := range LatencyBuckets {
+		count := sort.Search(len(sorted), func(i int) bool { return sorted[i] > bound })
+		summary.Buckets = append(summary.Buckets, BucketCount{LeMs: toMs(bound), Count: count})
+	}
+	summary.Buckets = append(summary.Buckets, BucketCount{LeMs: -1, Count: len(sorted)})
+
+	if len(sorted) == 0 {
+		return summary
+	}
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	summary.MinMs = toMs(sorted[0])
+	summary.MaxMs = toMs(sorted[len(sorted)-1])
+	summary.MeanMs = toMs(total / time.Duration(len(sorted)))
+	summary.P50Ms = toMs(percentile(sorted, 0.50))
+	summary.P90Ms = toMs(percentile(sorted, 0.90))
+	summary.P99Ms = toMs(percentile(sorted, 0.99))
+	return summary
+}
+
+// percentile returns the nearest-rank percentile of sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func toMs(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*100) / 100
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func ms(values ...int) []time.Duration {
+	durations := make([]time.Duration, len(values))
+	for i, v := range values {
+		durations[i] = time.Duration(v) * time.Millisecond
+	}
+	return durations
+}
+
+func TestSummarizeLatencies(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []time.Duration
+		want    LatencySummary
+		buckets []int // Cumulative counts per LatencyBuckets bound, then +Inf
+	}{
+		{
+			name:    "no samples",
+			want:    LatencySummary{},
+			buckets: []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name:    "one sample",
+			samples: ms(120),
+			want:    LatencySummary{Count: 1, MinMs: 120, MeanMs: 120, P50Ms: 120, P90Ms: 120, P99Ms: 120, MaxMs: 120},
+			buckets: []int{0, 0, 1, 1, 1, 1, 1, 1, 1, 1},
+		},
+		{
+			name:    "unsorted samples use nearest rank",
+			samples: ms(100, 10, 90, 20, 80, 30, 70, 40, 60, 50),
+			want:    LatencySummary{Count: 10, MinMs: 10, MeanMs: 55, P50Ms: 50, P90Ms: 90, P99Ms: 100, MaxMs: 100},
+			buckets: []int{5, 10, 10, 10, 10, 10, 10, 10, 10, 10},
+		},
+		{
+			name:    "samples on a bound count in its bucket",
+			samples: ms(50, 1000),
+			want:    LatencySummary{Count: 2, MinMs: 50, MeanMs: 525, P50Ms: 50, P90Ms: 1000, P99Ms: 1000, MaxMs: 1000},
+			buckets: []int{1, 1, 1, 1, 2, 2, 2, 2, 2, 2},
+		},
+		{
+			name:    "samples past the last bound count only in +Inf",
+			samples: ms(30000),
+			want:    LatencySummary{Count: 1, MinMs: 30000, MeanMs: 30000, P50Ms: 30000, P90Ms: 30000, P99Ms: 30000, MaxMs: 30000},
+			buckets: []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+		},
+		{
+			name:    "sub-millisecond samples round to two decimals",
+			samples: []time.Duration{1234567 * time.Nanosecond},
+			want:    LatencySummary{Count: 1, MinMs: 1.23, MeanMs: 1.23, P50Ms: 1.23, P90Ms: 1.23, P99Ms: 1.23, MaxMs: 1.23},
+			buckets: []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := slices.Clone(tt.samples)
+			got := SummarizeLatencies(tt.samples)
+			if !slices.Equal(tt.samples, input) {
+				t.Errorf("SummarizeLatencies reordered its input to %v", tt.samples)
+			}
+
+			buckets := got.Buckets
+			got.Buckets, tt.want.Buckets = nil, nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SummarizeLatencies() = %+v, want %+v", got, tt.want)
+			}
+			if len(buckets) != len(LatencyBuckets)+1 {
+				t.Fatalf("got %d buckets, want %d", len(buckets), len(LatencyBuckets)+1)
+			}
+			for i, bucket := range buckets {
+				wantLe := float64(-1)
+				if i < len(LatencyBuckets) {
+					wantLe = toMs(LatencyBuckets[i])
+				}
+				if bucket.LeMs != wantLe || bucket.Count != tt.buckets[i] {
+					t.Errorf("bucket %d = %+v, want le %v count %d", i, bucket, wantLe, tt.buckets[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// labelSeparator joins label values into a map key. It cannot appear in relay URLs or kinds.
+const labelSeparator = "\xff"
+
+// Counter is a goroutine-safe count that only goes up.
+type Counter struct {
+	name  string
+	help  string
+	value atomic.Int64
+}
+
+// NewCounter creates a Counter. name and help are used in the Prometheus exposition.
+func NewCounter(name string, help string) *Counter {
+	return &Counter{name: name, help: help}
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add adds n to the counter. Negative values are ignored.
+func (c *Counter) Add(n int) {
+	if n > 0 {
+		c.value.Add(int64(n))
+	}
+}
+
+// Value returns the current count.
+func (c *Counter) Value() int {
+	return int(c.value.Load())
+}
+
+// labeledSeries is one combination of label values in a vector.
+type labeledSeries struct {
+	values  []string
+	count   int
+	samples []time.Duration
+}
+
+// vector holds the series of a labelled metric family.
+type vector struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*labeledSeries
+}
+
+func newVector(name string, help string, labels []string) vector {
+	return vector{name: name, help: help, labels: labels, series: make(map[string]*labeledSeries)}
+}
+
+// get returns the series for the given label values, creating it if needed. Callers must hold v.mu.
+func (v *vector) get(values []string) *labeledSeries {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values (%s), got %d", v.name, len(v.labels), strings.Join(v.labels, ", "), len(values)))
+	}
+	key := strings.Join(values, labelSeparator)
+	s, ok := v.series[key]
+	if !ok {
+		s = &labeledSeries{values: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// snapshot returns copies of all series, sorted by label values.
+func (v *vector) snapshot() []labeledSeries {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	out := make([]labeledSeries, 0, len(v.series))
+	for _, s := range v.series {
+		out = append(out, labeledSeries{
+			values:  append([]string(nil), s.values...),
+			count:   s.count,
+			samples: append([]time.Duration(nil), s.samples...),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].values, labelSeparator) < strings.Join(out[j].values, labelSeparator)
+	})
+	return out
+}
+
+// CounterVec is a goroutine-safe family of counters partitioned by label values,
+// e.g. relay publishes by relay URL and result.
+type CounterVec struct {
+	vector
+}
+
+// NewCounterVec creates a CounterVec with the given label names.
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return &CounterVec{vector: newVector(name, help, labels)}
+}
+
+// Inc adds one to the counter for the given label values, in label order.
+func (cv *CounterVec) Inc(labelValues ...string) {
+	cv.Add(1, labelValues...)
+}
+
+// Add adds n to the counter for the given label values. Negative values are ignored;
+// adding zero creates the series so it is reported before its first increment.
+func (cv *CounterVec) Add(n int, labelValues ...string) {
+	if n < 0 {
+		return
+	}
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	cv.get(labelValues).count += n
+}
+
+// Value returns the count for the given label values, zero if never incremented.
+func (cv *CounterVec) Value(labelValues ...string) int {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	if s, ok := cv.series[strings.Join(labelValues, labelSeparator)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+// Each calls fn for every series in label-value order.
+func (cv *CounterVec) Each(fn func(labelValues []string, count int)) {
+	for _, s := range cv.snapshot() {
+		fn(s.values, s.count)
+	}
+}
+
+// HistogramVec is a goroutine-safe family of duration histograms partitioned by label values.
+// Raw samples are kept so exact percentiles can be computed for the run summary; a run
+// produces at most a few hundred samples per relay.
+type HistogramVec struct {
+	vector
+}
+
+// NewHistogramVec creates a HistogramVec with the given label names. Buckets are LatencyBuckets.
+func NewHistogramVec(name string, help string, labels ...string) *HistogramVec {
+	return &HistogramVec{vector: newVector(name, help, labels)}
+}
+
+// Observe records one duration for the given label values.
+func (hv *HistogramVec) Observe(d time.Duration, labelValues ...string) {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	s := hv.get(labelValues)
+	s.count++
+	s.samples = append(s.samples, d)
+}
+
+// Summary returns the latency summary for the given label values.
+func (hv *HistogramVec) Summary(labelValues ...string) LatencySummary {
+	hv.mu.Lock()
+	var samples []time.Duration
+	if s, ok := hv.series[strings.Join(labelValues, labelSeparator)]; ok {
+		samples = append(samples, s.samples...)
+	}
+	hv.mu.Unlock()
+	return SummarizeLatencies(samples)
+}
+
+// Each calls fn for every series in label-value order with a copy of its samples.
+func (hv *HistogramVec) Each(fn func(labelValues []string, samples []time.Duration)) {
+	for _, s := range hv.snapshot() {
+		fn(s.values, s.samples)
+	}
+}
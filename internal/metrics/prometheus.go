@@ -0,0 +1,222 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prometheusContentType is the content type of the Prometheus text exposition format.
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// promWriter writes metric families in the Prometheus text exposition format.
+type promWriter struct {
+	w      io.Writer
+	labels string // Constant labels added to every sample, already formatted
+	err    error
+}
+
+func (pw *promWriter) printf(format string, args ...interface{}) {
+	if pw.err == nil {
+		_, pw.err = fmt.Fprintf(pw.w, format, args...)
+	}
+}
+
+func (pw *promWriter) header(name string, metricType string, help string) {
+	pw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func (pw *promWriter) sample(name string, labels [][2]string, value float64) {
+	pw.printf("%s%s %s\n", name, pw.formatLabels(labels), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (pw *promWriter) formatLabels(labels [][2]string) string {
+	parts := make([]string, 0, len(labels)+1)
+	if pw.labels != "" {
+		parts = append(parts, pw.labels)
+	}
+	for _, l := range labels {
+		parts = append(parts, formatLabel(l[0], l[1]))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatLabel(name string, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+	return name + `="` + value + `"`
+}
+
+// histogram writes a histogram family sample set for the given latency samples.
+func (pw *promWriter) histogram(name string, labels [][2]string, samples []time.Duration) {
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	for _, bound := range LatencyBuckets {
+		count := sort.Search(len(sorted), func(i int) bool { return sorted[i] > bound })
+		pw.sample(name+"_bucket", append(labels, [2]string{"le", strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)}), float64(count))
+	}
+	pw.sample(name+"_bucket", append(labels, [2]string{"le", "+Inf"}), float64(len(sorted)))
+	pw.sample(name+"_sum", labels, sum.Seconds())
+	pw.sample(name+"_count", labels, float64(len(sorted)))
+}
+
+// sortedKeys returns the keys of a label map in a stable order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pairLabels zips label names with values.
+func pairLabels(names []string, values []string) [][2]string {
+	pairs := make([][2]string, len(names))
+	for i, name := range names {
+		pairs[i] = [2]string{name, values[i]}
+	}
+	return pairs
+}
+
+// Source is one collector rendered by WritePrometheus, with the constant labels that tell
+// it apart from the other sources, e.g. the language and profile of one bot identity.
+type Source struct {
+	Collector func() *Collector // Called on every render, so the collector may be swapped between runs
+	Labels    map[string]string
+}
+
+// WritePrometheus writes the collector's counters and relay latency histograms in the
+// Prometheus text exposition format. The given labels are added to every sample,
+// e.g. to tell several bot languages apart.
+func (mc *Collector) WritePrometheus(w io.Writer, labels map[string]string) error {
+	return WritePrometheus(w, Source{Collector: func() *Collector { return mc }, Labels: labels})
+}
+
+// WritePrometheus writes the metrics of several collectors in the Prometheus text
+// exposition format, each metric family once with the samples of every source.
+func WritePrometheus(w io.Writer, sources ...Source) error {
+	pw := &promWriter{w: w}
+	collectors := make([]*Collector, len(sources))
+	constLabels := make([]string, len(sources))
+	for i, source := range sources {
+		collectors[i] = source.Collector()
+		formatted := make([]string, 0, len(source.Labels))
+		for _, name := range sortedKeys(source.Labels) {
+			formatted = append(formatted, formatLabel(name, source.Labels[name]))
+		}
+		constLabels[i] = strings.Join(formatted, ",")
+	}
+	if len(collectors) == 0 {
+		return nil
+	}
+
+	// Every collector registers the same instruments in the same order.
+	for f, cv := range collectors[0].counterVecs {
+		pw.header(cv.name, "counter", cv.help)
+		for i, mc := range collectors {
+			pw.labels = constLabels[i]
+			mc.counterVecs[f].Each(func(labelValues []string, count int) {
+				pw.sample(cv.name, pairLabels(cv.labels, labelValues), float64(count))
+			})
+		}
+	}
+	for f, c := range collectors[0].counters {
+		pw.header(c.name, "counter", c.help)
+		for i, mc := range collectors {
+			pw.labels = constLabels[i]
+			pw.sample(c.name, nil, float64(mc.counters[f].Value()))
+		}
+	}
+	for f, hv := range collectors[0].histogramVecs {
+		pw.header(hv.name, "histogram", hv.help)
+		for i, mc := range collectors {
+			pw.labels = constLabels[i]
+			mc.histogramVecs[f].Each(func(labelValues []string, samples []time.Duration) {
+				pw.histogram(hv.name, pairLabels(hv.labels, labelValues), samples)
+			})
+		}
+	}
+
+	return pw.err
+}
+
+// Handler serves the metrics of the given sources in the Prometheus text format. The
+// sources' collectors are fetched on every scrape, so they may be swapped between runs
+// (e.g. at midnight in daemon mode).
+func Handler(sources ...Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := WritePrometheus(&buf, sources...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", prometheusContentType)
+		w.Write(buf.Bytes())
+	})
+}
+
+// Push sends the collector's metrics to a Pushgateway-compatible endpoint, replacing the
+// metrics previously pushed for the same job and grouping labels.
+func (mc *Collector) Push(ctx context.Context, gatewayURL string, job string, grouping map[string]string) error {
+	var buf bytes.Buffer
+	if err := mc.WritePrometheus(&buf, nil); err != nil {
+		return fmt.Errorf("failed to render metrics for push: %w", err)
+	}
+
+	pushURL := strings.TrimRight(gatewayURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	for _, name := range sortedKeys(grouping) {
+		pushURL += "/" + url.PathEscape(name) + "/" + url.PathEscape(grouping[name])
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, pushURL, &buf)
+	if err != nil {
+		return fmt.Errorf("failed to create push request: %w", err)
+	}
+	req.Header.Set("Content-Type", prometheusContentType)
+
+	client := http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics to %s: %w", pushURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway %s returned status %d: %s", pushURL, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Serve exposes the metrics handler on addr under /metrics until ctx is cancelled.
+func Serve(ctx context.Context, addr string, handler http.Handler) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("metrics server on %s failed: %w", addr, err)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the exported metrics JSON (see Snapshot).
+// Bump it whenever the layout changes in a way readers must know about.
+// Files written before versioning have no schemaVersion field and are treated as version 1.
+const SchemaVersion = 2
+
+// exportTimeLayout is the timestamp format in exported file names (local time).
+const exportTimeLayout = "2006-01-02_15-04-05"
+
+// Snapshot is the exported form of a run's metrics, written as JSON to metrics-logs.
+// Its layout is versioned by SchemaVersion.
+type Snapshot struct {
+	SchemaVersion        int                       `json:"schemaVersion"`
+	StartedAt            time.Time                 `json:"startedAt"`
+	FinishedAt           time.Time                 `json:"finishedAt"`
+	Events               map[string]map[string]int `json:"events"` // Kind -> result -> count
+	EventsDateMismatch   int                       `json:"eventsDateMismatch"`
+	ImageValidationFails int                       `json:"imageValidationFails"`
+	InvalidImages        map[string]map[string]int `json:"invalidImages,omitempty"` // Media URL -> reason -> count
+	VideoValidationFails int                       `json:"videoValidationFails"`
+	InvalidVideos        map[string]map[string]int `json:"invalidVideos,omitempty"` // Video URL -> reason -> count
+	Relays               map[string]RelaySnapshot  `json:"relays"`                  // Relay URL -> relay metrics
+}
+
+// RelaySnapshot holds the metrics of one relay in a Snapshot.
+type RelaySnapshot struct {
+	Successes int            `json:"successes"`
+	Failures  int            `json:"failures"`
+	Outcomes  map[string]int `json:"outcomes"` // Classified OK outcome -> count
+	Notices   int            `json:"notices"`
+	Latency   RelayLatency   `json:"latency"`
+}
+
+// EventCount returns how many events of the given kind ended with the given result.
+func (s Snapshot) EventCount(kind string, result EventResult) int {
+	return s.Events[kind][string(result)]
+}
+
+// legacySnapshot is the flat layout written before the export schema was versioned.
+type legacySnapshot struct {
+	EventsPosted                 int                       `json:"eventsPosted"`
+	EventsSkipped                int                       `json:"eventsSkipped"`
+	EventsFailed                 int                       `json:"eventsFailed"`
+	RelaySuccesses               map[string]int            `json:"relaySuccesses"`
+	RelayFailures                map[string]int            `json:"relayFailures"`
+	RelayLatency                 map[string]RelayLatency   `json:"relayLatency"`
+	RelayOutcomes                map[string]map[string]int `json:"relayOutcomes"`
+	RelayNotices                 map[string]int            `json:"relayNotices"`
+	Kind1EventsPosted            int                       `json:"kind1EventsPosted"`
+	Kind1EventsFailed            int                       `json:"kind1EventsFailed"`
+	Kind20EventsPosted           int                       `json:"kind20EventsPosted"`
+	Kind20EventsFailed           int                       `json:"kind20EventsFailed"`
+	Kind20EventsSkipped          int                       `json:"kind20EventsSkipped"`
+	ImageValidationFails         int                       `json:"imageValidationFails"`
+	Kind1EventsAlreadyPublished  int                       `json:"kind1EventsAlreadyPublished"`
+	Kind20EventsAlreadyPublished int                       `json:"kind20EventsAlreadyPublished"`
+}
+
+// upgrade converts a legacy file into the current layout. Run times are unknown.
+func (l legacySnapshot) upgrade() Snapshot {
+	kind1Posted, kind1Failed := l.Kind1EventsPosted, l.Kind1EventsFailed
+	if kind1Posted == 0 && kind1Failed == 0 {
+		// The oldest files only had the deprecated totals, which counted Kind 1 events.
+		kind1Posted, kind1Failed = l.EventsPosted, l.EventsFailed
+	}
+	s := Snapshot{
+		SchemaVersion: 1,
+		Events: map[string]map[string]int{
+			KindNote: {
+				string(ResultPosted):           kind1Posted,
+				string(ResultFailed):           kind1Failed,
+				string(ResultAlreadyPublished): l.Kind1EventsAlreadyPublished,
+			},
+			KindPicture: {
+				string(ResultPosted):           l.Kind20EventsPosted,
+				string(ResultFailed):           l.Kind20EventsFailed,
+				string(ResultSkipped):          l.Kind20EventsSkipped,
+				string(ResultAlreadyPublished): l.Kind20EventsAlreadyPublished,
+			},
+		},
+		EventsDateMismatch:   l.EventsSkipped,
+		ImageValidationFails: l.ImageValidationFails,
+		Relays:               make(map[string]RelaySnapshot),
+	}
+	relay := func(url string) RelaySnapshot {
+		r, ok := s.Relays[url]
+		if !ok {
+			r.Outcomes = make(map[string]int)
+		}
+		return r
+	}
+	for url, n := range l.RelaySuccesses {
+		r := relay(url)
+		r.Successes = n
+		s.Relays[url] = r
+	}
+	for url, n := range l.RelayFailures {
+		r := relay(url)
+		r.Failures = n
+		s.Relays[url] = r
+	}
+	for url, outcomes := range l.RelayOutcomes {
+		r := relay(url)
+		for outcome, n := range outcomes {
+			r.Outcomes[outcome] = n
+		}
+		s.Relays[url] = r
+	}
+	for url, n := range l.RelayNotices {
+		r := relay(url)
+		r.Notices = n
+		s.Relays[url] = r
+	}
+	for url, latency := range l.RelayLatency {
+		r := relay(url)
+		r.Latency = latency
+		s.Relays[url] = r
+	}
+	return s
+}
+
+// ReadSnapshotFile reads an exported metrics file. Files without a schemaVersion are
+// upgraded from the legacy flat layout; files from a newer schema are rejected.
+func ReadSnapshotFile(path string) (Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read metrics file %s: %w", path, err)
+	}
+
+	var version struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &version); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to parse metrics file %s: %w", path, err)
+	}
+
+	switch version.SchemaVersion {
+	case 0:
+		var legacy legacySnapshot
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return Snapshot{}, fmt.Errorf("failed to parse legacy metrics file %s: %w", path, err)
+		}
+		return legacy.upgrade(), nil
+	case SchemaVersion:
+		var s Snapshot
+		if err := json.Unmarshal(data, &s); err != nil {
+			return Snapshot{}, fmt.Errorf("failed to parse metrics file %s: %w", path, err)
+		}
+		return s, nil
+	default:
+		return Snapshot{}, fmt.Errorf("metrics file %s has unsupported schema version %d (this build reads up to %d)", path, version.SchemaVersion, SchemaVersion)
+	}
+}
+
+// ExportFile describes a metrics file written by ExportToDir.
+type ExportFile struct {
+	Path   string
+	Prefix string    // Kind of run: "run", "error", "interrupted"
+	Time   time.Time // Export time from the file name, in local time
+}
+
+// ParseExportFileName extracts the prefix and export time from a file name of the form
+// metrics_<prefix>_<timestamp>.json. ok is false for any other file.
+func ParseExportFileName(name string) (prefix string, exportedAt time.Time, ok bool) {
+	base, hasPrefix := strings.CutPrefix(name, "metrics_")
+	base, hasSuffix := strings.CutSuffix(base, ".json")
+	if !hasPrefix || !hasSuffix || len(base) <= len(exportTimeLayout)+1 {
+		return "", time.Time{}, false
+	}
+	split := len(base) - len(exportTimeLayout)
+	if base[split-1] != '_' {
+		return "", time.Time{}, false
+	}
+	exportedAt, err := time.ParseInLocation(exportTimeLayout, base[split:], time.Local)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return base[:split-1], exportedAt, true
+}
+
+// ListExportFiles returns the metrics files in dir, oldest first.
+func ListExportFiles(dir string) ([]ExportFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics directory %s: %w", dir, err)
+	}
+	files := make([]ExportFile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		prefix, exportedAt, ok := ParseExportFileName(entry.Name())
+		if !ok {
+			continue
+		}
+		files = append(files, ExportFile{Path: filepath.Join(dir, entry.Name()), Prefix: prefix, Time: exportedAt})
+	}
+	// os.ReadDir sorts by name, and the prefix comes before the timestamp.
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Time.Before(files[j].Time) })
+	return files, nil
+}
+
+// PruneDir deletes the metrics files in dir exported before cutoff and returns their paths.
+func PruneDir(dir string, cutoff time.Time) ([]string, error) {
+	files, err := ListExportFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	removed := make([]string, 0)
+	for _, file := range files {
+		if !file.Time.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(file.Path); err != nil {
+			return removed, fmt.Errorf("failed to remove metrics file %s: %w", file.Path, err)
+		}
+		removed = append(removed, file.Path)
+	}
+	return removed, nil
+}
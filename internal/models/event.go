@@ -24,14 +24,16 @@ type apiEventRaw struct {
 	Date        time.Time `json:"Date"`
 	Title       string    `json:"Title"`
 	Description string    `json:"Description"`
-	Tags        string    `json:"Tags"`
-	Media       string    `json:"Media"`
-	References  string    `json:"References"`
-	Olas        bool      `json:"olas"`
+	Tags        string          `json:"Tags"`
+	Media       json.RawMessage `json:"Media"`
+	References  json.RawMessage `json:"References"`
+	Hashtags    []string        `json:"hashtags"`
+	Olas        bool            `json:"olas"`
 }
 
 // UnmarshalJSON provides custom unmarshalling logic for APIEvent.
 // It handles 'Media' and 'References' fields that can be either a JSON array string or a plain string.
+// Plain JSON arrays are accepted too, so an APIEvent survives a marshal/unmarshal round trip.
 func (ae *APIEvent) UnmarshalJSON(data []byte) error {
 	var raw apiEventRaw
 	if err := json.Unmarshal(data, &raw); err != nil {
@@ -43,27 +45,33 @@ func (ae *APIEvent) UnmarshalJSON(data []byte) error {
 	ae.Title = raw.Title
 	ae.Description = raw.Description
 	ae.Tags = raw.Tags
+	ae.Hashtags = raw.Hashtags
 	ae.Olas = raw.Olas
+	ae.Media = unmarshalStringList(raw.Media)
+	ae.References = unmarshalStringList(raw.References)
 
-	// Unmarshal Media string into []string
-	if raw.Media != "" && raw.Media != "[]" {
-		if err := json.Unmarshal([]byte(raw.Media), &ae.Media); err != nil {
-			ae.Media = []string{raw.Media}
-		}
-	} else {
-		ae.Media = []string{}
-	}
+	return nil
+}
 
-	// Unmarshal References string into []string
-	if raw.References != "" && raw.References != "[]" {
-		if err := json.Unmarshal([]byte(raw.References), &ae.References); err != nil {
-			ae.References = []string{raw.References}
-		}
-	} else {
-		ae.References = []string{}
+// unmarshalStringList decodes a field that is either a JSON array of strings,
+// a string containing a JSON array, or a plain string holding a single item.
+func unmarshalStringList(field json.RawMessage) []string {
+	var list []string
+	if err := json.Unmarshal(field, &list); err == nil && list != nil {
+		return list
 	}
 
-	return nil
+	var str string
+	if err := json.Unmarshal(field, &str); err != nil || str == "" || str == "[]" {
+		return []string{}
+	}
+	if err := json.Unmarshal([]byte(str), &list); err != nil {
+		return []string{str}
+	}
+	if list == nil {
+		return []string{}
+	}
+	return list
 }
 
 // APIResponseWrapper represents the full structure of the API response.
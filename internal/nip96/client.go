@@ -0,0 +1,318 @@
+package nip96
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"calendar-bot/internal/media"
+	"calendar-bot/internal/signer"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// processingAttempts and processingInterval bound how long an upload the server is
+	// still processing is waited for.
+	processingAttempts = 15
+	processingInterval = 2 * time.Second
+	// maxDelegations is how many delegated_to_url hops discovery follows.
+	maxDelegations = 2
+)
+
+// imetaFields are the NIP-94 tags of an upload's result that describe the stored file in
+// imeta tags. The bot's own alt text and summary are kept.
+var imetaFields = []string{"m", "x", "ox", "size", "dim", "blurhash", "thumb", "image", "fallback"}
+
+// ServerInfo is the part of a server's /.well-known/nostr/nip96.json the bot uses.
+type ServerInfo struct {
+	APIURL         string   `json:"api_url"`
+	DownloadURL    string   `json:"download_url,omitempty"`
+	DelegatedToURL string   `json:"delegated_to_url,omitempty"`
+	ContentTypes   []string `json:"content_types,omitempty"`
+}
+
+// accepts reports whether the server takes files of the given media type. Servers that
+// list no types take any.
+func (info ServerInfo) accepts(mediaType string) bool {
+	if len(info.ContentTypes) == 0 {
+		return true
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	return slices.ContainsFunc(info.ContentTypes, func(accepted string) bool {
+		return accepted == mediaType || accepted == major+"/*" || accepted == "*/*"
+	})
+}
+
+// uploadResponse is a server's answer to an upload or to a processing status request.
+type uploadResponse struct {
+	Status        string `json:"status"` // "success", "error" or "processing"
+	Message       string `json:"message"`
+	ProcessingURL string `json:"processing_url"`
+	Nip94Event    struct {
+		Tags nostr.Tags `json:"tags"`
+	} `json:"nip94_event"`
+}
+
+// Client uploads files to one NIP-96 HTTP file storage server, authorizing each upload
+// with a NIP-98 event (kind 27235) signed as the bot's identity.
+type Client struct {
+	server string
+	signer signer.Signer
+	http   *http.Client
+
+	mu   sync.Mutex
+	info *ServerInfo // Discovered on the first upload
+}
+
+// NewClient creates a client for the NIP-96 server at serverURL, e.g.
+// "https://nostr.build". Its upload URL is discovered when it is first needed.
+func NewClient(serverURL string, eventSigner signer.Signer) *Client {
+	return &Client{
+		server: strings.TrimRight(serverURL, "/"),
+		signer: eventSigner,
+		http:   &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Server returns the server's base URL.
+func (c *Client) Server() string {
+	return c.server
+}
+
+// Store uploads the downloaded image to the server, asking it to keep the file as it is.
+// The NIP-94 tags the server returns describe the copy; servers that convert images
+// anyway report the new hash, type and dimensions there.
+func (c *Client) Store(ctx context.Context, img media.Image, download func(ctx context.Context) ([]byte, error)) (media.Stored, error) {
+	info, err := c.Discover(ctx)
+	if err != nil {
+		return media.Stored{}, err
+	}
+	if !info.accepts(img.MediaType) {
+		return media.Stored{}, fmt.Errorf("NIP-96 server %s does not accept %s files", c.server, img.MediaType)
+	}
+	data, err := download(ctx)
+	if err != nil {
+		return media.Stored{}, err
+	}
+	sum := sha256.Sum256(data)
+	if hash := hex.EncodeToString(sum[:]); hash != img.SHA256 {
+		// The original changed since it was inspected; its imeta would describe another image
+		return media.Stored{}, fmt.Errorf("%s changed while it was being stored", img.URL)
+	}
+
+	resp, err := c.upload(ctx, info.APIURL, data, img)
+	if err != nil {
+		return media.Stored{}, err
+	}
+	processingURL := resp.ProcessingURL // Status answers need not repeat it
+	for attempt := 1; resp.Status == "processing"; attempt++ {
+		if processingURL == "" {
+			return media.Stored{}, fmt.Errorf("NIP-96 server %s is processing %s but names no processing_url", c.server, img.URL)
+		}
+		if attempt > processingAttempts {
+			return media.Stored{}, fmt.Errorf("NIP-96 server %s is still processing %s", c.server, img.URL)
+		}
+		select {
+		case <-ctx.Done():
+			return media.Stored{}, ctx.Err()
+		case <-time.After(processingInterval):
+		}
+		if resp, err = c.processingStatus(ctx, processingURL); err != nil {
+			return media.Stored{}, err
+		}
+	}
+
+	tags := resp.Nip94Event.Tags
+	url := tags.Find("url")
+	if url == nil || url[1] == "" {
+		return media.Stored{}, fmt.Errorf("NIP-96 server %s returned no URL for %s", c.server, img.URL)
+	}
+	if ox := tags.Find("ox"); ox != nil && ox[1] != img.SHA256 {
+		return media.Stored{}, fmt.Errorf("NIP-96 server %s stored file %s, expected %s", c.server, ox[1], img.SHA256)
+	}
+	stored := media.Stored{URL: url[1]}
+	for _, tag := range tags {
+		if len(tag) >= 2 && tag[1] != "" && slices.Contains(imetaFields, tag[0]) {
+			stored.Fields = append(stored.Fields, tag[0]+" "+tag[1])
+		}
+	}
+	return stored, nil
+}
+
+// Discover returns the server's upload settings from its /.well-known/nostr/nip96.json,
+// following a delegation to another server. The result is kept for later uploads; a
+// failed discovery is tried again on the next upload.
+func (c *Client) Discover(ctx context.Context) (ServerInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.info != nil {
+		return *c.info, nil
+	}
+
+	server := c.server
+	for range maxDelegations + 1 {
+		info, err := c.fetchInfo(ctx, server)
+		if err != nil {
+			return ServerInfo{}, err
+		}
+		if info.APIURL != "" {
+			log.Debug().Str("server", c.server).Str("apiURL", info.APIURL).Msg("Discovered NIP-96 upload URL.")
+			c.info = &info
+			return info, nil
+		}
+		if info.DelegatedToURL == "" {
+			return ServerInfo{}, fmt.Errorf("NIP-96 server %s declares neither api_url nor delegated_to_url", server)
+		}
+		server = strings.TrimRight(info.DelegatedToURL, "/")
+	}
+	return ServerInfo{}, fmt.Errorf("NIP-96 server %s delegates more than %d times", c.server, maxDelegations)
+}
+
+func (c *Client) fetchInfo(ctx context.Context, server string) (ServerInfo, error) {
+	infoURL := server + "/.well-known/nostr/nip96.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, infoURL, nil)
+	if err != nil {
+		return ServerInfo{}, fmt.Errorf("failed to create request for %s: %w", infoURL, err)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return ServerInfo{}, fmt.Errorf("failed to discover NIP-96 server %s: %w", server, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ServerInfo{}, fmt.Errorf("%s returned status %d", infoURL, resp.StatusCode)
+	}
+	var info ServerInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return ServerInfo{}, fmt.Errorf("failed to decode %s: %w", infoURL, err)
+	}
+	return info, nil
+}
+
+// upload posts the image as multipart/form-data to the server's api_url.
+func (c *Client) upload(ctx context.Context, apiURL string, data []byte, img media.Image) (uploadResponse, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", uploadFilename(img))
+	if err != nil {
+		return uploadResponse{}, fmt.Errorf("failed to encode upload: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		return uploadResponse{}, fmt.Errorf("failed to encode upload: %w", err)
+	}
+	for _, field := range [][2]string{
+		{"size", strconv.Itoa(len(data))},
+		{"content_type", img.MediaType},
+		{"no_transform", "true"},
+	} {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return uploadResponse{}, fmt.Errorf("failed to encode upload: %w", err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		return uploadResponse{}, fmt.Errorf("failed to encode upload: %w", err)
+	}
+
+	auth, err := c.authorization(ctx, apiURL, http.MethodPost, img.SHA256)
+	if err != nil {
+		return uploadResponse{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, &body)
+	if err != nil {
+		return uploadResponse{}, fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", auth)
+	return c.do(req)
+}
+
+// processingStatus asks the server how far an upload it accepted for processing got.
+func (c *Client) processingStatus(ctx context.Context, processingURL string) (uploadResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, processingURL, nil)
+	if err != nil {
+		return uploadResponse{}, fmt.Errorf("failed to create request for %s: %w", processingURL, err)
+	}
+	return c.do(req)
+}
+
+// authorization returns the NIP-98 Authorization header of a request to requestURL.
+// payload is the hex SHA-256 of the uploaded file.
+func (c *Client) authorization(ctx context.Context, requestURL string, method string, payload string) (string, error) {
+	ev := nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindHTTPAuth,
+		Tags: nostr.Tags{
+			{"u", requestURL},
+			{"method", method},
+			{"payload", payload},
+		},
+	}
+	if err := c.signer.Sign(ctx, &ev); err != nil {
+		return "", fmt.Errorf("failed to sign NIP-98 authorization: %w", err)
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode NIP-98 authorization: %w", err)
+	}
+	return "Nostr " + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// do sends a request and decodes the server's answer, turning error answers into errors.
+func (c *Client) do(req *http.Request) (uploadResponse, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return uploadResponse{}, fmt.Errorf("NIP-96 request to %s failed: %w", req.URL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return uploadResponse{}, fmt.Errorf("failed to read answer of %s: %w", req.URL, err)
+	}
+	var answer uploadResponse
+	decodeErr := json.Unmarshal(body, &answer)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || answer.Status == "error" {
+		message := answer.Message
+		if decodeErr != nil || message == "" {
+			message = strings.TrimSpace(string(body[:min(len(body), 512)]))
+		}
+		return uploadResponse{}, fmt.Errorf("NIP-96 server %s returned status %d: %s", req.URL, resp.StatusCode, message)
+	}
+	if decodeErr != nil {
+		return uploadResponse{}, fmt.Errorf("failed to decode answer of %s: %w", req.URL, decodeErr)
+	}
+	switch {
+	case answer.Status == "processing" || (answer.Status == "" && resp.StatusCode == http.StatusAccepted):
+		answer.Status = "processing"
+	case answer.Status == "success" || (answer.Status == "" && len(answer.Nip94Event.Tags) > 0):
+		answer.Status = "success"
+	default:
+		return uploadResponse{}, fmt.Errorf("NIP-96 server %s returned unknown status '%s'", req.URL, answer.Status)
+	}
+	return answer, nil
+}
+
+// uploadFilename names the uploaded file after the original URL, or after its hash if the
+// URL does not end in a file name.
+func uploadFilename(img media.Image) string {
+	name := path.Base(strings.SplitN(img.URL, "?", 2)[0])
+	if name == "" || name == "." || name == "/" || !strings.Contains(name, ".") {
+		return img.SHA256
+	}
+	return name
+}
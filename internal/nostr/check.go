@@ -0,0 +1,42 @@
+package nostr
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// RelayCheck is the result of a connectivity check against one relay.
+type RelayCheck struct {
+	URL         string
+	Connected   bool
+	ConnectTime time.Duration
+	Err         error
+}
+
+// CheckRelays opens a connection to every relay concurrently and closes it again,
+// reporting which relays are reachable and how long the handshake took.
+// Results are returned in the order the relays were given.
+func CheckRelays(ctx context.Context, relays []string, timeout time.Duration) []RelayCheck {
+	checks := make([]RelayCheck, len(relays))
+	var wg sync.WaitGroup
+	for i, relayURL := range relays {
+		wg.Add(1)
+		go func(i int, relayURL string) {
+			defer wg.Done()
+			connectCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			start := time.Now()
+			relay, err := nostr.RelayConnect(connectCtx, relayURL)
+			checks[i] = RelayCheck{URL: relayURL, ConnectTime: time.Since(start), Err: err}
+			if err == nil {
+				checks[i].Connected = true
+				relay.Close()
+			}
+		}(i, relayURL)
+	}
+	wg.Wait()
+	return checks
+}
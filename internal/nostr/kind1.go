@@ -8,12 +8,17 @@ import (
 	"github.com/nbd-wtf/go-nostr"
 )
 
-// CreateKind1NostrEvent creates a Nostr kind 1 text event from an APIEvent.
-func CreateKind1NostrEvent(apiEvent models.APIEvent, processedTags []string, processedReferences []string) (nostr.Event, error) {
+// CreateKind1NostrEvent creates a Nostr kind 1 text event from an APIEvent: a teaser with
+// the title, a shortened description and the media URLs, linking to the event's NIP-23
+// article, which carries the full description and the references. Without an article
+// link (e.g. in a preview without the bot's pubkey) the teaser has no link.
+func CreateKind1NostrEvent(apiEvent models.APIEvent, processedTags []string, article ArticleLink) (nostr.Event, error) {
 	var finalMessageBuilder strings.Builder
 	finalMessageBuilder.WriteString(apiEvent.Title)
-	finalMessageBuilder.WriteString("\n\n")
-	finalMessageBuilder.WriteString(apiEvent.Description)
+	if summary := Summarize(apiEvent.Description, summaryLength); summary != "" {
+		finalMessageBuilder.WriteString("\n\n")
+		finalMessageBuilder.WriteString(summary)
+	}
 
 	if len(apiEvent.Media) > 0 {
 		finalMessageBuilder.WriteString("\n")
@@ -25,29 +30,18 @@ func CreateKind1NostrEvent(apiEvent models.APIEvent, processedTags []string, pro
 		}
 	}
 
-	if len(processedReferences) > 0 {
-		finalMessageBuilder.WriteString("\n")
-		for _, ref := range processedReferences {
-			if ref != "" {
-				finalMessageBuilder.WriteString("\n")
-				finalMessageBuilder.WriteString(ref)
-			}
-		}
+	if article.NAddr != "" {
+		finalMessageBuilder.WriteString("\n\nnostr:")
+		finalMessageBuilder.WriteString(article.NAddr)
 	}
 	message := finalMessageBuilder.String()
 
-	defaultTags := []string{"bitcoin", "history", "onthisday", "calendar", "bitcoincalendar", "bitcoinhistory", "autopost"}
-	allEventTags := nostr.Tags{}
-
-	for _, t := range defaultTags {
-		allEventTags = append(allEventTags, nostr.Tag{"t", strings.ToLower(t)})
-	}
-	for _, apiTag := range processedTags {
-		if apiTag != "" {
-			allEventTags = append(allEventTags, nostr.Tag{"t", strings.ToLower(apiTag)})
-		}
-	}
+	allEventTags := hashtagTags(processedTags)
 	allEventTags = append(allEventTags, nostr.Tag{"d", apiEvent.Date.Format("2006-01-02")})
+	if article.Address != "" {
+		// NIP-27: tag what the content mentions, so clients can notify and fetch it
+		allEventTags = append(allEventTags, nostr.Tag{"a", article.Address})
+	}
 
 	ev := nostr.Event{
 		CreatedAt: nostr.Now(),
@@ -1,14 +1,16 @@
 package nostr
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
-	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"calendar-bot/internal/media"
 	"calendar-bot/internal/models"
 
 	"github.com/nbd-wtf/go-nostr"
@@ -17,143 +19,258 @@ import (
 
 // --- Image Validation ---
 
-// ImageValidator provides methods to validate image URLs for NIP-68 events.
-type ImageValidator struct{}
-
-// NewImageValidator creates a new ImageValidator.
-func NewImageValidator() *ImageValidator {
-	return &ImageValidator{}
+// imageCacheTTL is how long an inspected image is reused, so the kinds built for one API
+// event share one download while a long-running daemon still notices changed images.
+const imageCacheTTL = time.Hour
+
+// downloadFailureTTL is how long a failed download is reused instead of imageCacheTTL:
+// long enough that the kinds of one API event do not retry it one after another, short
+// enough that a host that was briefly down is tried again.
+const downloadFailureTTL = 5 * time.Minute
+
+// ImageValidator downloads and inspects media URLs for NIP-68 picture and NIP-71 video
+// events. The format is sniffed from the downloaded bytes, not guessed from the URL's
+// extension, and decides whether the URL is a video or an image. It is safe for
+// concurrent use: lookups of one URL share one download, other URLs do not wait for it.
+type ImageValidator struct {
+	fetcher *media.Fetcher
+
+	mu       sync.Mutex
+	cache    map[string]cachedImage // Media URL -> inspection result
+	inflight map[string]*inspection // Media URL -> download in progress
+	prunedAt time.Time              // When expired results were last removed from cache
 }
 
-var supportedImageFormats = map[string]string{
-	".jpg":  "image/jpeg",
-	".jpeg": "image/jpeg",
-	".png":  "image/png",
-	".gif":  "image/gif",
-	".webp": "image/webp",
-	".avif": "image/avif",
-	".apng": "image/apng",
+type cachedImage struct {
+	image     media.Image
+	video     media.Video
+	isVideo   bool // The bytes are a video; err is about the video then
+	err       error
+	fetchedAt time.Time
 }
 
-// IsValidImageURL checks if the URL points to a supported image format based on extension.
-func (iv *ImageValidator) IsValidImageURL(imageURL string) bool {
-	u, err := url.Parse(imageURL)
-	if err != nil {
-		log.Warn().Err(err).Str("url", imageURL).Msg("Failed to parse image URL")
-		return false
+// expired reports whether the result is too old to be reused at now.
+func (c cachedImage) expired(now time.Time) bool {
+	ttl := imageCacheTTL
+	if c.err != nil && media.Reason(c.err) == "download_failed" {
+		ttl = downloadFailureTTL
 	}
-	ext := strings.ToLower(fileExtension(u.Path))
-	_, supported := supportedImageFormats[ext]
-	if !supported {
-		log.Debug().Str("url", imageURL).Str("extension", ext).Msg("Unsupported image extension")
-	}
-	return supported
+	return now.Sub(c.fetchedAt) >= ttl
 }
 
-// GetMediaType returns the IANA media type for a given image URL based on its extension.
-// Returns an empty string if the format is not supported or URL is invalid.
-func (iv *ImageValidator) GetMediaType(imageURL string) string {
-	u, err := url.Parse(imageURL)
-	if err != nil {
-		log.Warn().Err(err).Str("url", imageURL).Msg("Failed to parse image URL for media type")
-		return ""
+// inspection is a download in progress that lookups of the same URL wait for.
+type inspection struct {
+	done   chan struct{} // Closed once result is set
+	result cachedImage
+}
+
+// NewImageValidator creates a new ImageValidator that refuses videos larger than
+// maxVideoBytes and images larger than maxBytes.
+func NewImageValidator(maxBytes int64, maxVideoBytes int64) *ImageValidator {
+	return &ImageValidator{
+		fetcher:  media.NewFetcher(maxBytes, maxVideoBytes),
+		cache:    make(map[string]cachedImage),
+		inflight: make(map[string]*inspection),
+		prunedAt: time.Now(),
 	}
-	ext := strings.ToLower(fileExtension(u.Path))
-	mediaType, ok := supportedImageFormats[ext]
-	if !ok {
-		log.Debug().Str("url", imageURL).Str("extension", ext).Msg("Cannot determine media type for unsupported extension")
-		return ""
+}
+
+// inspect returns the inspection result of mediaURL, downloading it unless a result,
+// including a failure, is cached and not expired. Concurrent lookups of the same URL
+// wait for one download; a lookup whose ctx is cancelled returns without waiting.
+func (iv *ImageValidator) inspect(ctx context.Context, mediaURL string) cachedImage {
+	for {
+		iv.mu.Lock()
+		if cached, ok := iv.cache[mediaURL]; ok && !cached.expired(time.Now()) {
+			iv.mu.Unlock()
+			return cached
+		}
+		call, ok := iv.inflight[mediaURL]
+		if !ok {
+			call = &inspection{done: make(chan struct{})}
+			iv.inflight[mediaURL] = call
+			iv.mu.Unlock()
+			return iv.fetch(ctx, mediaURL, call)
+		}
+		iv.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return cachedImage{err: fmt.Errorf("%s: %w", mediaURL, ctx.Err())}
+		}
+		if !errors.Is(call.result.err, context.Canceled) && !errors.Is(call.result.err, context.DeadlineExceeded) {
+			return call.result
+		}
+		// The lookup that downloaded was cancelled; download again for this one
+		if err := ctx.Err(); err != nil {
+			return cachedImage{err: fmt.Errorf("%s: %w", mediaURL, err)}
+		}
 	}
-	return mediaType
 }
 
-// ValidateImageAccessibility checks if the image URL is accessible via a HEAD request.
-// This is a basic check and doesn't download the image.
-func (iv *ImageValidator) ValidateImageAccessibility(imageURL string) error {
-	client := http.Client{Timeout: 10 * time.Second} // Short timeout for HEAD request
-	req, err := http.NewRequest("HEAD", imageURL, nil)
-	if err != nil {
-		log.Warn().Err(err).Str("url", imageURL).Msg("Failed to create HEAD request for image accessibility validation")
-		return fmt.Errorf("failed to create HEAD request for %s: %w", imageURL, err)
+// fetch downloads and inspects mediaURL for call, then caches the result unless ctx was
+// cancelled meanwhile, and wakes up the lookups waiting for it.
+func (iv *ImageValidator) fetch(ctx context.Context, mediaURL string, call *inspection) cachedImage {
+	img, video, isVideo, err := iv.fetcher.FetchMedia(ctx, mediaURL)
+	switch {
+	case err != nil:
+		log.Debug().Err(err).Str("url", mediaURL).Bool("video", isVideo).Msg("Media failed validation.")
+	case isVideo:
+		log.Debug().Str("url", mediaURL).Str("mediaType", video.MediaType).Int64("size", video.Size).Str("dim", video.Dim()).Dur("duration", video.Duration).Msg("Video inspected.")
+	default:
+		log.Debug().Str("url", mediaURL).Str("mediaType", img.MediaType).Int64("size", img.Size).Str("dim", img.Dim()).Msg("Image inspected.")
 	}
+	call.result = cachedImage{image: img, video: video, isVideo: isVideo, err: err, fetchedAt: time.Now()}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Warn().Err(err).Str("url", imageURL).Msg("Failed to perform HEAD request for image accessibility validation")
-		return fmt.Errorf("failed to access image URL %s: %w", imageURL, err)
+	iv.mu.Lock()
+	delete(iv.inflight, mediaURL)
+	if ctx.Err() == nil {
+		iv.store(mediaURL, call.result)
 	}
-	defer resp.Body.Close()
+	iv.mu.Unlock()
+	close(call.done)
+	return call.result
+}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Warn().Str("url", imageURL).Int("statusCode", resp.StatusCode).Msg("Image not accessible or returned non-OK status")
-		return fmt.Errorf("image at %s returned status %d", imageURL, resp.StatusCode)
+// store caches result under mediaURL and, at most once per imageCacheTTL, removes the
+// expired results, so a long-running daemon does not keep every URL it ever saw.
+// The caller holds iv.mu.
+func (iv *ImageValidator) store(mediaURL string, result cachedImage) {
+	iv.cache[mediaURL] = result
+	now := time.Now()
+	if now.Sub(iv.prunedAt) < imageCacheTTL {
+		return
 	}
-	log.Debug().Str("url", imageURL).Msg("Image accessibility check passed (HEAD request successful)")
-	return nil
+	for url, cached := range iv.cache {
+		if cached.expired(now) {
+			delete(iv.cache, url)
+		}
+	}
+	iv.prunedAt = now
 }
 
-// helper to get file extension
-func fileExtension(path string) string {
-	parts := strings.Split(path, ".")
-	if len(parts) > 1 {
-		return "." + parts[len(parts)-1]
+// Inspect downloads the image at imageURL and returns its media type, hash, size,
+// dimensions and blurhash. Successes and failures about the content are reused for
+// imageCacheTTL, failed downloads for downloadFailureTTL. Videos are reported as
+// media.ErrVideo.
+func (iv *ImageValidator) Inspect(ctx context.Context, imageURL string) (media.Image, error) {
+	cached := iv.inspect(ctx, imageURL)
+	if cached.isVideo {
+		return media.Image{}, fmt.Errorf("%s: %w", imageURL, media.ErrVideo)
 	}
-	return ""
+	return cached.image, cached.err
+}
+
+// InspectVideo downloads the media at videoURL and, if it is a video, returns its media
+// type, hash, size, dimensions and duration. isVideo is false for images and for URLs
+// that could not be downloaded; err is set for videos that failed inspection. Results
+// are shared with Inspect.
+func (iv *ImageValidator) InspectVideo(ctx context.Context, videoURL string) (video media.Video, isVideo bool, err error) {
+	cached := iv.inspect(ctx, videoURL)
+	return cached.video, cached.isVideo, cached.err
+}
+
+// Remember caches an image inspected elsewhere under its URL, e.g. a copy of an inspected
+// image on the bot's media server, so it is not downloaded again.
+func (iv *ImageValidator) Remember(img media.Image) {
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+	iv.store(img.URL, cachedImage{image: img, fetchedAt: time.Now()})
+}
+
+// Download returns the bytes served at mediaURL, within the same size limits as Inspect.
+func (iv *ImageValidator) Download(ctx context.Context, mediaURL string) ([]byte, error) {
+	return iv.fetcher.Download(ctx, mediaURL)
+}
+
+// IsValidImageURL reports whether the URL serves an image in a supported format within
+// the size limit.
+func (iv *ImageValidator) IsValidImageURL(ctx context.Context, imageURL string) bool {
+	_, err := iv.Inspect(ctx, imageURL)
+	return err == nil
 }
 
 // --- Kind 20 Event Structure & Creation ---
 
+// DefaultMaxImages is the default limit on the images of one picture event.
+const DefaultMaxImages = 4
+
 // Kind20EventData represents the data needed to create a NIP-68 picture event.
 // Note: `Tags` here are additional non-standard tags. Standard NIP-68 tags like `imeta`, `title`, `m` are handled by methods.
 // `Date` here is the original event date string (YYYY-MM-DD) for the `d` tag.
 // The struct name was changed to Kind20EventData to avoid conflict with nostr.Event type.
 type Kind20EventData struct {
-	Title       string   // From APIEvent.Title
-	Description string   // From APIEvent.Description, used for summary tag
-	ImageURL    string   // From APIEvent.Media
-	MediaType   string   // Determined by ImageValidator
-	Hashtags    []string // From APIEvent.Tags (parsed)
-	References  []string // From APIEvent.References (parsed), for `r` tags
-	EventDate   string   // YYYY-MM-DD for `d` tag, from APIEvent.Date
-	// Potentially add other fields like Blurhash if we implement that.
+	Title       string        // From APIEvent.Title
+	Description string        // From APIEvent.Description, used for summary tag
+	Images      []media.Image // From APIEvent.Media in order, inspected by ImageValidator
+	Alt         string        // Accessible description of the images, for the imeta `alt` fields
+	Hashtags    []string      // From APIEvent.Tags (parsed)
+	References  []string      // From APIEvent.References (parsed), for `r` tags
+	EventDate   string        // YYYY-MM-DD for `d` tag, from APIEvent.Date
+}
+
+// imetaTag returns the NIP-92 imeta tag describing one image, with every field known.
+func (k20 *Kind20EventData) imetaTag(image media.Image) nostr.Tag {
+	tag := nostr.Tag{"imeta", "url " + image.URL, "m " + image.MediaType, "x " + image.SHA256}
+	if dim := image.Dim(); dim != "" {
+		tag = append(tag, "dim "+dim)
+	}
+	tag = append(tag, "size "+strconv.FormatInt(image.Size, 10))
+	if image.Blurhash != "" {
+		tag = append(tag, "blurhash "+image.Blurhash)
+	}
+	for _, field := range image.Extra {
+		if k20.Alt != "" && strings.HasPrefix(field, "alt ") {
+			continue // The event's own alt text wins
+		}
+		tag = append(tag, field)
+	}
+	if k20.Alt != "" {
+		tag = append(tag, "alt "+k20.Alt)
+	}
+	return tag
 }
 
 // ToNostrEvent converts Kind20EventData into a nostr.Event (Kind 20).
 // It builds the required NIP-68 tags.
 func (k20 *Kind20EventData) ToNostrEvent() (nostr.Event, error) {
-	if k20.ImageURL == "" || k20.MediaType == "" {
-		return nostr.Event{}, fmt.Errorf("imageURL and mediaType are required for Kind 20 event")
+	if len(k20.Images) == 0 {
+		return nostr.Event{}, fmt.Errorf("at least one inspected image is required for Kind 20 event")
+	}
+	for _, image := range k20.Images {
+		if image.URL == "" || image.MediaType == "" || image.SHA256 == "" {
+			return nostr.Event{}, fmt.Errorf("image %q was not inspected", image.URL)
+		}
 	}
 
 	allTags := nostr.Tags{}
 
-	// Required NIP-68 tags
+	// Required NIP-68 tags, one imeta per image in display order
 	allTags = append(allTags, nostr.Tag{"title", k20.Title})
-	allTags = append(allTags, nostr.Tag{"imeta", "url " + k20.ImageURL})
-	// Add SHA256 hash of the image URL as per NIP-68 recommendation for "imeta"
-	hash := sha256.Sum256([]byte(k20.ImageURL))
-	allTags = append(allTags, nostr.Tag{"imeta", "x " + hex.EncodeToString(hash[:])})
+	for _, image := range k20.Images {
+		allTags = append(allTags, k20.imetaTag(image))
+	}
 
 	// Optional NIP-68 tags
 	if k20.Description != "" {
 		allTags = append(allTags, nostr.Tag{"summary", k20.Description})
 	}
 
-	// Media type tag
-	allTags = append(allTags, nostr.Tag{"m", k20.MediaType})
-
-	// Default tags
-	defaultTags := []string{"bitcoin", "history", "onthisday", "calendar", "bitcoincalendar", "bitcoinhistory", "autopost"}
-	for _, t := range defaultTags {
-		allTags = append(allTags, nostr.Tag{"t", strings.ToLower(t)})
-	}
-
-	// Preserve existing hashtags (`t` tags)
-	for _, ht := range k20.Hashtags {
-		if ht != "" {
-			allTags = append(allTags, nostr.Tag{"t", strings.ToLower(ht)})
+	// Media type and hash tags, so clients can filter and query by them
+	var mediaTypes []string
+	for _, image := range k20.Images {
+		if !slices.Contains(mediaTypes, image.MediaType) {
+			mediaTypes = append(mediaTypes, image.MediaType)
+			allTags = append(allTags, nostr.Tag{"m", image.MediaType})
 		}
 	}
+	for _, image := range k20.Images {
+		allTags = append(allTags, nostr.Tag{"x", image.SHA256})
+	}
+
+	// Default tags, then the existing hashtags (`t` tags)
+	allTags = append(allTags, hashtagTags(k20.Hashtags)...)
 
 	// Preserve existing references (`r` tags)
 	for _, ref := range k20.References {
@@ -167,9 +284,6 @@ func (k20 *Kind20EventData) ToNostrEvent() (nostr.Event, error) {
 		allTags = append(allTags, nostr.Tag{"d", k20.EventDate})
 	}
 
-	// Add any other specific NIP-68 tags if needed (e.g., thumb, blurhash, dimensions)
-	// For now, sticking to the basic requirements plus image hash.
-
 	// Assuming Title and Description will always be present for qualifying events.
 	content := fmt.Sprintf("%s\n\n%s", k20.Title, k20.Description)
 
@@ -183,13 +297,18 @@ func (k20 *Kind20EventData) ToNostrEvent() (nostr.Event, error) {
 }
 
 // CreateKind20NostrEvent prepares and returns a Kind 20 Nostr event if the API event qualifies.
-// It uses ImageValidator for image checks.
+// It uses ImageValidator for image checks and includes every valid image of the API
+// event's media, in order and without duplicates, up to maxImages. Each media URL that
+// fails validation is passed to onInvalid, if set; videos are left to the video events.
 // Returns the event, a boolean indicating if it qualified, and an error if creation failed.
 func CreateKind20NostrEvent(
+	ctx context.Context,
 	apiEvent models.APIEvent,
 	processedTags []string,
 	processedReferences []string,
 	validator *ImageValidator,
+	maxImages int,
+	onInvalid func(mediaURL string, err error),
 ) (event nostr.Event, qualified bool, err error) {
 
 	if len(apiEvent.Media) == 0 {
@@ -197,39 +316,45 @@ func CreateKind20NostrEvent(
 		return nostr.Event{}, false, nil
 	}
 
-	var validMediaURL string
-	var mediaType string
-
+	var images []media.Image
 	for _, mediaURL := range apiEvent.Media {
-		if mediaURL == "" {
+		if len(images) == maxImages {
+			log.Info().Uint("apiEventID", apiEvent.ID).Int("maxImages", maxImages).Msg("Kind 20: Image limit reached. Leaving out the remaining media URLs.")
+			break
+		}
+		if mediaURL == "" || slices.ContainsFunc(images, func(image media.Image) bool { return image.URL == mediaURL }) {
+			continue
+		}
+		image, err := validator.Inspect(ctx, mediaURL)
+		if errors.Is(err, media.ErrVideo) {
+			log.Debug().Uint("apiEventID", apiEvent.ID).Str("mediaURL", mediaURL).Msg("Kind 20: Skipped media item, a video for the video event.")
 			continue
 		}
-		if validator.IsValidImageURL(mediaURL) {
-			currentMediaType := validator.GetMediaType(mediaURL)
-			if currentMediaType != "" {
-				validMediaURL = mediaURL
-				mediaType = currentMediaType
-				log.Info().Uint("apiEventID", apiEvent.ID).Str("selectedMediaURL", validMediaURL).Msg("Kind 20: Selected first valid media URL for event.")
-				break // Found a valid media URL, use this one
-			} else {
-				log.Warn().Uint("apiEventID", apiEvent.ID).Str("mediaURL", mediaURL).Msg("Kind 20: Media URL valid but could not determine media type.")
+		if err != nil {
+			log.Warn().Err(err).Uint("apiEventID", apiEvent.ID).Str("mediaURL", mediaURL).Msg("Kind 20: Skipped media item, not a supported image.")
+			if onInvalid != nil {
+				onInvalid(mediaURL, err)
 			}
-		} else {
-			log.Warn().Uint("apiEventID", apiEvent.ID).Str("mediaURL", mediaURL).Msg("Kind 20: Skipped media item, invalid or unsupported image format.")
+			continue
+		}
+		if slices.ContainsFunc(images, func(other media.Image) bool { return other.SHA256 == image.SHA256 }) {
+			log.Debug().Uint("apiEventID", apiEvent.ID).Str("mediaURL", mediaURL).Msg("Kind 20: Skipped media item, same image as an earlier URL.")
+			continue
 		}
+		images = append(images, image)
 	}
 
-	if validMediaURL == "" {
+	if len(images) == 0 {
 		log.Warn().Uint("apiEventID", apiEvent.ID).Interface("mediaURLs", apiEvent.Media).Msg("Kind 20: Skipped, no valid media URL found in the provided list that meets criteria.")
 		return nostr.Event{}, false, nil
 	}
+	log.Info().Uint("apiEventID", apiEvent.ID).Int("images", len(images)).Msg("Kind 20: Selected valid media URLs for event.")
 
-	// The rest of the function now uses validMediaURL and mediaType
 	k20Data := Kind20EventData{
 		Title:       apiEvent.Title,
 		Description: apiEvent.Description, // Used for summary tag
-		ImageURL:    validMediaURL,        // Use the validated media URL
-		MediaType:   mediaType,            // Use the determined media type
+		Images:      images,
+		Alt:         apiEvent.Title,
 		Hashtags:    processedTags,
 		References:  processedReferences,
 		EventDate:   apiEvent.Date.Format("2006-01-02"),
@@ -0,0 +1,142 @@
+package nostr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"calendar-bot/internal/media"
+)
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageValidatorSharesOneDownloadPerURL(t *testing.T) {
+	data := testPNG(t)
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	iv := NewImageValidator(media.DefaultMaxBytes, media.DefaultMaxVideoBytes)
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := iv.Inspect(context.Background(), server.URL+"/a.png")
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond) // Let every lookup join the download
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Inspect: %v", err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+
+	img, err := iv.Inspect(context.Background(), server.URL+"/a.png")
+	if err != nil || img.Dim() != "4x3" {
+		t.Errorf("cached Inspect = %q, %v; want 4x3, nil", img.Dim(), err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("got %d requests after a cached lookup, want 1", n)
+	}
+}
+
+func TestImageValidatorDoesNotBlockOtherURLs(t *testing.T) {
+	data := testPNG(t)
+	stall := make(chan struct{})
+	defer close(stall)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow.png" {
+			select {
+			case <-stall:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	iv := NewImageValidator(media.DefaultMaxBytes, media.DefaultMaxVideoBytes)
+	slowCtx, cancel := context.WithCancel(context.Background())
+	slowDone := make(chan error, 1)
+	go func() {
+		_, err := iv.Inspect(slowCtx, server.URL+"/slow.png")
+		slowDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	if !iv.IsValidImageURL(context.Background(), server.URL+"/fast.png") {
+		t.Error("fast image is not valid while another URL stalls")
+	}
+
+	cancel()
+	select {
+	case err := <-slowDone:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("stalled Inspect returned %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled Inspect did not return after its context was cancelled")
+	}
+
+	// A cancelled lookup is not cached as a failure
+	iv.mu.Lock()
+	_, cached := iv.cache[server.URL+"/slow.png"]
+	iv.mu.Unlock()
+	if cached {
+		t.Error("cancelled download was cached")
+	}
+}
+
+func TestCachedImageExpired(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		cached  cachedImage
+		age     time.Duration
+		expired bool
+	}{
+		{"fresh image", cachedImage{}, time.Minute, false},
+		{"old image", cachedImage{}, imageCacheTTL, true},
+		{"content failure within the hour", cachedImage{err: media.ErrUndecodable}, 30 * time.Minute, false},
+		{"download failure within the retry delay", cachedImage{err: errors.New("connection refused")}, time.Minute, false},
+		{"download failure after the retry delay", cachedImage{err: errors.New("connection refused")}, downloadFailureTTL, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cached.fetchedAt = now.Add(-tt.age)
+			if got := tt.cached.expired(now); got != tt.expired {
+				t.Errorf("expired() = %v, want %v", got, tt.expired)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package nostr
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"calendar-bot/internal/media"
+	"calendar-bot/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/rs/zerolog/log"
+)
+
+// NIP-71 video event kinds.
+const (
+	KindVideo      = 21 // Normal video
+	KindShortVideo = 22 // Short-form portrait video, like stories and reels
+)
+
+// ShortVideoMaxDuration is the longest portrait video posted as a short video (kind 22).
+const ShortVideoMaxDuration = 3 * time.Minute
+
+// VideoKind returns the kind a video is posted as: portrait videos known to last at most
+// ShortVideoMaxDuration are short videos, all others normal ones, including portrait
+// videos whose duration could not be read.
+func VideoKind(video media.Video) int {
+	if video.Portrait() && video.Duration > 0 && video.Duration <= ShortVideoMaxDuration {
+		return KindShortVideo
+	}
+	return KindVideo
+}
+
+// SelectVideo returns the first video among the API event's media URLs, inspected by the
+// validator, and whether there is one. Each video that fails inspection is passed to
+// onInvalid, if set; images and URLs that cannot be downloaded are left to the picture event.
+func SelectVideo(ctx context.Context, apiEvent models.APIEvent, validator *ImageValidator, onInvalid func(mediaURL string, err error)) (media.Video, bool) {
+	for _, mediaURL := range apiEvent.Media {
+		if mediaURL == "" {
+			continue
+		}
+		video, isVideo, err := validator.InspectVideo(ctx, mediaURL)
+		if !isVideo {
+			continue
+		}
+		if err != nil {
+			log.Warn().Err(err).Uint("apiEventID", apiEvent.ID).Str("mediaURL", mediaURL).Msg("Video event: Skipped media item, not a supported video.")
+			if onInvalid != nil {
+				onInvalid(mediaURL, err)
+			}
+			continue
+		}
+		log.Info().Uint("apiEventID", apiEvent.ID).Str("mediaURL", mediaURL).Str("dim", video.Dim()).Dur("duration", video.Duration).Int("kind", VideoKind(video)).Msg("Video event: Selected video.")
+		return video, true
+	}
+	return media.Video{}, false
+}
+
+// VideoEventData represents the data needed to create a NIP-71 video event.
+type VideoEventData struct {
+	Kind        int         // KindVideo or KindShortVideo
+	Title       string      // From APIEvent.Title
+	Description string      // From APIEvent.Description, used for the summary
+	Video       media.Video // Inspected by ImageValidator
+	Poster      string      // URL of the first valid image of the API event, empty for none
+	Alt         string      // Accessible description of the video, for the imeta `alt` field
+	Hashtags    []string    // From APIEvent.Tags (parsed)
+	References  []string    // From APIEvent.References (parsed), for `r` tags
+	EventDate   string      // YYYY-MM-DD for `d` tag, from APIEvent.Date
+}
+
+// duration returns the video's duration in seconds, to the millisecond.
+func (v *VideoEventData) duration() string {
+	return strconv.FormatFloat(v.Video.Duration.Round(time.Millisecond).Seconds(), 'f', -1, 64)
+}
+
+// imetaTag returns the NIP-92 imeta tag describing the video, with every field known.
+func (v *VideoEventData) imetaTag() nostr.Tag {
+	tag := nostr.Tag{"imeta", "url " + v.Video.URL, "m " + v.Video.MediaType, "x " + v.Video.SHA256}
+	if dim := v.Video.Dim(); dim != "" {
+		tag = append(tag, "dim "+dim)
+	}
+	tag = append(tag, "size "+strconv.FormatInt(v.Video.Size, 10))
+	if v.Video.Duration > 0 {
+		tag = append(tag, "duration "+v.duration())
+	}
+	if v.Poster != "" {
+		tag = append(tag, "image "+v.Poster)
+	}
+	if v.Alt != "" {
+		tag = append(tag, "alt "+v.Alt)
+	}
+	return tag
+}
+
+// ToNostrEvent converts VideoEventData into a nostr.Event of its kind (21 or 22).
+func (v *VideoEventData) ToNostrEvent() (nostr.Event, error) {
+	if v.Kind != KindVideo && v.Kind != KindShortVideo {
+		return nostr.Event{}, fmt.Errorf("kind %d is not a NIP-71 video kind", v.Kind)
+	}
+	if v.Video.URL == "" || v.Video.MediaType == "" || v.Video.SHA256 == "" {
+		return nostr.Event{}, fmt.Errorf("video %q was not inspected", v.Video.URL)
+	}
+
+	// Required NIP-71 tags, then the video itself
+	allTags := nostr.Tags{{"title", v.Title}, v.imetaTag()}
+	if v.Video.Duration > 0 {
+		allTags = append(allTags, nostr.Tag{"duration", v.duration()}) // Top-level for clients of the older NIP-71 layout
+	}
+	if v.Alt != "" {
+		allTags = append(allTags, nostr.Tag{"alt", v.Alt})
+	}
+
+	// Default tags, then the API event's hashtags
+	allTags = append(allTags, hashtagTags(v.Hashtags)...)
+	for _, ref := range v.References {
+		if ref != "" {
+			allTags = append(allTags, nostr.Tag{"r", ref})
+		}
+	}
+	if v.EventDate != "" {
+		allTags = append(allTags, nostr.Tag{"d", v.EventDate})
+	}
+
+	return nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      v.Kind,
+		Tags:      allTags,
+		Content:   fmt.Sprintf("%s\n\n%s", v.Title, v.Description),
+	}, nil
+}
+
+// CreateVideoNostrEvent prepares a NIP-71 video event of the given kind for the video
+// SelectVideo chose for the API event. It qualifies only if there is a video and
+// VideoKind puts it in this kind, so one API event gets either a kind 21 or a kind 22
+// event. The first valid image among the API event's media, if any, is the poster.
+func CreateVideoNostrEvent(
+	ctx context.Context,
+	apiEvent models.APIEvent,
+	processedTags []string,
+	processedReferences []string,
+	validator *ImageValidator,
+	video media.Video,
+	kind int,
+) (event nostr.Event, qualified bool, err error) {
+	if video.URL == "" {
+		log.Debug().Uint("apiEventID", apiEvent.ID).Int("kind", kind).Msg("Video event: Skipped, no video among the media URLs.")
+		return nostr.Event{}, false, nil
+	}
+	if VideoKind(video) != kind {
+		return nostr.Event{}, false, nil
+	}
+
+	var poster string
+	for _, mediaURL := range apiEvent.Media {
+		if mediaURL != "" && validator.IsValidImageURL(ctx, mediaURL) {
+			poster = mediaURL
+			break
+		}
+	}
+
+	data := VideoEventData{
+		Kind:        kind,
+		Title:       apiEvent.Title,
+		Description: apiEvent.Description,
+		Video:       video,
+		Poster:      poster,
+		Alt:         apiEvent.Title,
+		Hashtags:    processedTags,
+		References:  processedReferences,
+		EventDate:   apiEvent.Date.Format("2006-01-02"),
+	}
+	ev, err := data.ToNostrEvent()
+	if err != nil {
+		return nostr.Event{}, false, fmt.Errorf("failed to create kind %d nostr event: %w", kind, err)
+	}
+	log.Info().Uint("apiEventID", apiEvent.ID).Int("kind", kind).Bool("poster", poster != "").Msg("Video event: Event created and qualified for publishing.")
+	return ev, true, nil
+}
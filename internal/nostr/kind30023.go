@@ -0,0 +1,134 @@
+package nostr
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"calendar-bot/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// summaryLength is the maximum length, in characters, of an article's summary and of the
+// description in the Kind 1 teaser.
+const summaryLength = 280
+
+// maxRelayHints is how many relays an naddr link names as hints.
+const maxRelayHints = 3
+
+// ArticleIdentifier returns the d tag of the NIP-23 article of an API event. It depends
+// only on the API event ID, so republishing the article replaces the earlier version.
+func ArticleIdentifier(apiEventID uint) string {
+	return fmt.Sprintf("bitcoin-history-article-%d", apiEventID)
+}
+
+// ArticleLink locates the article of an API event from other events.
+type ArticleLink struct {
+	Address string // NIP-01 address "30023:<pubkey>:<d>", for a tags
+	NAddr   string // NIP-19 naddr with relay hints, for nostr: links in content
+}
+
+// NewArticleLink returns the link to the article of an API event published by pubkey. The
+// first relays the article is published to are included as hints.
+func NewArticleLink(pubkey string, apiEventID uint, relays []string) (ArticleLink, error) {
+	if len(relays) > maxRelayHints {
+		relays = relays[:maxRelayHints]
+	}
+	identifier := ArticleIdentifier(apiEventID)
+	naddr, err := nip19.EncodeEntity(pubkey, nostr.KindArticle, identifier, relays)
+	if err != nil {
+		return ArticleLink{}, fmt.Errorf("failed to encode naddr of article %s: %w", identifier, err)
+	}
+	return ArticleLink{
+		Address: fmt.Sprintf("%d:%s:%s", nostr.KindArticle, pubkey, identifier),
+		NAddr:   naddr,
+	}, nil
+}
+
+// CreateArticleNostrEvent creates a NIP-23 long-form article (kind 30023) from an APIEvent:
+// a Markdown body with the first image, the description and a references section.
+// publishedAt is when the article was first published, kept across republishing.
+func CreateArticleNostrEvent(ctx context.Context, apiEvent models.APIEvent, processedTags []string, processedReferences []string, validator *ImageValidator, publishedAt nostr.Timestamp) (nostr.Event, error) {
+	if apiEvent.ID == 0 {
+		return nostr.Event{}, fmt.Errorf("API event ID is required for the article identifier")
+	}
+
+	var image string
+	for _, mediaURL := range apiEvent.Media {
+		if mediaURL != "" && validator.IsValidImageURL(ctx, mediaURL) {
+			image = mediaURL
+			break
+		}
+	}
+
+	var body strings.Builder
+	if image != "" {
+		fmt.Fprintf(&body, "![%s](%s)\n\n", markdownEscape(apiEvent.Title), image)
+	}
+	body.WriteString(strings.TrimSpace(apiEvent.Description))
+	references := make([]string, 0, len(processedReferences))
+	for _, ref := range processedReferences {
+		if ref != "" {
+			references = append(references, ref)
+		}
+	}
+	if len(references) > 0 {
+		body.WriteString("\n\n## References\n")
+		for _, ref := range references {
+			fmt.Fprintf(&body, "\n- <%s>", ref)
+		}
+	}
+
+	tags := nostr.Tags{
+		{"d", ArticleIdentifier(apiEvent.ID)},
+		{"title", apiEvent.Title},
+		{"published_at", strconv.FormatInt(int64(publishedAt), 10)},
+	}
+	if summary := Summarize(apiEvent.Description, summaryLength); summary != "" {
+		tags = append(tags, nostr.Tag{"summary", summary})
+	}
+	if image != "" {
+		tags = append(tags, nostr.Tag{"image", image})
+	}
+	tags = append(tags, hashtagTags(processedTags)...)
+	for _, ref := range references {
+		tags = append(tags, nostr.Tag{"r", ref})
+	}
+
+	// The event is not signed here; the EventPublisher handles signing.
+	return nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindArticle,
+		Tags:      tags,
+		Content:   body.String(),
+	}, nil
+}
+
+// Summarize shortens text to at most maxLength characters, cutting at a word boundary and
+// adding "…" if anything was cut.
+func Summarize(text string, maxLength int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+	cut := maxLength - 1 // Room for the ellipsis
+	for i := cut; i > maxLength/2; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
+
+// markdownEscape escapes the characters that would end a Markdown image's alt text.
+func markdownEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(text)
+}
@@ -0,0 +1,98 @@
+package nostr
+
+import (
+	"context"
+	"fmt"
+
+	"calendar-bot/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// CalendarIdentifier is the d tag of the bot's NIP-52 calendar (kind 31924). It is the
+// same for every identity; addresses are scoped by pubkey anyway.
+const CalendarIdentifier = "bitcoin-history-calendar"
+
+// CalendarEventIdentifier returns the d tag of the NIP-52 calendar event of an API event.
+// It depends only on the API event ID, so republishing an event replaces the earlier
+// version on relays instead of adding a second one.
+func CalendarEventIdentifier(apiEventID uint) string {
+	return fmt.Sprintf("bitcoin-history-%d", apiEventID)
+}
+
+// CreateCalendarNostrEvent creates a NIP-52 date-based calendar event (kind 31922) from an
+// APIEvent, dated on the day the historical event happened. The first media URL with a
+// supported image format becomes the image tag.
+func CreateCalendarNostrEvent(ctx context.Context, apiEvent models.APIEvent, processedTags []string, processedReferences []string, validator *ImageValidator) (nostr.Event, error) {
+	if apiEvent.ID == 0 {
+		return nostr.Event{}, fmt.Errorf("API event ID is required for the calendar event identifier")
+	}
+	if apiEvent.Date.IsZero() {
+		return nostr.Event{}, fmt.Errorf("API event %d has no date", apiEvent.ID)
+	}
+
+	tags := nostr.Tags{
+		{"d", CalendarEventIdentifier(apiEvent.ID)},
+		{"title", apiEvent.Title},
+		{"start", apiEvent.Date.Format("2006-01-02")},
+	}
+	if apiEvent.Description != "" {
+		tags = append(tags, nostr.Tag{"summary", apiEvent.Description})
+	}
+	for _, mediaURL := range apiEvent.Media {
+		if mediaURL != "" && validator.IsValidImageURL(ctx, mediaURL) {
+			tags = append(tags, nostr.Tag{"image", mediaURL})
+			break
+		}
+	}
+
+	tags = append(tags, hashtagTags(processedTags)...)
+	for _, ref := range processedReferences {
+		if ref != "" {
+			tags = append(tags, nostr.Tag{"r", ref})
+		}
+	}
+
+	// The event is not signed here; the EventPublisher handles signing.
+	return nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindDateCalendarEvent,
+		Tags:      tags,
+		Content:   apiEvent.Description,
+	}, nil
+}
+
+// CalendarEventAddress returns the NIP-01 address ("31922:<pubkey>:<d>") of a signed
+// calendar event, as listed by a calendar.
+func CalendarEventAddress(ev nostr.Event) string {
+	return fmt.Sprintf("%d:%s:%s", ev.Kind, ev.PubKey, ev.Tags.GetD())
+}
+
+// MaxCalendarEvents is the most calendar events one calendar (kind 31924) lists. Each `a`
+// tag takes about 100 bytes, so this keeps the calendar well below the 64 KB event size
+// limit of common relays.
+const MaxCalendarEvents = 500
+
+// CreateCalendarCollectionEvent creates a NIP-52 calendar (kind 31924) titled title that
+// lists the calendar events at the given addresses, at most MaxCalendarEvents of them.
+func CreateCalendarCollectionEvent(title string, addresses []string) (nostr.Event, error) {
+	if len(addresses) == 0 {
+		return nostr.Event{}, fmt.Errorf("a calendar needs at least one calendar event")
+	}
+	if len(addresses) > MaxCalendarEvents {
+		return nostr.Event{}, fmt.Errorf("a calendar lists at most %d calendar events, got %d", MaxCalendarEvents, len(addresses))
+	}
+	tags := nostr.Tags{
+		{"d", CalendarIdentifier},
+		{"title", title},
+	}
+	for _, address := range addresses {
+		tags = append(tags, nostr.Tag{"a", address})
+	}
+	return nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindCalendar,
+		Tags:      tags,
+		Content:   title,
+	}, nil
+}
@@ -0,0 +1,42 @@
+package nostr
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// CreateDeletionEvent creates a NIP-09 kind 5 deletion request for the given events.
+// Each event contributes an "e" tag and a "k" tag with its kind, so relays and clients
+// can tell what is being deleted without fetching it. Addressable events (e.g. NIP-52
+// calendar events) also get an "a" tag, which deletes every version up to the request.
+// The reason is the event content.
+func CreateDeletionEvent(events []nostr.Event, reason string) (nostr.Event, error) {
+	if len(events) == 0 {
+		return nostr.Event{}, fmt.Errorf("no events to delete")
+	}
+
+	tags := nostr.Tags{}
+	seenKinds := make(map[int]bool)
+	for _, ev := range events {
+		if ev.ID == "" {
+			return nostr.Event{}, fmt.Errorf("cannot delete an event without an ID")
+		}
+		tags = append(tags, nostr.Tag{"e", ev.ID})
+		if nostr.IsAddressableKind(ev.Kind) {
+			tags = append(tags, nostr.Tag{"a", fmt.Sprintf("%d:%s:%s", ev.Kind, ev.PubKey, ev.Tags.GetD())})
+		}
+		if !seenKinds[ev.Kind] {
+			seenKinds[ev.Kind] = true
+			tags = append(tags, nostr.Tag{"k", strconv.Itoa(ev.Kind)})
+		}
+	}
+
+	return nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindDeletion,
+		Tags:      tags,
+		Content:   reason,
+	}, nil
+}
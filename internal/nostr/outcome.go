@@ -0,0 +1,70 @@
+package nostr
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// RelayOutcome classifies a relay's response to a published event, based on the
+// machine-readable prefixes relays put in NIP-01 OK messages.
+type RelayOutcome string
+
+const (
+	OutcomeAccepted      RelayOutcome = "accepted"       // OK true
+	OutcomeDuplicate     RelayOutcome = "duplicate"      // Relay already has the event
+	OutcomeBlocked       RelayOutcome = "blocked"        // Our pubkey or IP is blocked
+	OutcomeRateLimited   RelayOutcome = "rate-limited"   // Too many events, try again later
+	OutcomePoW           RelayOutcome = "pow"            // Proof of work required or insufficient
+	OutcomeRestricted    RelayOutcome = "restricted"     // Not allowed to write this event
+	OutcomeAuthRequired  RelayOutcome = "auth-required"  // NIP-42 authentication required
+	OutcomeInvalid       RelayOutcome = "invalid"        // Event rejected as malformed
+	OutcomeError         RelayOutcome = "error"          // Relay-side error or unknown prefix
+	OutcomeConnectFailed RelayOutcome = "connect-failed" // Could not open a connection
+	OutcomeTimeout       RelayOutcome = "timeout"        // No OK received in time
+	OutcomeSkipped       RelayOutcome = "skipped"        // Not sent, the relay blocked us earlier
+)
+
+// Accepted reports whether the outcome means the relay has the event.
+func (o RelayOutcome) Accepted() bool {
+	return o == OutcomeAccepted || o == OutcomeDuplicate
+}
+
+// okPrefixes maps the standard OK message prefixes to outcomes.
+var okPrefixes = map[string]RelayOutcome{
+	"duplicate":     OutcomeDuplicate,
+	"blocked":       OutcomeBlocked,
+	"rate-limited":  OutcomeRateLimited,
+	"pow":           OutcomePoW,
+	"restricted":    OutcomeRestricted,
+	"auth-required": OutcomeAuthRequired,
+	"invalid":       OutcomeInvalid,
+	"error":         OutcomeError,
+}
+
+// ClassifyOKReason returns the outcome for the message of an OK false response.
+func ClassifyOKReason(reason string) RelayOutcome {
+	prefix, _, found := strings.Cut(strings.TrimSpace(reason), ":")
+	if !found {
+		return OutcomeError
+	}
+	if outcome, ok := okPrefixes[strings.ToLower(strings.TrimSpace(prefix))]; ok {
+		return outcome
+	}
+	return OutcomeError
+}
+
+// classifyPublishError turns the error returned by a relay publish into an outcome and
+// the relay's reason. go-nostr reports OK false responses as "msg: <reason>".
+func classifyPublishError(err error) (RelayOutcome, string) {
+	if err == nil {
+		return OutcomeAccepted, ""
+	}
+	if reason, ok := strings.CutPrefix(err.Error(), "msg: "); ok {
+		return ClassifyOKReason(reason), reason
+	}
+	if errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "given up waiting for an OK") {
+		return OutcomeTimeout, err.Error()
+	}
+	return OutcomeError, err.Error()
+}
@@ -0,0 +1,73 @@
+package nostr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyOKReason(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   RelayOutcome
+	}{
+		{"duplicate: already have this event", OutcomeDuplicate},
+		{"blocked: you are banned from posting here", OutcomeBlocked},
+		{"rate-limited: slow down there chief", OutcomeRateLimited},
+		{"pow: difficulty 26 is less than 30", OutcomePoW},
+		{"restricted: not allowed to write", OutcomeRestricted},
+		{"auth-required: we only accept events from registered users", OutcomeAuthRequired},
+		{"invalid: event creation date is too far off", OutcomeInvalid},
+		{"error: could not connect to the database", OutcomeError},
+		{"  Blocked : upper case and spaces", OutcomeBlocked},
+		{"unknown-prefix: something new", OutcomeError},
+		{"no prefix at all", OutcomeError},
+		{"", OutcomeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			if got := ClassifyOKReason(tt.reason); got != tt.want {
+				t.Errorf("ClassifyOKReason(%q) = %s, want %s", tt.reason, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyPublishError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		want       RelayOutcome
+		wantReason string
+	}{
+		{"accepted", nil, OutcomeAccepted, ""},
+		{"OK false with prefix", errors.New("msg: blocked: pubkey not allowed"), OutcomeBlocked, "blocked: pubkey not allowed"},
+		{"OK false duplicate", errors.New("msg: duplicate: have it"), OutcomeDuplicate, "duplicate: have it"},
+		{"OK false without prefix", errors.New("msg: nope"), OutcomeError, "nope"},
+		{"deadline", fmt.Errorf("publish: %w", context.DeadlineExceeded), OutcomeTimeout, "publish: context deadline exceeded"},
+		{"no OK in time", errors.New("given up waiting for an OK"), OutcomeTimeout, "given up waiting for an OK"},
+		{"connection error", errors.New("write: broken pipe"), OutcomeError, "write: broken pipe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := classifyPublishError(tt.err)
+			if got != tt.want || reason != tt.wantReason {
+				t.Errorf("classifyPublishError(%v) = %s, %q; want %s, %q", tt.err, got, reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestRelayOutcomeAccepted(t *testing.T) {
+	for _, outcome := range []RelayOutcome{OutcomeAccepted, OutcomeDuplicate} {
+		if !outcome.Accepted() {
+			t.Errorf("%s is not accepted", outcome)
+		}
+	}
+	for _, outcome := range []RelayOutcome{OutcomeBlocked, OutcomeRateLimited, OutcomeError, OutcomeTimeout, OutcomeSkipped} {
+		if outcome.Accepted() {
+			t.Errorf("%s is accepted", outcome)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package nostr
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultConnectTimeout = 20 * time.Second // Per-relay connection timeout
+	defaultPublishTimeout = 25 * time.Second // Per-relay publish (OK wait) timeout
+	rateLimitRetries      = 3                // Retries after a rate-limited: response
+	rateLimitBackoff      = 2 * time.Second  // First backoff delay, doubled on each retry
+)
+
+// RelayResult is the outcome of publishing one event to one relay.
+type RelayResult struct {
+	URL     string
+	Outcome RelayOutcome
+	Reason  string // Human-readable message from the relay or the error, empty when accepted
+	Err     error  // nil if the relay has the event (accepted or duplicate)
+
+	ConnectTime time.Duration // Time spent opening a new connection, zero if an open one was reused
+	PublishTime time.Duration // Publish to OK round trip of the final attempt
+	Elapsed     time.Duration // Total time spent on this relay, including retries and backoff
+}
+
+// PublishResult holds the per-relay results of publishing one event.
+type PublishResult struct {
+	Results []RelayResult
+}
+
+// Successes returns the number of relays that accepted the event.
+func (pr PublishResult) Successes() int {
+	return len(pr.SuccessfulRelays())
+}
+
+// SuccessfulRelays returns the URLs of the relays that accepted the event.
+func (pr PublishResult) SuccessfulRelays() []string {
+	relays := make([]string, 0, len(pr.Results))
+	for _, result := range pr.Results {
+		if result.Outcome.Accepted() {
+			relays = append(relays, result.URL)
+		}
+	}
+	return relays
+}
+
+// RelayPool keeps relay connections open across events and publishes to all
+// relays concurrently. Dropped connections are re-established on next use.
+// Relays that answer with blocked: are not sent anything else for the pool's lifetime.
+type RelayPool struct {
+	mu             sync.Mutex
+	relays         map[string]*nostr.Relay
+	blocked        map[string]string // Relay URL -> reason it blocked us
+	connectTimeout time.Duration
+	publishTimeout time.Duration
+	onNotice       func(relayURL string, notice string)
+	logger         zerolog.Logger
+}
+
+// NewRelayPool creates an empty RelayPool. Connections are opened lazily.
+func NewRelayPool(logger zerolog.Logger) *RelayPool {
+	return &RelayPool{
+		relays:         make(map[string]*nostr.Relay),
+		blocked:        make(map[string]string),
+		connectTimeout: defaultConnectTimeout,
+		publishTimeout: defaultPublishTimeout,
+		logger:         logger.With().Str("component", "RelayPool").Logger(),
+	}
+}
+
+// connection returns an open connection to relayURL, dialing a new one if there is
+// none yet or the previous one was dropped. The returned duration is the time spent
+// dialing, or zero if an open connection was reused.
+func (p *RelayPool) connection(ctx context.Context, relayURL string) (*nostr.Relay, time.Duration, error) {
+	p.mu.Lock()
+	relay, ok := p.relays[relayURL]
+	p.mu.Unlock()
+	if ok && relay.IsConnected() {
+		return relay, 0, nil
+	}
+	if ok {
+		p.logger.Info().Str("relayURL", relayURL).Msg("Relay connection dropped. Reconnecting.")
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, p.connectTimeout)
+	defer cancel()
+	dialStart := time.Now()
+	relay, err := nostr.RelayConnect(connectCtx, relayURL, nostr.WithNoticeHandler(func(notice string) {
+		p.logger.Info().Str("relayURL", relayURL).Str("notice", notice).Msg("Relay NOTICE received.")
+		if p.onNotice != nil {
+			p.onNotice(relayURL, notice)
+		}
+	}))
+	connectTime := time.Since(dialStart)
+	if err != nil {
+		return nil, connectTime, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if existing, ok := p.relays[relayURL]; ok && existing != relay {
+		if existing.IsConnected() {
+			// Another publish connected first; keep its connection.
+			relay.Close()
+			return existing, connectTime, nil
+		}
+		existing.Close()
+	}
+	p.relays[relayURL] = relay
+	p.logger.Debug().Str("relayURL", relayURL).Dur("connectTime", connectTime).Msg("Connected to relay.")
+	return relay, connectTime, nil
+}
+
+// OnNotice registers a callback for NOTICE messages from any relay in the pool.
+// It must be set before the first publish.
+func (p *RelayPool) OnNotice(fn func(relayURL string, notice string)) {
+	p.onNotice = fn
+}
+
+// publishOne sends ev to a single relay and classifies the response.
+// A connection that turns out to be dead is replaced and the publish retried once,
+// and rate-limited: responses are retried with exponential backoff.
+func (p *RelayPool) publishOne(ctx context.Context, relayURL string, ev nostr.Event) RelayResult {
+	p.mu.Lock()
+	blockedReason, isBlocked := p.blocked[relayURL]
+	p.mu.Unlock()
+	if isBlocked {
+		return RelayResult{URL: relayURL, Outcome: OutcomeSkipped, Reason: blockedReason, Err: fmt.Errorf("relay blocked us earlier: %s", blockedReason)}
+	}
+
+	start := time.Now()
+	var connectTime time.Duration
+	reconnected := false
+	rateLimited := 0
+	backoff := rateLimitBackoff
+	for {
+		relay, dialTime, err := p.connection(ctx, relayURL)
+		connectTime += dialTime
+		if err != nil {
+			return RelayResult{URL: relayURL, Outcome: OutcomeConnectFailed, Reason: err.Error(), Err: err, ConnectTime: connectTime, Elapsed: time.Since(start)}
+		}
+
+		publishCtx, cancel := context.WithTimeout(ctx, p.publishTimeout)
+		publishStart := time.Now()
+		err = relay.Publish(publishCtx, ev)
+		publishTime := time.Since(publishStart)
+		cancel()
+		outcome, reason := classifyPublishError(err)
+		result := RelayResult{URL: relayURL, Outcome: outcome, Reason: reason, ConnectTime: connectTime, PublishTime: publishTime, Elapsed: time.Since(start)}
+		if !outcome.Accepted() {
+			result.Err = err
+		}
+
+		switch {
+		case ctx.Err() != nil:
+			return result
+		case err != nil && !relay.IsConnected() && !reconnected:
+			reconnected = true
+			p.logger.Debug().Err(err).Str("relayURL", relayURL).Msg("Relay connection lost while publishing. Retrying once.")
+			continue
+		case outcome == OutcomeRateLimited && rateLimited < rateLimitRetries:
+			rateLimited++
+			p.logger.Info().Str("relayURL", relayURL).Str("reason", reason).Dur("backoff", backoff).Msg("Relay rate-limited us. Backing off before retrying.")
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return result
+			}
+			backoff *= 2
+			continue
+		case outcome == OutcomeBlocked:
+			p.mu.Lock()
+			p.blocked[relayURL] = reason
+			p.mu.Unlock()
+			p.logger.Warn().Str("relayURL", relayURL).Str("reason", reason).Msg("Relay blocked us. No further events will be sent to it.")
+		}
+		return result
+	}
+}
+
+// Publish sends ev to all given relays concurrently, each with its own timeouts,
+// and returns one result per relay in the order the relays were given.
+func (p *RelayPool) Publish(ctx context.Context, ev nostr.Event, relays []string) PublishResult {
+	results := make([]RelayResult, len(relays))
+	var wg sync.WaitGroup
+	for i, relayURL := range relays {
+		wg.Add(1)
+		go func(i int, relayURL string) {
+			defer wg.Done()
+			results[i] = p.publishOne(ctx, relayURL, ev)
+		}(i, relayURL)
+	}
+	wg.Wait()
+	return PublishResult{Results: results}
+}
+
+// Close closes all open relay connections.
+func (p *RelayPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for relayURL, relay := range p.relays {
+		relay.Close()
+		delete(p.relays, relayURL)
+	}
+}
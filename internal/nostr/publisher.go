@@ -2,34 +2,46 @@ package nostr
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"calendar-bot/internal/metrics"
 	"calendar-bot/internal/models" // For APIEvent type
+	"calendar-bot/internal/signer"
 
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/rs/zerolog"
 )
 
-// EventPublisher handles the creation and publishing of Nostr events.
-// It will manage connections to relays and orchestrate different event kinds.
+// SignedKinds are the kinds of the events the bot signs, which a remote signer has to allow.
+var SignedKinds = []int{nostr.KindTextNote, 20, KindVideo, KindShortVideo, nostr.KindArticle, nostr.KindDateCalendarEvent, nostr.KindCalendar, nostr.KindDeletion, nostr.KindBlobs, nostr.KindHTTPAuth}
+
+// EventPublisher handles the signing and publishing of Nostr events.
+// Relay connections are kept open in a RelayPool across events.
 type EventPublisher struct {
 	relays         []string
-	privateKey     string
-	metrics        *metrics.Collector
+	kindRelays     map[string][]string // Relays replacing relays for one kind, e.g. "kind20"
+	pool           *RelayPool
+	signer         signer.Signer
+	metrics        atomic.Pointer[metrics.Collector] // Replaced by SetMetrics while relay connections report notices
 	logger         zerolog.Logger
 	defaultWaitTime time.Duration // Time to wait after a successful publish batch
 }
 
 // NewEventPublisher creates a new EventPublisher.
-func NewEventPublisher(relays []string, privateKey string, metrics *metrics.Collector, logger zerolog.Logger) *EventPublisher {
-	return &EventPublisher{
+func NewEventPublisher(relays []string, signer signer.Signer, metrics *metrics.Collector, logger zerolog.Logger) *EventPublisher {
+	ep := &EventPublisher{
 		relays:         relays,
-		privateKey:     privateKey,
-		metrics:        metrics,
+		pool:           NewRelayPool(logger),
+		signer:         signer,
 		logger:         logger.With().Str("component", "EventPublisher").Logger(),
 		defaultWaitTime: 30 * time.Minute, // Default from existing logic
 	}
+	ep.metrics.Store(metrics)
+	ep.pool.OnNotice(func(relayURL string, notice string) {
+		ep.metrics.Load().RecordRelayNotice(relayURL)
+	})
+	return ep
 }
 
 // DefaultWaitTime returns the default wait time for the EventPublisher
@@ -37,60 +49,90 @@ func (ep *EventPublisher) DefaultWaitTime() time.Duration {
 	return ep.defaultWaitTime
 }
 
-// PublishEvent orchestrates the publishing of an API event to Nostr.
-// This will eventually handle both Kind 1 and Kind 20 events.
-// For now, it will contain the generic relay publishing logic.
-// The actual Nostr event creation will be delegated.
-// Returns: successful_publish_count, error (error is primarily for signing issues)
-func (ep *EventPublisher) PublishEvent(apiEvent models.APIEvent, nostrEv nostr.Event, eventType string) (int, error) {
-	eventSpecificLogger := ep.logger.With().Uint("apiEventID", apiEvent.ID).Str("nostrEventID", nostrEv.ID).Str("eventType", eventType).Logger()
-	eventSpecificLogger.Info().Msg("Preparing to publish event to Nostr relays")
+// SetMetrics switches the collector that relay results are recorded in, e.g. at the start of a new run.
+func (ep *EventPublisher) SetMetrics(collector *metrics.Collector) {
+	ep.metrics.Store(collector)
+}
+
+// Relays returns the relay URLs the publisher sends events to.
+func (ep *EventPublisher) Relays() []string {
+	return ep.relays
+}
 
-	if err := nostrEv.Sign(ep.privateKey); err != nil {
-		eventSpecificLogger.Error().Err(err).Msg("Failed to sign Nostr event")
-		return 0, err
+// SetKindRelays sets relays that replace the default relays for individual kinds.
+func (ep *EventPublisher) SetKindRelays(kindRelays map[string][]string) {
+	ep.kindRelays = kindRelays
+}
+
+// RelaysFor returns the relay URLs that events of the given kind are sent to.
+func (ep *EventPublisher) RelaysFor(kind string) []string {
+	if relays, ok := ep.kindRelays[kind]; ok && len(relays) > 0 {
+		return relays
 	}
+	return ep.relays
+}
 
-	eventSpecificLogger.Debug().Str("pubkey", nostrEv.PubKey).Int("tagCount", len(nostrEv.Tags)).Msg("Event signed and ready for publishing")
+// SignEvent signs the event in place with the publisher's signer.
+// With a remote signer this is a network round trip, bounded by ctx and the signer's timeout.
+func (ep *EventPublisher) SignEvent(ctx context.Context, nostrEv *nostr.Event) error {
+	return ep.signer.Sign(ctx, nostrEv)
+}
 
-	successfulRelayPublishes := 0
-	for _, relayURL := range ep.relays {
-		relayLog := eventSpecificLogger.With().Str("relayURL", relayURL).Logger()
-		relayLog.Debug().Msg("Attempting to connect to relay")
-
-		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second) // Connection timeout
-		relayConn, err := nostr.RelayConnect(ctx, relayURL)
-		if err != nil {
-			relayLog.Warn().Err(err).Msg("Failed to connect to relay")
-			ep.metrics.RecordRelayFailure(relayURL)
-			cancel()
-			continue
-		}
+// PublicKey returns the hex public key the publisher signs with.
+func (ep *EventPublisher) PublicKey() string {
+	return ep.signer.PublicKey()
+}
 
-		relayLog.Debug().Msg("Successfully connected to relay. Preparing to publish.")
+// PublishEvent orchestrates the publishing of an API event to Nostr.
+// It signs the event and publishes it to all configured relays.
+// Returns the per-relay results, and an error only if signing failed.
+func (ep *EventPublisher) PublishEvent(ctx context.Context, apiEvent models.APIEvent, nostrEv nostr.Event, eventType string) (PublishResult, error) {
+	if err := ep.SignEvent(ctx, &nostrEv); err != nil {
+		ep.logger.Error().Err(err).Uint("apiEventID", apiEvent.ID).Str("eventType", eventType).Msg("Failed to sign Nostr event")
+		return PublishResult{}, err
+	}
+	return ep.PublishSignedEvent(ctx, apiEvent, nostrEv, eventType, ep.relays), nil
+}
 
-		publishCtx, publishCancel := context.WithTimeout(context.Background(), 25*time.Second) // Publish operation timeout
-		err = relayConn.Publish(publishCtx, nostrEv)
+// PublishSignedEvent sends an already signed event to the given relays concurrently
+// over the publisher's persistent relay pool.
+// Cancelling ctx aborts the in-flight relay connections and publishes.
+func (ep *EventPublisher) PublishSignedEvent(ctx context.Context, apiEvent models.APIEvent, nostrEv nostr.Event, eventType string, relays []string) PublishResult {
+	eventSpecificLogger := ep.logger.With().Uint("apiEventID", apiEvent.ID).Str("nostrEventID", nostrEv.ID).Str("eventType", eventType).Logger()
+	eventSpecificLogger.Info().Msg("Preparing to publish event to Nostr relays")
+	eventSpecificLogger.Debug().Str("pubkey", nostrEv.PubKey).Int("tagCount", len(nostrEv.Tags)).Msg("Event signed and ready for publishing")
 
-		if err != nil {
-			relayLog.Warn().Err(err).Msg("Failed to publish event to relay")
-			ep.metrics.RecordRelayFailure(relayURL)
-		} else {
-			relayLog.Info().Msg("Event successfully published to relay")
-			ep.metrics.RecordRelaySuccess(relayURL, 0) 
-			successfulRelayPublishes++
+	result := ep.pool.Publish(ctx, nostrEv, relays)
+	collector := ep.metrics.Load()
+	for _, relayResult := range result.Results {
+		relayLog := eventSpecificLogger.With().Str("relayURL", relayResult.URL).Str("outcome", string(relayResult.Outcome)).Logger()
+		collector.RecordRelayOutcome(relayResult.URL, string(relayResult.Outcome))
+		if relayResult.ConnectTime > 0 && relayResult.Outcome != OutcomeConnectFailed {
+			collector.RecordRelayConnect(relayResult.URL, relayResult.ConnectTime)
+		}
+		switch {
+		case relayResult.Outcome == OutcomeDuplicate:
+			relayLog.Info().Str("reason", relayResult.Reason).Dur("publishTime", relayResult.PublishTime).Msg("Relay already had the event. Treating as published.")
+			collector.RecordRelaySuccess(relayResult.URL, relayResult.PublishTime)
+		case relayResult.Outcome.Accepted():
+			relayLog.Info().Dur("publishTime", relayResult.PublishTime).Msg("Event successfully published to relay")
+			collector.RecordRelaySuccess(relayResult.URL, relayResult.PublishTime)
+		default:
+			relayLog.Warn().Err(relayResult.Err).Str("reason", relayResult.Reason).Dur("elapsed", relayResult.Elapsed).Msg("Failed to publish event to relay")
+			collector.RecordRelayFailure(relayResult.URL, relayResult.Elapsed)
 		}
-
-		publishCancel()
-		relayConn.Close()
-		cancel()
 	}
 
-	if successfulRelayPublishes > 0 {
-		eventSpecificLogger.Info().Int("successfulRelaysCount", successfulRelayPublishes).Int("totalRelaysAttempted", len(ep.relays)).Msg("Event publishing process completed for one or more relays.")
+	if successes := result.Successes(); successes > 0 {
+		eventSpecificLogger.Info().Int("successfulRelaysCount", successes).Int("totalRelaysAttempted", len(relays)).Msg("Event publishing process completed for one or more relays.")
 	} else {
 		eventSpecificLogger.Warn().Msg("Event was not successfully published to any of the configured relays.")
 	}
 
-	return successfulRelayPublishes, nil
-} 
\ No newline at end of file
+	return result
+}
+
+// Close closes the publisher's relay connections.
+func (ep *EventPublisher) Close() {
+	ep.pool.Close()
+}
@@ -0,0 +1,42 @@
+package nostr
+
+import (
+	"sync"
+	"testing"
+
+	"calendar-bot/internal/metrics"
+
+	"github.com/rs/zerolog"
+)
+
+// TestEventPublisherSetMetricsWhileNoticesArrive switches collectors, as each daemon day
+// does, while pooled connections report notices. Run with -race.
+func TestEventPublisherSetMetricsWhileNoticesArrive(t *testing.T) {
+	first := metrics.NewCollector()
+	ep := NewEventPublisher([]string{"wss://relay.example"}, nil, first, zerolog.Nop())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			ep.pool.onNotice("wss://relay.example", "slow down")
+		}
+	}()
+	second := metrics.NewCollector()
+	for range 100 {
+		ep.SetMetrics(second)
+		ep.SetMetrics(first)
+	}
+	wg.Wait()
+	ep.SetMetrics(second)
+	ep.pool.onNotice("wss://relay.example", "slow down")
+
+	total := first.Snapshot().Relays["wss://relay.example"].Notices + second.Snapshot().Relays["wss://relay.example"].Notices
+	if total != 101 {
+		t.Errorf("collectors recorded %d notices, want 101", total)
+	}
+	if second.Snapshot().Relays["wss://relay.example"].Notices == 0 {
+		t.Error("notice after SetMetrics was not recorded in the new collector")
+	}
+}
@@ -0,0 +1,25 @@
+package nostr
+
+import (
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// defaultHashtags are the `t` tags of every event the bot posts, whatever its kind.
+var defaultHashtags = []string{"bitcoin", "history", "onthisday", "calendar", "bitcoincalendar", "bitcoinhistory", "autopost"}
+
+// hashtagTags returns the `t` tags of an event: the default hashtags, then the API
+// event's own hashtags in lower case, skipping empty ones.
+func hashtagTags(hashtags []string) nostr.Tags {
+	tags := make(nostr.Tags, 0, len(defaultHashtags)+len(hashtags))
+	for _, t := range defaultHashtags {
+		tags = append(tags, nostr.Tag{"t", t})
+	}
+	for _, t := range hashtags {
+		if t != "" {
+			tags = append(tags, nostr.Tag{"t", strings.ToLower(t)})
+		}
+	}
+	return tags
+}
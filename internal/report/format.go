@@ -0,0 +1,184 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+// Views select which part of a report is printed.
+const (
+	ViewAll      = "all"       // Per-day and per-relay tables
+	ViewDay      = "day"       // Per-day trends
+	ViewRelay    = "relay"     // Per-relay totals over the range
+	ViewRelayDay = "relay-day" // Per-relay trends, one row per relay and day
+)
+
+// table is a view rendered as rows of cells.
+type table struct {
+	title  string
+	header []string
+	rows   [][]string
+}
+
+// ratio formats a rate either as a percentage (tables) or as a plain fraction (CSV).
+type ratio func(r *float64) string
+
+func percent(r *float64) string {
+	if r == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(*r*100, 'f', 1, 64) + "%"
+}
+
+func fraction(r *float64) string {
+	if r == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*r, 'f', 4, 64)
+}
+
+func optionalFloat(v *float64, empty string) string {
+	if v == nil {
+		return empty
+	}
+	return strconv.FormatFloat(*v, 'f', 1, 64)
+}
+
+func dayTable(r Report, fmtRatio ratio) table {
+	t := table{
+		title:  "Per-day trends",
+		header: []string{"date", "runs", "interrupted", "errors", "posted", "failed", "already_published", "publish_success", "kind20_qualified", "relay_success"},
+	}
+	for _, d := range r.Days {
+		t.rows = append(t.rows, []string{
+			d.Date, strconv.Itoa(d.Runs), strconv.Itoa(d.Interrupted), strconv.Itoa(d.Errors),
+			strconv.Itoa(d.Posted), strconv.Itoa(d.Failed), strconv.Itoa(d.AlreadyPublished),
+			fmtRatio(d.PublishSuccessRate), fmtRatio(d.Kind20QualificationRate), fmtRatio(d.RelaySuccessRate),
+		})
+	}
+	return t
+}
+
+func relayTable(r Report, fmtRatio ratio, empty string) table {
+	t := table{
+		title:  "Per-relay totals",
+		header: []string{"relay", "runs", "runs_up", "uptime", "successes", "failures", "success", "notices", "mean_publish_ms", "first_seen", "last_seen"},
+	}
+	for _, rs := range r.Relays {
+		t.rows = append(t.rows, []string{
+			rs.Relay, strconv.Itoa(rs.Runs), strconv.Itoa(rs.RunsUp), fmtRatio(rs.Uptime),
+			strconv.Itoa(rs.Successes), strconv.Itoa(rs.Failures), fmtRatio(rs.SuccessRate),
+			strconv.Itoa(rs.Notices), optionalFloat(rs.MeanPublishMs, empty), rs.FirstSeen, rs.LastSeen,
+		})
+	}
+	return t
+}
+
+func relayDayTable(r Report, fmtRatio ratio) table {
+	t := table{
+		title:  "Per-relay trends",
+		header: []string{"date", "relay", "runs", "runs_up", "successes", "failures", "success"},
+	}
+	for _, rd := range r.RelayDays {
+		t.rows = append(t.rows, []string{
+			rd.Date, rd.Relay, strconv.Itoa(rd.Runs), strconv.Itoa(rd.RunsUp),
+			strconv.Itoa(rd.Successes), strconv.Itoa(rd.Failures), fmtRatio(rd.SuccessRate),
+		})
+	}
+	return t
+}
+
+// ValidateOptions checks a format and view combination before any work is done.
+func ValidateOptions(format string, view string) error {
+	switch view {
+	case ViewAll, ViewDay, ViewRelay, ViewRelayDay:
+	default:
+		return fmt.Errorf("unknown view %q (want %s, %s, %s or %s)", view, ViewAll, ViewDay, ViewRelay, ViewRelayDay)
+	}
+	switch format {
+	case FormatTable, FormatJSON:
+	case FormatCSV:
+		if view == ViewAll {
+			return fmt.Errorf("CSV output holds a single table: choose --by %s, %s or %s", ViewDay, ViewRelay, ViewRelayDay)
+		}
+	default:
+		return fmt.Errorf("unknown format %q (want %s, %s or %s)", format, FormatTable, FormatJSON, FormatCSV)
+	}
+	return nil
+}
+
+// Write renders the report in the given format and view.
+func Write(w io.Writer, r Report, format string, view string) error {
+	if err := ValidateOptions(format, view); err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatJSON:
+		var v interface{} = r
+		switch view {
+		case ViewDay:
+			v = r.Days
+		case ViewRelay:
+			v = r.Relays
+		case ViewRelayDay:
+			v = r.RelayDays
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+
+	case FormatCSV:
+		var t table
+		switch view {
+		case ViewDay:
+			t = dayTable(r, fraction)
+		case ViewRelay:
+			t = relayTable(r, fraction, "")
+		case ViewRelayDay:
+			t = relayDayTable(r, fraction)
+		}
+		cw := csv.NewWriter(w)
+		cw.Write(t.header)
+		cw.WriteAll(t.rows) // Flushes
+		return cw.Error()
+
+	default:
+		var tables []table
+		switch view {
+		case ViewAll:
+			tables = []table{dayTable(r, percent), relayTable(r, percent, "-")}
+		case ViewDay:
+			tables = []table{dayTable(r, percent)}
+		case ViewRelay:
+			tables = []table{relayTable(r, percent, "-")}
+		case ViewRelayDay:
+			tables = []table{relayDayTable(r, percent)}
+		}
+		fmt.Fprintf(w, "Metrics report %s to %s (%d files)\n", r.From, r.To, r.Files)
+		for _, t := range tables {
+			fmt.Fprintf(w, "\n%s\n", t.title)
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, strings.ToUpper(strings.Join(t.header, "\t")))
+			for _, row := range t.rows {
+				fmt.Fprintln(tw, strings.Join(row, "\t"))
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
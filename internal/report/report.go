@@ -0,0 +1,220 @@
+package report
+
+import (
+	"sort"
+	"time"
+
+	"calendar-bot/internal/metrics"
+)
+
+// dateLayout is the layout of the dates in reports and of the --from/--to flags.
+const dateLayout = "2006-01-02"
+
+// Run is one exported metrics file.
+type Run struct {
+	File     metrics.ExportFile
+	Snapshot metrics.Snapshot
+}
+
+// Date returns the local calendar date the run was exported on.
+func (r Run) Date() string {
+	return r.File.Time.Format(dateLayout)
+}
+
+// Load reads the metrics files in dir exported between from and to (inclusive, local dates).
+// Files that cannot be read are skipped and returned as warnings so one corrupt file does
+// not hide the rest of the history.
+func Load(dir string, from time.Time, to time.Time) ([]Run, []error, error) {
+	files, err := metrics.ListExportFiles(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	fromDate, toDate := from.Format(dateLayout), to.Format(dateLayout)
+
+	runs := make([]Run, 0, len(files))
+	var warnings []error
+	for _, file := range files {
+		date := file.Time.Format(dateLayout)
+		if date < fromDate || date > toDate {
+			continue
+		}
+		snapshot, err := metrics.ReadSnapshotFile(file.Path)
+		if err != nil {
+			warnings = append(warnings, err)
+			continue
+		}
+		runs = append(runs, Run{File: file, Snapshot: snapshot})
+	}
+	return runs, warnings, nil
+}
+
+// DayStats aggregates all runs exported on one day.
+type DayStats struct {
+	Date                    string   `json:"date"`
+	Runs                    int      `json:"runs"`
+	Interrupted             int      `json:"interrupted"`
+	Errors                  int      `json:"errors"`
+	Posted                  int      `json:"posted"` // Events of any kind published to at least one relay
+	Failed                  int      `json:"failed"`
+	AlreadyPublished        int      `json:"alreadyPublished"`
+	Kind20Qualified         int      `json:"kind20Qualified"` // Events that qualified for a Kind 20 post
+	Kind20Skipped           int      `json:"kind20Skipped"`   // Events that did not qualify
+	RelaySuccesses          int      `json:"relaySuccesses"`
+	RelayFailures           int      `json:"relayFailures"`
+	PublishSuccessRate      *float64 `json:"publishSuccessRate"`      // Posted / (posted + failed), null if nothing was attempted
+	Kind20QualificationRate *float64 `json:"kind20QualificationRate"` // Qualified / (qualified + skipped)
+	RelaySuccessRate        *float64 `json:"relaySuccessRate"`        // Relay successes / relay attempts
+}
+
+// RelayStats aggregates one relay over all runs in the range.
+type RelayStats struct {
+	Relay         string         `json:"relay"`
+	FirstSeen     string         `json:"firstSeen"`
+	LastSeen      string         `json:"lastSeen"`
+	Runs          int            `json:"runs"`   // Runs that sent at least one event to the relay
+	RunsUp        int            `json:"runsUp"` // Runs in which the relay accepted at least one event
+	Successes     int            `json:"successes"`
+	Failures      int            `json:"failures"`
+	Notices       int            `json:"notices"`
+	Outcomes      map[string]int `json:"outcomes"`
+	SuccessRate   *float64       `json:"successRate"`   // Successes / attempts
+	Uptime        *float64       `json:"uptime"`        // RunsUp / runs
+	MeanPublishMs *float64       `json:"meanPublishMs"` // Mean publish to OK round trip, weighted by sample count
+}
+
+// RelayDayStats is one relay on one day, for per-relay trends.
+type RelayDayStats struct {
+	Date        string   `json:"date"`
+	Relay       string   `json:"relay"`
+	Runs        int      `json:"runs"`
+	RunsUp      int      `json:"runsUp"`
+	Successes   int      `json:"successes"`
+	Failures    int      `json:"failures"`
+	SuccessRate *float64 `json:"successRate"`
+}
+
+// Report is the aggregated view of a range of runs.
+type Report struct {
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	Files     int             `json:"files"`
+	Days      []DayStats      `json:"days"`
+	Relays    []RelayStats    `json:"relays"`
+	RelayDays []RelayDayStats `json:"relayDays"`
+}
+
+// rate returns n / total, or nil if total is zero.
+func rate(n int, total int) *float64 {
+	if total == 0 {
+		return nil
+	}
+	r := float64(n) / float64(total)
+	return &r
+}
+
+// Build aggregates runs into per-day, per-relay and per-relay-per-day statistics.
+func Build(runs []Run, from time.Time, to time.Time) Report {
+	report := Report{From: from.Format(dateLayout), To: to.Format(dateLayout), Files: len(runs)}
+
+	days := make(map[string]*DayStats)
+	relays := make(map[string]*RelayStats)
+	relayDays := make(map[[2]string]*RelayDayStats)
+	publishMsTotal := make(map[string]float64)
+	publishCount := make(map[string]int)
+
+	for _, run := range runs {
+		date := run.Date()
+		day, ok := days[date]
+		if !ok {
+			day = &DayStats{Date: date}
+			days[date] = day
+		}
+		day.Runs++
+		switch run.File.Prefix {
+		case "interrupted":
+			day.Interrupted++
+		case "error":
+			day.Errors++
+		}
+
+		s := run.Snapshot
+		for kind, results := range s.Events {
+			day.Posted += results[string(metrics.ResultPosted)]
+			day.Failed += results[string(metrics.ResultFailed)]
+			day.AlreadyPublished += results[string(metrics.ResultAlreadyPublished)]
+			if kind == metrics.KindPicture {
+				day.Kind20Qualified += results[string(metrics.ResultPosted)] + results[string(metrics.ResultFailed)] + results[string(metrics.ResultAlreadyPublished)]
+				day.Kind20Skipped += results[string(metrics.ResultSkipped)]
+			}
+		}
+
+		for url, r := range s.Relays {
+			day.RelaySuccesses += r.Successes
+			day.RelayFailures += r.Failures
+
+			relay, ok := relays[url]
+			if !ok {
+				relay = &RelayStats{Relay: url, FirstSeen: date, Outcomes: make(map[string]int)}
+				relays[url] = relay
+			}
+			relay.LastSeen = date
+			relay.Successes += r.Successes
+			relay.Failures += r.Failures
+			relay.Notices += r.Notices
+			for outcome, n := range r.Outcomes {
+				relay.Outcomes[outcome] += n
+			}
+			publishMsTotal[url] += r.Latency.Publish.MeanMs * float64(r.Latency.Publish.Count)
+			publishCount[url] += r.Latency.Publish.Count
+
+			relayDay, ok := relayDays[[2]string{date, url}]
+			if !ok {
+				relayDay = &RelayDayStats{Date: date, Relay: url}
+				relayDays[[2]string{date, url}] = relayDay
+			}
+			relayDay.Successes += r.Successes
+			relayDay.Failures += r.Failures
+
+			if r.Successes+r.Failures > 0 {
+				relay.Runs++
+				relayDay.Runs++
+				if r.Successes > 0 {
+					relay.RunsUp++
+					relayDay.RunsUp++
+				}
+			}
+		}
+	}
+
+	for _, day := range days {
+		day.PublishSuccessRate = rate(day.Posted, day.Posted+day.Failed)
+		day.Kind20QualificationRate = rate(day.Kind20Qualified, day.Kind20Qualified+day.Kind20Skipped)
+		day.RelaySuccessRate = rate(day.RelaySuccesses, day.RelaySuccesses+day.RelayFailures)
+		report.Days = append(report.Days, *day)
+	}
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Date < report.Days[j].Date })
+
+	for url, relay := range relays {
+		relay.SuccessRate = rate(relay.Successes, relay.Successes+relay.Failures)
+		relay.Uptime = rate(relay.RunsUp, relay.Runs)
+		if publishCount[url] > 0 {
+			mean := publishMsTotal[url] / float64(publishCount[url])
+			relay.MeanPublishMs = &mean
+		}
+		report.Relays = append(report.Relays, *relay)
+	}
+	sort.Slice(report.Relays, func(i, j int) bool { return report.Relays[i].Relay < report.Relays[j].Relay })
+
+	for _, relayDay := range relayDays {
+		relayDay.SuccessRate = rate(relayDay.Successes, relayDay.Successes+relayDay.Failures)
+		report.RelayDays = append(report.RelayDays, *relayDay)
+	}
+	sort.Slice(report.RelayDays, func(i, j int) bool {
+		if report.RelayDays[i].Date != report.RelayDays[j].Date {
+			return report.RelayDays[i].Date < report.RelayDays[j].Date
+		}
+		return report.RelayDays[i].Relay < report.RelayDays[j].Relay
+	})
+
+	return report
+}
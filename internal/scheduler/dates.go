@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxRangeDays caps the number of days a date range may cover, so a typo such as a
+// wrong year cannot start a backfill over decades.
+const MaxRangeDays = 366
+
+// ParseDay parses a date given as YYYY-MM-DD, or as MM-DD in the year of now.
+// The result is local midnight in now's location. 02-29 is rejected outside leap years.
+func ParseDay(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	loc := now.Location()
+	if day, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return day, nil
+	}
+	monthDay, err := time.ParseInLocation("01-02", value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected MM-DD or YYYY-MM-DD", value)
+	}
+	// MM-DD parses in year 0, a leap year, so 02-29 must be checked against now's year
+	// rather than roll over to March 1.
+	day := time.Date(now.Year(), monthDay.Month(), monthDay.Day(), 0, 0, 0, 0, loc)
+	if day.Month() != monthDay.Month() {
+		return time.Time{}, fmt.Errorf("invalid date %q: %d has no February 29", value, now.Year())
+	}
+	return day, nil
+}
+
+// ParseDays parses a single date or an inclusive range written FROM..TO, where each
+// end is MM-DD or YYYY-MM-DD, and returns every day it covers in order.
+func ParseDays(value string, now time.Time) ([]time.Time, error) {
+	fromValue, toValue, isRange := strings.Cut(value, "..")
+	from, err := ParseDay(fromValue, now)
+	if err != nil {
+		return nil, err
+	}
+	if !isRange {
+		return []time.Time{from}, nil
+	}
+	to, err := ParseDay(toValue, now)
+	if err != nil {
+		return nil, err
+	}
+	return DaysBetween(from, to)
+}
+
+// DaysBetween returns every day from from to to inclusive. Days are stepped by calendar
+// date rather than by 24 hours, so daylight saving changes do not skip or repeat a day.
+func DaysBetween(from time.Time, to time.Time) ([]time.Time, error) {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, from.Location())
+	if to.Before(from) {
+		return nil, fmt.Errorf("date range ends (%s) before it starts (%s)", to.Format("2006-01-02"), from.Format("2006-01-02"))
+	}
+
+	days := make([]time.Time, 0)
+	for day := from; !day.After(to); day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location()) {
+		if len(days) == MaxRangeDays {
+			return nil, fmt.Errorf("date range %s..%s covers more than %d days", from.Format("2006-01-02"), to.Format("2006-01-02"), MaxRangeDays)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func formatDays(days []time.Time) string {
+	formatted := make([]string, len(days))
+	for i, day := range days {
+		formatted[i] = day.Format("2006-01-02 15:04 MST")
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func TestParseDays(t *testing.T) {
+	newYork := loadLocation(t, "America/New_York")
+	now := time.Date(2026, 6, 15, 10, 0, 0, 0, newYork)
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{value: "2026-01-03", want: "2026-01-03 00:00 EST"},
+		{value: "01-03", want: "2026-01-03 00:00 EST"},
+		{value: " 12-31 ", want: "2026-12-31 00:00 EST"},
+		{value: "2027-07-04", want: "2027-07-04 00:00 EDT"},
+		{value: "2026-01-01..2026-01-03", want: "2026-01-01 00:00 EST, 2026-01-02 00:00 EST, 2026-01-03 00:00 EST"},
+		{value: "12-30..2027-01-01", want: "2026-12-30 00:00 EST, 2026-12-31 00:00 EST, 2027-01-01 00:00 EST"},
+		{value: "03-07..03-09", want: "2026-03-07 00:00 EST, 2026-03-08 00:00 EST, 2026-03-09 00:00 EDT"},
+		{value: "10-31..11-02", want: "2026-10-31 00:00 EDT, 2026-11-01 00:00 EDT, 2026-11-02 00:00 EST"},
+		{value: "01-05..01-05", want: "2026-01-05 00:00 EST"},
+		{value: "02-29", wantErr: `invalid date "02-29": 2026 has no February 29`},
+		{value: "02-27..02-29", wantErr: "2026 has no February 29"},
+		{value: "2026-02-29", wantErr: `invalid date "2026-02-29"`},
+		{value: "02-27..03-01", want: "2026-02-27 00:00 EST, 2026-02-28 00:00 EST, 2026-03-01 00:00 EST"},
+		{value: "01-05..01-04", wantErr: "ends (2026-01-04) before it starts (2026-01-05)"},
+		{value: "2026-01-01..2027-01-02", wantErr: "covers more than 366 days"},
+		{value: "2026-13-01", wantErr: `invalid date "2026-13-01"`},
+		{value: "tomorrow", wantErr: `invalid date "tomorrow"`},
+		{value: "01-03..", wantErr: `invalid date ""`},
+		{value: "", wantErr: `invalid date ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			days, err := ParseDays(tt.value, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseDays(%q) error = %v, want one containing %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDays(%q): %v", tt.value, err)
+			}
+			if got := formatDays(days); got != tt.want {
+				t.Errorf("ParseDays(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDaysInLeapYear(t *testing.T) {
+	newYork := loadLocation(t, "America/New_York")
+	now := time.Date(2028, 6, 15, 10, 0, 0, 0, newYork)
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"02-29", "2028-02-29 00:00 EST"},
+		{"2028-02-29", "2028-02-29 00:00 EST"},
+		{"02-28..03-01", "2028-02-28 00:00 EST, 2028-02-29 00:00 EST, 2028-03-01 00:00 EST"},
+	}
+	for _, tt := range tests {
+		days, err := ParseDays(tt.value, now)
+		if err != nil {
+			t.Errorf("ParseDays(%q): %v", tt.value, err)
+			continue
+		}
+		if got := formatDays(days); got != tt.want {
+			t.Errorf("ParseDays(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDaysBetween(t *testing.T) {
+	newYork := loadLocation(t, "America/New_York")
+	tests := []struct {
+		name    string
+		from    time.Time
+		to      time.Time
+		want    int
+		wantErr bool
+	}{
+		{"same day at different times", time.Date(2026, 1, 3, 18, 0, 0, 0, newYork), time.Date(2026, 1, 3, 6, 0, 0, 0, newYork), 1, false},
+		{"times ignored across days", time.Date(2026, 1, 3, 23, 0, 0, 0, newYork), time.Date(2026, 1, 4, 1, 0, 0, 0, newYork), 2, false},
+		{"whole leap year", time.Date(2028, 1, 1, 0, 0, 0, 0, newYork), time.Date(2028, 12, 31, 0, 0, 0, 0, newYork), MaxRangeDays, false},
+		{"one day over the limit", time.Date(2028, 1, 1, 0, 0, 0, 0, newYork), time.Date(2029, 1, 1, 0, 0, 0, 0, newYork), 0, true},
+		{"reversed", time.Date(2026, 1, 4, 0, 0, 0, 0, newYork), time.Date(2026, 1, 3, 0, 0, 0, 0, newYork), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			days, err := DaysBetween(tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DaysBetween() error = %v, want error: %v", err, tt.wantErr)
+			}
+			if len(days) != tt.want {
+				t.Fatalf("DaysBetween() returned %d days, want %d", len(days), tt.want)
+			}
+			for i, day := range days {
+				if day.Hour() != 0 || day.Minute() != 0 || day.Location() != newYork {
+					t.Errorf("day %d = %s, want local midnight", i, day)
+				}
+				if i > 0 && day.YearDay() != days[i-1].YearDay()+1 && day.YearDay() != 1 {
+					t.Errorf("day %d = %s does not follow %s", i, day.Format("2006-01-02"), days[i-1].Format("2006-01-02"))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// DayFunc runs the work for one calendar day. It receives the run's context, which is
+// cancelled on shutdown, and local midnight of the day to post for.
+type DayFunc func(ctx context.Context, day time.Time) error
+
+// Scheduler computes each day's posting slots and waits for them on the wall clock.
+// Days are computed in the scheduler's location, so daylight saving changes and
+// midnight rollover follow the calendar rather than fixed 24-hour steps.
+type Scheduler struct {
+	start      time.Duration // Offset from local midnight of the first slot of a day
+	interval   time.Duration // Spacing between consecutive slots
+	retryDelay time.Duration // Delay before retrying a failed day
+	location   *time.Location
+	logger     zerolog.Logger
+	now        func() time.Time
+}
+
+// New creates a Scheduler whose first daily slot is at start past midnight in loc,
+// with subsequent slots every interval.
+func New(start time.Duration, interval time.Duration, loc *time.Location, logger zerolog.Logger) *Scheduler {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &Scheduler{
+		start:      start,
+		interval:   interval,
+		retryDelay: 10 * time.Minute,
+		location:   loc,
+		logger:     logger.With().Str("component", "Scheduler").Logger(),
+		now:        time.Now,
+	}
+}
+
+// ParseClock parses a "HH:MM" wall-clock time into an offset from midnight.
+func ParseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM: %w", clock, err)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Day returns local midnight of the calendar day containing t.
+func (s *Scheduler) Day(t time.Time) time.Time {
+	t = t.In(s.location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location)
+}
+
+// NextDay returns local midnight of the calendar day after day.
+func (s *Scheduler) NextDay(day time.Time) time.Time {
+	day = day.In(s.location)
+	return time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, s.location)
+}
+
+// Slots returns the wall-clock times of the first n posting slots of day.
+// Late slots may fall after midnight; they still belong to day.
+func (s *Scheduler) Slots(day time.Time, n int) []time.Time {
+	day = day.In(s.location)
+	// Build the first slot from wall-clock fields so it stays at the same local time on DST change days.
+	first := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, int(s.start/time.Second), 0, s.location)
+	slots := make([]time.Time, n)
+	for i := range slots {
+		slots[i] = first.Add(time.Duration(i) * s.interval)
+	}
+	return slots
+}
+
+// WaitUntil blocks until the wall clock reaches t or the context is cancelled.
+// Times in the past return immediately.
+func (s *Scheduler) WaitUntil(ctx context.Context, t time.Time) error {
+	d := t.Sub(s.now())
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run calls fn once per calendar day at the day's first slot, starting with the
+// current day, until the context is cancelled. A day that fails is retried after
+// a delay for as long as that day has not ended.
+func (s *Scheduler) Run(ctx context.Context, fn DayFunc) error {
+	day := s.Day(s.now())
+	for {
+		firstSlot := s.Slots(day, 1)[0]
+		s.logger.Info().Str("day", day.Format("2006-01-02")).Time("firstSlot", firstSlot).Msg("Waiting for the first posting slot of the day.")
+		if err := s.WaitUntil(ctx, firstSlot); err != nil {
+			return err
+		}
+
+		for {
+			err := fn(ctx, day)
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+			if !s.now().Before(s.NextDay(day)) {
+				s.logger.Error().Err(err).Str("day", day.Format("2006-01-02")).Msg("Day failed and has ended. Moving on to the next day.")
+				break
+			}
+			s.logger.Error().Err(err).Str("day", day.Format("2006-01-02")).Dur("retryIn", s.retryDelay).Msg("Day failed. Retrying.")
+			if err := s.WaitUntil(ctx, s.now().Add(s.retryDelay)); err != nil {
+				return err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Move on to the next calendar day. If the day's work ran past midnight,
+		// the following day still starts from its own midnight.
+		day = s.NextDay(day)
+		if today := s.Day(s.now()); today.After(day) {
+			day = today
+		}
+	}
+}
+
+// Interval returns the spacing between consecutive posting slots.
+func (s *Scheduler) Interval() time.Duration {
+	return s.interval
+}
@@ -0,0 +1,127 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s not available: %v", name, err)
+	}
+	return loc
+}
+
+func TestSlots(t *testing.T) {
+	newYork := loadLocation(t, "America/New_York")
+	tests := []struct {
+		name     string
+		start    string
+		interval time.Duration
+		day      time.Time
+		n        int
+		want     []string // Local wall-clock times with zone
+	}{
+		{
+			name:     "ordinary day",
+			start:    "15:00",
+			interval: 30 * time.Minute,
+			day:      time.Date(2026, 1, 3, 0, 0, 0, 0, newYork),
+			n:        3,
+			want:     []string{"2026-01-03 15:00 EST", "2026-01-03 15:30 EST", "2026-01-03 16:00 EST"},
+		},
+		{
+			name:     "spring forward keeps the wall-clock start",
+			start:    "15:00",
+			interval: 30 * time.Minute,
+			day:      time.Date(2026, 3, 8, 0, 0, 0, 0, newYork),
+			n:        2,
+			want:     []string{"2026-03-08 15:00 EDT", "2026-03-08 15:30 EDT"},
+		},
+		{
+			name:     "fall back keeps the wall-clock start",
+			start:    "15:00",
+			interval: 30 * time.Minute,
+			day:      time.Date(2026, 11, 1, 0, 0, 0, 0, newYork),
+			n:        2,
+			want:     []string{"2026-11-01 15:00 EST", "2026-11-01 15:30 EST"},
+		},
+		{
+			name:     "slots step across the spring forward gap in real time",
+			start:    "01:00",
+			interval: time.Hour,
+			day:      time.Date(2026, 3, 8, 0, 0, 0, 0, newYork),
+			n:        3,
+			want:     []string{"2026-03-08 01:00 EST", "2026-03-08 03:00 EDT", "2026-03-08 04:00 EDT"},
+		},
+		{
+			name:     "slots step across the repeated fall back hour in real time",
+			start:    "00:30",
+			interval: time.Hour,
+			day:      time.Date(2026, 11, 1, 0, 0, 0, 0, newYork),
+			n:        3,
+			want:     []string{"2026-11-01 00:30 EDT", "2026-11-01 01:30 EDT", "2026-11-01 01:30 EST"},
+		},
+		{
+			name:     "late slots run past midnight",
+			start:    "23:30",
+			interval: time.Hour,
+			day:      time.Date(2026, 1, 3, 0, 0, 0, 0, newYork),
+			n:        2,
+			want:     []string{"2026-01-03 23:30 EST", "2026-01-04 00:30 EST"},
+		},
+		{
+			name:     "day given in another zone",
+			start:    "15:00",
+			interval: time.Hour,
+			day:      time.Date(2026, 1, 3, 12, 0, 0, 0, time.UTC), // 07:00 in New York
+			n:        1,
+			want:     []string{"2026-01-03 15:00 EST"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, err := ParseClock(tt.start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := New(start, tt.interval, newYork, zerolog.Nop())
+			slots := s.Slots(tt.day, tt.n)
+			if len(slots) != len(tt.want) {
+				t.Fatalf("got %d slots, want %d", len(slots), len(tt.want))
+			}
+			for i, slot := range slots {
+				if got := slot.In(newYork).Format("2006-01-02 15:04 MST"); got != tt.want[i] {
+					t.Errorf("slot %d = %s, want %s", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNextDayAcrossDST(t *testing.T) {
+	newYork := loadLocation(t, "America/New_York")
+	s := New(0, time.Hour, newYork, zerolog.Nop())
+	tests := []struct {
+		day       time.Time
+		want      string
+		wantHours float64
+	}{
+		{time.Date(2026, 3, 8, 0, 0, 0, 0, newYork), "2026-03-09 00:00 EDT", 23},
+		{time.Date(2026, 11, 1, 0, 0, 0, 0, newYork), "2026-11-02 00:00 EST", 25},
+		{time.Date(2026, 12, 31, 0, 0, 0, 0, newYork), "2027-01-01 00:00 EST", 24},
+	}
+	for _, tt := range tests {
+		next := s.NextDay(tt.day)
+		if got := next.Format("2006-01-02 15:04 MST"); got != tt.want {
+			t.Errorf("NextDay(%s) = %s, want %s", tt.day.Format("2006-01-02"), got, tt.want)
+		}
+		if hours := next.Sub(tt.day).Hours(); hours != tt.wantHours {
+			t.Errorf("NextDay(%s) is %v hours later, want %v", tt.day.Format("2006-01-02"), hours, tt.wantHours)
+		}
+	}
+}
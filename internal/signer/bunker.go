@@ -0,0 +1,436 @@
+package signer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"calendar-bot/internal/keys"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/nbd-wtf/go-nostr/nip44"
+	"github.com/nbd-wtf/go-nostr/nip46"
+	"github.com/rs/zerolog"
+)
+
+// bunkerAttempts is how often a request that timed out or found no relay is sent before
+// giving up. A refusal by the signer is never retried.
+const bunkerAttempts = 2
+
+// BunkerURL is a parsed NIP-46 bunker:// connection URI:
+// bunker://<signer pubkey>?relay=wss://...&relay=wss://...&secret=...
+type BunkerURL struct {
+	SignerPubkey string   // Hex pubkey of the remote signer, not necessarily the bot's pubkey
+	Relays       []string // Relays the signer listens on
+	Secret       string   // Optional connection secret, often single-use
+}
+
+// ParseBunkerURL parses and checks a bunker:// URI. Errors never include the secret.
+func ParseBunkerURL(raw string) (BunkerURL, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return BunkerURL{}, errors.New("not a valid URL")
+	}
+	if parsed.Scheme != "bunker" {
+		return BunkerURL{}, fmt.Errorf("wrong scheme '%s'. Must be bunker://", parsed.Scheme)
+	}
+	if !nostr.IsValidPublicKey(parsed.Host) {
+		return BunkerURL{}, fmt.Errorf("'%s' is not a valid hex public key", parsed.Host)
+	}
+	query := parsed.Query()
+	bunkerURL := BunkerURL{SignerPubkey: parsed.Host, Secret: query.Get("secret")}
+	for _, relay := range query["relay"] {
+		relay = strings.TrimSpace(relay)
+		if !strings.HasPrefix(relay, "ws://") && !strings.HasPrefix(relay, "wss://") {
+			return BunkerURL{}, fmt.Errorf("invalid relay '%s'. Must start with ws:// or wss://", relay)
+		}
+		bunkerURL.Relays = append(bunkerURL.Relays, relay)
+	}
+	if len(bunkerURL.Relays) == 0 {
+		return BunkerURL{}, errors.New("no relay= parameter. The signer's relays are required")
+	}
+	return bunkerURL, nil
+}
+
+// String returns the URI with the secret replaced by "<redacted>", safe to print.
+func (u BunkerURL) String() string {
+	params := make([]string, 0, len(u.Relays)+1)
+	for _, relay := range u.Relays {
+		params = append(params, "relay="+relay)
+	}
+	if u.Secret != "" {
+		params = append(params, "secret=<redacted>")
+	}
+	return "bunker://" + u.SignerPubkey + "?" + strings.Join(params, "&")
+}
+
+// RedactBunkerURL returns raw with its secret masked, or "<redacted>" if it cannot be
+// parsed, since it may still contain the secret.
+func RedactBunkerURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	bunkerURL, err := ParseBunkerURL(raw)
+	if err != nil {
+		return "<redacted>"
+	}
+	return bunkerURL.String()
+}
+
+// Bunker signs events by sending NIP-46 requests to a remote signer, so the bot's private
+// key can stay on a separate signing host. Requests and responses travel as NIP-44
+// encrypted kind 24133 events over the signer's relays. Responses are subscribed to before
+// the first request is sent, and dropped relay connections are re-established in the
+// background.
+type Bunker struct {
+	signerPubkey    string
+	relays          []string
+	clientKey       keys.Key
+	conversationKey [32]byte
+	pool            *nostr.SimplePool
+	lifetime        context.Context
+	cancel          context.CancelFunc // Stops the response subscriptions and closes the pool
+	pubkey          string             // The bot's pubkey, as reported by the signer
+	timeout         time.Duration      // Per request
+	logger          zerolog.Logger
+
+	serial  atomic.Uint64
+	mu      sync.Mutex
+	pending map[string]chan nip46.Response // Requests waiting for a response, by ID
+}
+
+// ConnectBunker connects to the remote signer of a bunker:// URI and asks for its public
+// key. clientKey is the key the bot authenticates to the signer with; signers remember
+// authorized client keys, so a stable one avoids re-approving the bot on every start.
+// kinds are the event kinds the bot asks permission to sign. Each request, including the
+// connection, times out after timeout.
+func ConnectBunker(ctx context.Context, rawURL string, clientKey keys.Key, timeout time.Duration, kinds []int, logger zerolog.Logger) (*Bunker, error) {
+	bunkerURL, err := ParseBunkerURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bunker URL: %w", err)
+	}
+	conversationKey, err := nip44.GenerateConversationKey(bunkerURL.SignerPubkey, clientKey.Secret())
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive the encryption key for remote signer %s: %w", bunkerURL.SignerPubkey, err)
+	}
+
+	// The client lives until Close, not until ctx ends: ctx only bounds the connection.
+	lifetime, cancel := context.WithCancel(context.Background())
+	b := &Bunker{
+		signerPubkey:    bunkerURL.SignerPubkey,
+		relays:          bunkerURL.Relays,
+		clientKey:       clientKey,
+		conversationKey: conversationKey,
+		pool:            nostr.NewSimplePool(lifetime),
+		lifetime:        lifetime,
+		cancel:          cancel,
+		timeout:         timeout,
+		logger:          logger.With().Str("component", "Bunker").Logger(),
+		pending:         make(map[string]chan nip46.Response),
+	}
+
+	// Wait until at least one relay delivers responses, so the first answer is not missed.
+	subscribed := make(chan struct{}, len(b.relays))
+	for _, relay := range b.relays {
+		go b.listen(relay, subscribed)
+	}
+	subscribeCtx, cancelSubscribe := context.WithTimeout(ctx, timeout)
+	select {
+	case <-subscribed:
+		err = nil
+	case <-subscribeCtx.Done():
+		err = ErrUnreachable
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}
+	cancelSubscribe()
+
+	if err == nil {
+		perms := make([]string, 0, len(kinds))
+		for _, kind := range kinds {
+			perms = append(perms, "sign_event:"+strconv.Itoa(kind))
+		}
+		_, err = b.call(ctx, "connect", []string{b.signerPubkey, bunkerURL.Secret, strings.Join(perms, ",")})
+	}
+	if err == nil {
+		b.pubkey, err = b.call(ctx, "get_public_key", []string{})
+	}
+	if err == nil && !nostr.IsValidPublicKey(b.pubkey) {
+		err = fmt.Errorf("remote signer returned an invalid public key '%s'", b.pubkey)
+	}
+	if err != nil {
+		b.Close()
+		return nil, fmt.Errorf("failed to connect to remote signer %s: %w", b.signerPubkey, err)
+	}
+
+	npub, _ := nip19.EncodePublicKey(b.pubkey)
+	b.logger.Info().Str("npub", npub).Str("signerPubkey", b.signerPubkey).Strs("relays", b.relays).Msg("Connected to remote signer.")
+	return b, nil
+}
+
+// PublicKey returns the hex public key the remote signer signs with.
+func (b *Bunker) PublicKey() string {
+	return b.pubkey
+}
+
+// Sign asks the remote signer to sign the event and checks that the returned event is the
+// one requested, signed with the bot's pubkey. The event is left unchanged if signing fails.
+func (b *Bunker) Sign(ctx context.Context, ev *nostr.Event) error {
+	result, err := b.call(ctx, "sign_event", []string{ev.String()})
+	if err != nil {
+		return err
+	}
+	var signed nostr.Event
+	if err := json.Unmarshal([]byte(result), &signed); err != nil {
+		return fmt.Errorf("remote signer returned an invalid event: %w", err)
+	}
+	if signed.PubKey != b.pubkey {
+		return fmt.Errorf("remote signer signed with pubkey %s instead of %s", signed.PubKey, b.pubkey)
+	}
+	expected := *ev
+	expected.PubKey = signed.PubKey
+	if signed.ID != expected.GetID() {
+		return errors.New("remote signer returned a different event than requested")
+	}
+	if ok, err := signed.CheckSignature(); !ok {
+		return fmt.Errorf("remote signer returned an invalid signature: %v", err)
+	}
+	*ev = signed
+	return nil
+}
+
+// Close stops listening for responses and closes the relay connections.
+func (b *Bunker) Close() {
+	b.cancel()
+	b.pool.Close("signer closed")
+}
+
+// listen subscribes to responses on one relay and dispatches them until Close, sending on
+// subscribed once the subscription is active. It resubscribes with a growing delay when
+// the relay cannot be reached or drops the connection.
+func (b *Bunker) listen(relayURL string, subscribed chan<- struct{}) {
+	logger := b.logger.With().Str("relayURL", relayURL).Logger()
+	delay := time.Second
+	first := true
+	for b.lifetime.Err() == nil {
+		if err := b.subscribe(relayURL, subscribed, first); err != nil {
+			logger.Warn().Err(err).Dur("retryIn", delay).Msg("Failed to subscribe to remote signer relay.")
+		} else {
+			delay = time.Second
+			if b.lifetime.Err() == nil {
+				logger.Warn().Msg("Remote signer relay connection dropped. Reconnecting.")
+			}
+		}
+		first = false
+		select {
+		case <-b.lifetime.Done():
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, time.Minute)
+	}
+}
+
+// subscribe runs one response subscription on a relay until it ends. A nil error means the
+// subscription was active and later ended, e.g. because the connection dropped.
+func (b *Bunker) subscribe(relayURL string, subscribed chan<- struct{}, first bool) error {
+	relay, err := b.pool.EnsureRelay(relayURL)
+	if err != nil {
+		return err
+	}
+	now := nostr.Now()
+	sub, err := relay.Subscribe(b.lifetime, nostr.Filters{{
+		Kinds:     []int{nostr.KindNostrConnect},
+		Tags:      nostr.TagMap{"p": []string{b.clientKey.PublicKey()}},
+		Since:     &now,
+		LimitZero: true,
+	}})
+	if err != nil {
+		return err
+	}
+	defer sub.Unsub()
+
+	select {
+	case <-sub.EndOfStoredEvents:
+	case reason := <-sub.ClosedReason:
+		return fmt.Errorf("relay closed the subscription: %s", reason)
+	case <-sub.Context.Done():
+		return errors.New("connection closed before the subscription was active")
+	case <-time.After(b.timeout):
+		return errors.New("relay did not confirm the subscription in time")
+	}
+	if first {
+		subscribed <- struct{}{}
+	}
+	for {
+		select {
+		case ev, ok := <-sub.Events:
+			if !ok {
+				return nil
+			}
+			b.dispatch(ev)
+		case reason := <-sub.ClosedReason:
+			return fmt.Errorf("relay closed the subscription: %s", reason)
+		case <-sub.Context.Done():
+			return nil
+		}
+	}
+}
+
+// dispatch decrypts a response event from the signer and hands it to the waiting request.
+// Events from other authors, undecryptable ones and answers to unknown requests (e.g. to a
+// retried request that was already answered) are ignored.
+func (b *Bunker) dispatch(ev *nostr.Event) {
+	if ev.PubKey != b.signerPubkey {
+		return
+	}
+	if ok, _ := ev.CheckSignature(); !ok {
+		return
+	}
+	plaintext, err := nip44.Decrypt(ev.Content, b.conversationKey)
+	if err != nil {
+		b.logger.Debug().Err(err).Str("eventID", ev.ID).Msg("Failed to decrypt remote signer response.")
+		return
+	}
+	var resp nip46.Response
+	if err := json.Unmarshal([]byte(plaintext), &resp); err != nil {
+		b.logger.Debug().Err(err).Str("eventID", ev.ID).Msg("Failed to parse remote signer response.")
+		return
+	}
+	b.mu.Lock()
+	responses, ok := b.pending[resp.ID]
+	b.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case responses <- resp:
+	default:
+	}
+}
+
+// call runs one request with the per-request timeout, retrying once if the signer did not
+// answer or could not be reached. Refusals by the signer are returned as
+// ErrPermissionDenied or a plain error and are not retried.
+func (b *Bunker) call(ctx context.Context, method string, params []string) (string, error) {
+	var err error
+	for attempt := 1; attempt <= bunkerAttempts; attempt++ {
+		requestCtx, cancel := context.WithTimeout(ctx, b.timeout)
+		var result string
+		result, err = b.request(requestCtx, method, params)
+		cancel()
+		switch {
+		case err == nil:
+			return result, nil
+		case ctx.Err() != nil:
+			return "", ctx.Err()
+		case errors.Is(err, context.DeadlineExceeded):
+			err = fmt.Errorf("%w (%s)", ErrTimeout, b.timeout)
+		case !errors.Is(err, ErrUnreachable):
+			return "", err
+		}
+		if attempt < bunkerAttempts {
+			b.logger.Warn().Err(err).Str("method", method).Msg("Remote signer request failed. Retrying.")
+		}
+	}
+	return "", err
+}
+
+// request sends one encrypted request to the signer's relays and waits for its response.
+func (b *Bunker) request(ctx context.Context, method string, params []string) (string, error) {
+	id := strconv.FormatUint(b.serial.Add(1), 10) + "-" + method
+	payload, err := json.Marshal(nip46.Request{ID: id, Method: method, Params: params})
+	if err != nil {
+		return "", err
+	}
+	content, err := nip44.Encrypt(string(payload), b.conversationKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt request: %w", err)
+	}
+	ev := nostr.Event{
+		Kind:      nostr.KindNostrConnect,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"p", b.signerPubkey}},
+		Content:   content,
+	}
+	if err := b.clientKey.Sign(&ev); err != nil {
+		return "", fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	responses := make(chan nip46.Response, 4)
+	b.mu.Lock()
+	b.pending[id] = responses
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.pending, id)
+		b.mu.Unlock()
+	}()
+
+	if err := b.send(ctx, ev); err != nil {
+		return "", err
+	}
+	for {
+		select {
+		case resp := <-responses:
+			if resp.Result == "auth_url" {
+				b.logger.Warn().Str("authURL", resp.Error).Msg("Remote signer asks for authorization. Open the URL to approve the bot.")
+				continue
+			}
+			if resp.Error != "" {
+				if isPermissionError(resp.Error) {
+					return "", fmt.Errorf("%w: %s", ErrPermissionDenied, resp.Error)
+				}
+				return "", fmt.Errorf("remote signer refused the request: %s", resp.Error)
+			}
+			return resp.Result, nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// send publishes a request event to all of the signer's relays and returns once one of
+// them accepted it, or ErrUnreachable if none did.
+func (b *Bunker) send(ctx context.Context, ev nostr.Event) error {
+	results := make(chan error, len(b.relays))
+	for _, relayURL := range b.relays {
+		go func() {
+			relay, err := b.pool.EnsureRelay(relayURL)
+			if err == nil {
+				err = relay.Publish(ctx, ev)
+			}
+			results <- err
+		}()
+	}
+	var lastErr error
+	for range b.relays {
+		if lastErr = <-results; lastErr == nil {
+			return nil
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("%w: %v", ErrUnreachable, lastErr)
+}
+
+// isPermissionError reports whether a signer's error reason means the request was not
+// allowed, as opposed to failing. Signers word this differently, so it matches loosely.
+func isPermissionError(reason string) bool {
+	reason = strings.ToLower(reason)
+	for _, word := range []string{"permission", "not allowed", "denied", "unauthorized", "not authorized", "rejected", "forbidden"} {
+		if strings.Contains(reason, word) {
+			return true
+		}
+	}
+	return false
+}
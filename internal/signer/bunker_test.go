@@ -0,0 +1,73 @@
+package signer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testSignerPubkey = "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+
+func TestParseBunkerURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    BunkerURL
+		wantErr string
+	}{
+		{
+			name: "one relay",
+			raw:  "bunker://" + testSignerPubkey + "?relay=wss://relay.example",
+			want: BunkerURL{SignerPubkey: testSignerPubkey, Relays: []string{"wss://relay.example"}},
+		},
+		{
+			name: "relays and secret",
+			raw:  "  bunker://" + testSignerPubkey + "?relay=wss://a.example&relay=ws%3A%2F%2Fb.example%3A7777&secret=s3cret\n",
+			want: BunkerURL{SignerPubkey: testSignerPubkey, Relays: []string{"wss://a.example", "ws://b.example:7777"}, Secret: "s3cret"},
+		},
+		{name: "wrong scheme", raw: "nostrconnect://" + testSignerPubkey + "?relay=wss://a.example", wantErr: "wrong scheme 'nostrconnect'"},
+		{name: "npub instead of hex", raw: "bunker://npub1abc?relay=wss://a.example", wantErr: "'npub1abc' is not a valid hex public key"},
+		{name: "short pubkey", raw: "bunker://" + testSignerPubkey[:60] + "?relay=wss://a.example", wantErr: "is not a valid hex public key"},
+		{name: "no relay", raw: "bunker://" + testSignerPubkey + "?secret=s3cret", wantErr: "no relay= parameter"},
+		{name: "https relay", raw: "bunker://" + testSignerPubkey + "?relay=https://a.example&secret=s3cret", wantErr: "invalid relay 'https://a.example'"},
+		{name: "not a URL", raw: "bunker://%zz?secret=s3cret", wantErr: "not a valid URL"},
+		{name: "empty", raw: "", wantErr: "wrong scheme ''"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBunkerURL(tt.raw)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseBunkerURL() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				if strings.Contains(err.Error(), "s3cret") {
+					t.Errorf("ParseBunkerURL() error %q includes the secret", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBunkerURL(): %v", err)
+			}
+			if got.SignerPubkey != tt.want.SignerPubkey || !slices.Equal(got.Relays, tt.want.Relays) || got.Secret != tt.want.Secret {
+				t.Errorf("ParseBunkerURL() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactBunkerURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", ""},
+		{"bunker://" + testSignerPubkey + "?relay=wss://a.example", "bunker://" + testSignerPubkey + "?relay=wss://a.example"},
+		{"bunker://" + testSignerPubkey + "?secret=s3cret&relay=wss://a.example", "bunker://" + testSignerPubkey + "?relay=wss://a.example&secret=<redacted>"},
+		{"bunker://" + testSignerPubkey + "?secret=s3cret", "<redacted>"},
+	}
+	for _, tt := range tests {
+		if got := RedactBunkerURL(tt.raw); got != tt.want {
+			t.Errorf("RedactBunkerURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package signer
+
+import (
+	"context"
+	"errors"
+
+	"calendar-bot/internal/keys"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Signer signs events as the bot's identity. The private key may live in this process
+// (Local) or on a separate signing host reached over NIP-46 (Bunker).
+type Signer interface {
+	// PublicKey returns the hex public key events are signed with.
+	PublicKey() string
+	// Sign sets the event's pubkey, ID and signature. It fails if ctx is cancelled first.
+	Sign(ctx context.Context, ev *nostr.Event) error
+	// Close releases the signer's connections.
+	Close()
+}
+
+var (
+	// ErrPermissionDenied is returned when a remote signer refuses to sign, e.g. because the
+	// bot was not granted sign_event for the event's kind.
+	ErrPermissionDenied = errors.New("remote signer denied the request")
+	// ErrTimeout is returned when a remote signer does not answer within the timeout.
+	ErrTimeout = errors.New("remote signer did not answer in time")
+	// ErrUnreachable is returned when none of the remote signer's relays can be reached.
+	ErrUnreachable = errors.New("no relay of the remote signer is reachable")
+)
+
+// Local signs with a private key held in this process.
+type Local struct {
+	key keys.Key
+}
+
+// NewLocal creates a Signer for a loaded private key.
+func NewLocal(key keys.Key) *Local {
+	return &Local{key: key}
+}
+
+// PublicKey returns the hex public key of the private key.
+func (l *Local) PublicKey() string {
+	return l.key.PublicKey()
+}
+
+// Sign signs the event in place. Signing is local, so ctx is only checked before starting.
+func (l *Local) Sign(ctx context.Context, ev *nostr.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.key.Sign(ev)
+}
+
+// Close does nothing; a local key holds no connections.
+func (l *Local) Close() {}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"calendar-bot/internal/config"
+	"calendar-bot/internal/keys"
+	"calendar-bot/internal/signer"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/rs/zerolog"
+)
+
+// runKeys implements `calendar-bot keys`: `keys generate` creates a new identity and
+// `keys show` prints the public key of a configured one. Secrets are only ever printed
+// for a freshly generated key.
+func runKeys(args []string) int {
+	fs := newFlagSet("keys", "generate | show [ENV_VAR]", "generate: create a new key pair and print it (store the secret key safely).\nshow: print the public key (hex and npub) of the private key in ENV_VAR or --key-file, or of the selected profile.\nWith BOT_BUNKER_URL or a profile's bunker_env set, show connects to the remote signer and prints its key.")
+	keyEnv := fs.String("key-env", "", "show: env var holding the private key (instead of ENV_VAR)")
+	keyFile := fs.String("key-file", "", "show: file holding the private key, e.g. a Docker secret (instead of ENV_VAR)")
+	keyPasswordFile := fs.String("key-password-file", "", "show: file holding the password of an ncryptsec key")
+	configFile := fs.String("config", "", "show: YAML or TOML config file declaring profiles (BOT_CONFIG_FILE)")
+	profile := fs.String("profile", "", "show: profile of the config file whose key to show (BOT_PROFILE)")
+	positional, code := parseFlags(fs, args)
+	if code >= 0 {
+		return code
+	}
+	if len(positional) == 0 {
+		return usageError(fs, "keys requires a subcommand: generate or show")
+	}
+
+	switch positional[0] {
+	case "generate":
+		if len(positional) > 1 {
+			return usageError(fs, "keys generate takes no arguments")
+		}
+		secretKey := gonostr.GeneratePrivateKey()
+		nsec, err := nip19.EncodePrivateKey(secretKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode private key: %v\n", err)
+			return exitFailure
+		}
+		key, err := keys.Parse(secretKey, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to derive public key: %v\n", err)
+			return exitFailure
+		}
+		fmt.Printf("private key (hex): %s\n", secretKey)
+		fmt.Printf("nsec:              %s\n", nsec)
+		printPublicKey(key.PublicKey(), key.Npub())
+		return exitOK
+	case "show":
+		keyEnvVar, code := keyEnvName(fs, *keyEnv, positional[1:])
+		if code >= 0 {
+			return code
+		}
+		cfg, err := config.Read(keyEnvVar, func(cfg *config.Config) error {
+			setIfGiven(&cfg.KeyFile, *keyFile)
+			setIfGiven(&cfg.KeyPasswordFile, *keyPasswordFile)
+			setIfGiven(&cfg.ConfigFile, *configFile)
+			setIfGiven(&cfg.Profile, *profile)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+			return exitConfig
+		}
+		if err := cfg.KeyError(); err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration error: invalid private key: %v\n", err)
+			return exitConfig
+		}
+		if cfg.BunkerURL != "" || cfg.BunkerEnv != "" {
+			return showRemoteKey(cfg)
+		}
+		if cfg.PrivateKey.IsZero() {
+			if cfg.EnvVarForPrivateKey != "" || cfg.KeyFile != "" {
+				fmt.Fprintf(os.Stderr, "Configuration error: %s is not set\n", cfg.EnvVarForPrivateKey+cfg.KeyFile)
+				return exitConfig
+			}
+			return usageError(fs, "keys show requires ENV_VAR, --key-env, --key-file or a profile with key_env")
+		}
+		printPublicKey(cfg.PrivateKey.PublicKey(), cfg.PrivateKey.Npub())
+		return exitOK
+	default:
+		return usageError(fs, "Unknown keys subcommand '%s'. Must be generate or show", positional[0])
+	}
+}
+
+// showRemoteKey connects to the remote signer of cfg and prints the public key it signs with.
+func showRemoteKey(cfg *config.Config) int {
+	if cfg.BunkerURL == "" {
+		fmt.Fprintf(os.Stderr, "Configuration error: %s is not set\n", cfg.BunkerEnv)
+		return exitConfig
+	}
+	if _, err := signer.ParseBunkerURL(cfg.BunkerURL); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: invalid BunkerURL: %v\n", err)
+		return exitConfig
+	}
+	remote, err := newSigner(cfg, zerolog.Nop())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to remote signer: %v\n", err)
+		return exitFailure
+	}
+	defer remote.Close()
+	npub, err := nip19.EncodePublicKey(remote.PublicKey())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode public key: %v\n", err)
+		return exitFailure
+	}
+	printPublicKey(remote.PublicKey(), npub)
+	return exitOK
+}
+
+// printPublicKey prints a public key in hex and as an npub.
+func printPublicKey(pubkey string, npub string) {
+	fmt.Printf("public key (hex):  %s\n", pubkey)
+	fmt.Printf("npub:              %s\n", npub)
+}
+
+// setIfGiven sets dst to value unless value is empty.
+func setIfGiven(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
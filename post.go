@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"calendar-bot/internal/scheduler"
+
+	"github.com/rs/zerolog/log"
+)
+
+// runPost implements `calendar-bot post`: it publishes a single API event right away,
+// e.g. to repost one event that failed, without waiting for the next run.
+func runPost(args []string) int {
+	fs := newFlagSet("post", "--event ID [--date D] [flags] [ENV_VAR]", "Publish every kind of Nostr event for one API event right away. The publish ledger still prevents double posts.")
+	keyEnv := fs.String("key-env", "", "env var holding the private key (instead of ENV_VAR)")
+	eventID := fs.Uint("event", 0, "ID of the API event to post (required)")
+	date := fs.String("date", "", "posting date the event belongs to, MM-DD or YYYY-MM-DD (default: today)")
+	overrides := addConfigFlags(fs)
+	positional, code := parseFlags(fs, args)
+	if code >= 0 {
+		return code
+	}
+	keyEnvVar, code := keyEnvName(fs, *keyEnv, positional)
+	if code >= 0 {
+		return code
+	}
+	if *eventID == 0 {
+		return usageError(fs, "post requires --event")
+	}
+	day, code := parseDateFlag(fs, *date)
+	if code >= 0 {
+		return code
+	}
+
+	cfg, code := loadConfig(keyEnvVar, overrides(), true, "post")
+	if code >= 0 {
+		return code
+	}
+	s, err := openSession(cfg, nil)
+	if err != nil {
+		return exitFailure
+	}
+	defer s.Close()
+	ctx, stop := signalContext()
+	defer stop()
+
+	err = s.bot.PostEvent(ctx, day, *eventID)
+	switch {
+	case errors.Is(err, context.Canceled):
+		log.Info().Msg("Post interrupted. Run it again to resume on the remaining relays.")
+		s.finish("interrupted")
+		return exitInterrupted
+	case err != nil:
+		log.Error().Err(err).Uint("apiEventID", *eventID).Msg("Failed to post event.")
+		fmt.Fprintf(os.Stderr, "Post failed: %v\n", err)
+		s.finish("error")
+		return exitFailure
+	}
+	s.finish("post")
+	return exitOK
+}
+
+// runDelete implements `calendar-bot delete`: it sends a NIP-09 deletion request for the
+// Nostr events the ledger recorded for an API event.
+func runDelete(args []string) int {
+	fs := newFlagSet("delete", "--event ID [--date D] [flags] [ENV_VAR]", "Send a NIP-09 deletion request for the Nostr events the publish ledger recorded for one API event.\nRelays and clients may honor it or not; the entries stay in the ledger so the event is not posted again.")
+	keyEnv := fs.String("key-env", "", "env var holding the private key (instead of ENV_VAR)")
+	eventID := fs.Uint("event", 0, "ID of the API event whose Nostr events to delete (required)")
+	date := fs.String("date", "", "posting date of the events, MM-DD or YYYY-MM-DD (default: today)")
+	kinds := fs.String("kinds", "", "comma-separated kinds to delete, e.g. kind20 (default: all)")
+	reason := fs.String("reason", "", "reason included in the deletion request")
+	overrides := addConfigFlags(fs)
+	positional, code := parseFlags(fs, args)
+	if code >= 0 {
+		return code
+	}
+	keyEnvVar, code := keyEnvName(fs, *keyEnv, positional)
+	if code >= 0 {
+		return code
+	}
+	if *eventID == 0 {
+		return usageError(fs, "delete requires --event")
+	}
+	day, code := parseDateFlag(fs, *date)
+	if code >= 0 {
+		return code
+	}
+
+	cfg, code := loadConfig(keyEnvVar, overrides(), true, "delete")
+	if code >= 0 {
+		return code
+	}
+	s, err := openSession(cfg, nil)
+	if err != nil {
+		return exitFailure
+	}
+	defer s.Close()
+	ctx, stop := signalContext()
+	defer stop()
+
+	deletion, entries, err := s.bot.DeleteEvent(ctx, day, *eventID, splitList(*kinds), *reason)
+	if err != nil {
+		log.Error().Err(err).Uint("apiEventID", *eventID).Msg("Failed to delete events.")
+		fmt.Fprintf(os.Stderr, "Delete failed: %v\n", err)
+		if ctx.Err() != nil {
+			return exitInterrupted
+		}
+		return exitFailure
+	}
+	fmt.Printf("Deletion request %s sent for:\n", deletion.ID)
+	for _, entry := range entries {
+		fmt.Printf("  %s %s\n", entry.Kind, entry.NostrEventID)
+	}
+	return exitOK
+}
+
+// parseDateFlag parses an optional MM-DD or YYYY-MM-DD date flag, defaulting to today.
+// The int result is the exit code to return if the date is invalid, or -1.
+func parseDateFlag(fs *flag.FlagSet, value string) (time.Time, int) {
+	now := time.Now()
+	if value == "" {
+		return today(now), -1
+	}
+	day, err := scheduler.ParseDay(value, now)
+	if err != nil {
+		return time.Time{}, usageError(fs, "Invalid --date: %v", err)
+	}
+	return day, -1
+}
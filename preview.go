@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"calendar-bot/internal/api"
+	"calendar-bot/internal/bot"
+	"calendar-bot/internal/config"
+	"calendar-bot/internal/metrics"
+	"calendar-bot/internal/nostr"
+	"calendar-bot/internal/scheduler"
+)
+
+// runPreview implements `calendar-bot preview`: it fetches the events of a date and prints
+// the Nostr events a run would publish, without signing, relays or waits.
+// Returns the process exit code.
+func runPreview(args []string) int {
+	fs := newFlagSet("preview", "[flags]", "Print the Nostr events a run would publish for a date, without signing, relays or waits.")
+	date := fs.String("date", "", "date or FROM..TO range to preview, MM-DD or YYYY-MM-DD (default: today)")
+	format := fs.String("format", bot.PreviewFormatText, "output format: text or json")
+	keyEnv := fs.String("key-env", "", "env var holding the private key; if set, previews include the pubkey and event IDs")
+	overrides := addConfigFlags(fs)
+	positional, code := parseFlags(fs, args)
+	if code >= 0 {
+		return code
+	}
+	if len(positional) > 0 {
+		return usageError(fs, "Unexpected arguments: %s", strings.Join(positional, " "))
+	}
+	if *format != bot.PreviewFormatText && *format != bot.PreviewFormatJSON {
+		return usageError(fs, "Invalid --format '%s'. Must be text or json", *format)
+	}
+
+	now := time.Now()
+	days := []time.Time{now}
+	if *date != "" {
+		parsed, err := scheduler.ParseDays(*date, now)
+		if err != nil {
+			return usageError(fs, "Invalid --date: %v", err)
+		}
+		days = parsed
+	}
+
+	cfgs, code := loadConfigs(*keyEnv, overrides(), false, "preview")
+	if code >= 0 {
+		return code
+	}
+	return previewDays(cfgs, days, *format)
+}
+
+// previewDays prints the previews of the given days, for every configured identity.
+// It backs both `preview` and `--dry-run`.
+func previewDays(cfgs []*config.Config, days []time.Time, format string) int {
+	ctx, stop := signalContext()
+	defer stop()
+
+	var previews []bot.Preview
+	for _, cfg := range cfgs {
+		cfgPreviews, err := previewConfig(ctx, cfg, days)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Preview failed: %v\n", err)
+			return exitFailure
+		}
+		previews = append(previews, cfgPreviews...)
+	}
+	if err := bot.WritePreviews(os.Stdout, previews, format); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write previews: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// previewConfig builds the previews of the given days as one identity. Failures are logged.
+func previewConfig(ctx context.Context, cfg *config.Config, days []time.Time) ([]bot.Preview, error) {
+	logger := sessionLogger(cfg)
+	if err := cfg.KeyError(); err != nil {
+		logger.Error().Err(err).Msg("Failed to load private key. Previewing without it.")
+	}
+	pubkey := cfg.PrivateKey.PublicKey()
+	if cfg.BunkerURL != "" {
+		// The private key is only the remote signer's client key; previews do not connect to the signer.
+		logger.Info().Msg("The key is held by a remote signer. Previewing without the pubkey.")
+		pubkey = ""
+	}
+
+	templates, err := bot.ParseTemplates(cfg.Templates)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to parse content templates.")
+		return nil, err
+	}
+
+	// The relays the article would be published to, as hints in the notes' links to it
+	articleRelays := cfg.NostrRelays
+	if relays := cfg.KindRelays[metrics.KindArticle]; len(relays) > 0 {
+		articleRelays = relays
+	}
+
+	apiClient := api.NewClient(cfg.APIEndpoint, cfg.APIKey)
+	previewBot := bot.New(apiClient, nil, nostr.NewImageValidator(cfg.ImageMaxBytes, cfg.VideoMaxBytes), nil, cfg.ProcessingLanguage, logger)
+	previewBot.SetTemplates(templates)
+	previewBot.SetMaxImages(cfg.ImageMaxPerEvent)
+
+	var previews []bot.Preview
+	for _, day := range days {
+		logger.Info().Str("date", day.Format("2006-01-02")).Msg("Previewing events. Nothing will be signed or published.")
+		dayPreviews, err := previewBot.PreviewDay(ctx, day, pubkey, articleRelays)
+		if err != nil {
+			logger.Error().Err(err).Msg("Preview failed.")
+			return nil, err
+		}
+		for i := range dayPreviews {
+			dayPreviews[i].Profile = cfg.Profile
+		}
+		previews = append(previews, dayPreviews...)
+	}
+	return previews, nil
+}
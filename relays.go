@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"calendar-bot/internal/config"
+	"calendar-bot/internal/nostr"
+)
+
+// runRelays implements `calendar-bot relays`: it connects to every configured relay,
+// including the per-kind relays of the selected profile, or of every profile if none is
+// selected (or to the relays given as arguments), and reports which ones are reachable.
+func runRelays(args []string) int {
+	fs := newFlagSet("relays", "[flags] [RELAY...]", "Connect to each relay (NOSTR_RELAYS, --relays, or the RELAY arguments) and report which ones are reachable.\nExits with 1 if any relay is unreachable.")
+	timeout := fs.Duration("timeout", 10*time.Second, "connection timeout per relay")
+	overrides := addConfigFlags(fs)
+	positional, code := parseFlags(fs, args)
+	if code >= 0 {
+		return code
+	}
+	if *timeout <= 0 {
+		return usageError(fs, "Invalid --timeout '%s'. Must be positive", *timeout)
+	}
+
+	cfg, code := loadConfig("", overrides(), false, "relays")
+	if code >= 0 {
+		return code
+	}
+	relays := configuredRelays(cfg)
+	if len(positional) > 0 {
+		relays = positional
+	}
+	if len(relays) == 0 {
+		fmt.Fprintln(os.Stderr, "Configuration error: no relays configured. Set NOSTR_RELAYS, --relays or pass relay URLs.")
+		return exitConfig
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	checks := nostr.CheckRelays(ctx, relays, *timeout)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RELAY\tSTATUS\tCONNECT\tERROR")
+	unreachable := 0
+	for _, check := range checks {
+		status, errText := "ok", ""
+		if !check.Connected {
+			unreachable++
+			status, errText = "unreachable", check.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%dms\t%s\n", check.URL, status, check.ConnectTime.Milliseconds(), errText)
+	}
+	if err := tw.Flush(); err != nil {
+		return exitFailure
+	}
+	if ctx.Err() != nil {
+		return exitInterrupted
+	}
+	if unreachable > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// configuredRelays returns the relays and per-kind relays of cfg without duplicates. With
+// several profiles declared and none selected, the relays of every profile are included.
+func configuredRelays(cfg *config.Config) []string {
+	relays := slices.Clone(cfg.NostrRelays)
+	add := func(urls []string) {
+		for _, relay := range urls {
+			if !slices.Contains(relays, relay) {
+				relays = append(relays, relay)
+			}
+		}
+	}
+	addKinds := func(kindRelays map[string][]string) {
+		for _, kind := range config.SortedKeys(kindRelays) {
+			add(kindRelays[kind])
+		}
+	}
+	addKinds(cfg.KindRelays)
+	if cfg.Profile == "" {
+		for _, profile := range cfg.Profiles {
+			add(profile.Relays)
+			addKinds(profile.KindRelays)
+		}
+	}
+	return relays
+}
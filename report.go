@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"calendar-bot/internal/metrics"
+	"calendar-bot/internal/report"
+)
+
+// runReport implements `calendar-bot report`: it reads the exported metrics files and
+// prints per-day and per-relay trends. It needs no private key or API access.
+// Returns the process exit code.
+func runReport(args []string) int {
+	fs := newFlagSet("report", "[flags]", "Summarize the exported metrics files as per-day and per-relay trends.")
+	dir := fs.String("dir", "metrics-logs", "directory containing the exported metrics files")
+	profile := fs.String("profile", "", "report on one config file profile, whose files are in a subdirectory of --dir")
+	fromFlag := fs.String("from", "", "first day to include, YYYY-MM-DD (default: --days before --to)")
+	toFlag := fs.String("to", "", "last day to include, YYYY-MM-DD (default: today)")
+	days := fs.Int("days", 30, "number of days to include when --from is not set")
+	format := fs.String("format", report.FormatTable, "output format: table, json or csv")
+	view := fs.String("by", report.ViewAll, "what to show: all, day, relay or relay-day")
+	pruneDays := fs.Int("prune-days", 0, "delete metrics files older than this many days before reporting (0 keeps everything)")
+	positional, code := parseFlags(fs, args)
+	if code >= 0 {
+		return code
+	}
+	if len(positional) > 0 {
+		return usageError(fs, "Unexpected arguments: %s", strings.Join(positional, " "))
+	}
+	if *profile != "" {
+		*dir = filepath.Join(*dir, *profile)
+	}
+	if err := report.ValidateOptions(*format, *view); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid report options: %v\n", err)
+		return exitUsage
+	}
+
+	to := time.Now()
+	if *toFlag != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", *toFlag, time.Local)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --to '%s'. Must be YYYY-MM-DD\n", *toFlag)
+			return exitUsage
+		}
+		to = parsed
+	}
+	if *days < 1 {
+		fmt.Fprintln(os.Stderr, "Invalid --days. Must be at least 1")
+		return exitUsage
+	}
+	from := to.AddDate(0, 0, -(*days - 1))
+	if *fromFlag != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", *fromFlag, time.Local)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --from '%s'. Must be YYYY-MM-DD\n", *fromFlag)
+			return exitUsage
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		fmt.Fprintln(os.Stderr, "Invalid range: --from is after --to")
+		return exitUsage
+	}
+
+	if *pruneDays < 0 {
+		fmt.Fprintln(os.Stderr, "Invalid --prune-days. Must not be negative")
+		return exitUsage
+	}
+	if *pruneDays > 0 {
+		removed, err := metrics.PruneDir(*dir, time.Now().AddDate(0, 0, -*pruneDays))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to prune metrics files: %v\n", err)
+			return exitFailure
+		}
+		fmt.Fprintf(os.Stderr, "Pruned %d metrics files older than %d days.\n", len(removed), *pruneDays)
+	}
+
+	runs, warnings, err := report.Load(*dir, from, to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load metrics: %v\n", err)
+		return exitFailure
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Skipping unreadable metrics file: %v\n", warning)
+	}
+
+	if err := report.Write(os.Stdout, report.Build(runs, from, to), *format, *view); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write report: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"calendar-bot/internal/api"
+	"calendar-bot/internal/blossom"
+	"calendar-bot/internal/bot"
+	"calendar-bot/internal/card"
+	"calendar-bot/internal/config"
+	"calendar-bot/internal/keys"
+	"calendar-bot/internal/ledger"
+	"calendar-bot/internal/media"
+	"calendar-bot/internal/metrics"
+	"calendar-bot/internal/nip96"
+	"calendar-bot/internal/nostr"
+	"calendar-bot/internal/scheduler"
+	"calendar-bot/internal/signer"
+
+	gonostr "github.com/nbd-wtf/go-nostr"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// runRun implements `calendar-bot run`, also used for the original positional command line:
+// it publishes the events of today, or of the dates given with --date, once and exits.
+func runRun(args []string) int {
+	fs := newFlagSet("run", "[flags] [ENV_VAR]", "Publish today's events, or the events of the dates given with --date, once and exit.")
+	keyEnv := fs.String("key-env", "", "env var holding the private key (instead of ENV_VAR)")
+	date := fs.String("date", "", "date or FROM..TO range to post, MM-DD or YYYY-MM-DD (default: today)")
+	pace := fs.Duration("pace", 0, "wait after each published event (default 30m)")
+	dryRun := fs.Bool("dry-run", false, "print the events instead of signing and publishing them")
+	overrides := addConfigFlags(fs)
+	positional, code := parseFlags(fs, args)
+	if code >= 0 {
+		return code
+	}
+	keyEnvVar, code := keyEnvName(fs, *keyEnv, positional)
+	if code >= 0 {
+		return code
+	}
+	if *pace < 0 {
+		return usageError(fs, "Invalid --pace '%s'. Must not be negative", *pace)
+	}
+
+	now := time.Now()
+	days := []time.Time{today(now)}
+	if *date != "" {
+		parsed, err := scheduler.ParseDays(*date, now)
+		if err != nil {
+			return usageError(fs, "Invalid --date: %v", err)
+		}
+		days = parsed
+	}
+
+	return publishDays(publishOptions{
+		mode:      "run",
+		keyEnv:    keyEnvVar,
+		overrides: overrides(),
+		days:      days,
+		pace:      *pace,
+		paceSet:   isFlagSet(fs, "pace"),
+		dryRun:    *dryRun,
+	})
+}
+
+// runBackfill implements `calendar-bot backfill`: it publishes the events of every day in
+// a range, paced by BOT_BACKFILL_PACE, skipping whatever the ledger already has.
+func runBackfill(args []string) int {
+	fs := newFlagSet("backfill", "--from D [--to D] [flags] [ENV_VAR]", "Publish the events of every day from --from to --to, skipping what the publish ledger already has.")
+	keyEnv := fs.String("key-env", "", "env var holding the private key (instead of ENV_VAR)")
+	from := fs.String("from", "", "first day to post, MM-DD or YYYY-MM-DD (required)")
+	to := fs.String("to", "", "last day to post, MM-DD or YYYY-MM-DD (default: today)")
+	pace := fs.Duration("pace", 0, "wait after each published event (default BOT_BACKFILL_PACE)")
+	dryRun := fs.Bool("dry-run", false, "print the events instead of signing and publishing them")
+	overrides := addConfigFlags(fs)
+	positional, code := parseFlags(fs, args)
+	if code >= 0 {
+		return code
+	}
+	keyEnvVar, code := keyEnvName(fs, *keyEnv, positional)
+	if code >= 0 {
+		return code
+	}
+	if *from == "" {
+		return usageError(fs, "backfill requires --from")
+	}
+	if *pace < 0 {
+		return usageError(fs, "Invalid --pace '%s'. Must not be negative", *pace)
+	}
+
+	now := time.Now()
+	fromDay, err := scheduler.ParseDay(*from, now)
+	if err != nil {
+		return usageError(fs, "Invalid --from: %v", err)
+	}
+	toDay := today(now)
+	if *to != "" {
+		if toDay, err = scheduler.ParseDay(*to, now); err != nil {
+			return usageError(fs, "Invalid --to: %v", err)
+		}
+	}
+	days, err := scheduler.DaysBetween(fromDay, toDay)
+	if err != nil {
+		return usageError(fs, "Invalid range: %v", err)
+	}
+
+	return publishDays(publishOptions{
+		mode:      "backfill",
+		keyEnv:    keyEnvVar,
+		overrides: overrides(),
+		days:      days,
+		pace:      *pace,
+		paceSet:   isFlagSet(fs, "pace"),
+		dryRun:    *dryRun,
+	})
+}
+
+// runDaemonCommand implements `calendar-bot daemon`: it keeps running and posts each
+// day's events at the scheduler's slots.
+func runDaemonCommand(args []string) int {
+	fs := newFlagSet("daemon", "[flags] [ENV_VAR]", "Run continuously, posting each day's events at the slots set by --schedule-start and --schedule-interval.")
+	keyEnv := fs.String("key-env", "", "env var holding the private key (instead of ENV_VAR)")
+	dryRun := fs.Bool("dry-run", false, "print today's events instead of starting the daemon")
+	overrides := addConfigFlags(fs)
+	positional, code := parseFlags(fs, args)
+	if code >= 0 {
+		return code
+	}
+	keyEnvVar, code := keyEnvName(fs, *keyEnv, positional)
+	if code >= 0 {
+		return code
+	}
+
+	return publishDays(publishOptions{
+		mode:      "daemon",
+		keyEnv:    keyEnvVar,
+		overrides: overrides(),
+		days:      []time.Time{today(time.Now())},
+		dryRun:    *dryRun,
+	})
+}
+
+// publishOptions are the parsed command line of run, backfill and daemon.
+type publishOptions struct {
+	mode      string // "run", "backfill" or "daemon"
+	keyEnv    string
+	overrides []config.Override
+	days      []time.Time
+	pace      time.Duration
+	paceSet   bool // pace was given on the command line, even if zero
+	dryRun    bool
+}
+
+// publishDays loads the configuration and publishes the selected days, or runs the daemon.
+// A config file declaring several profiles, none selected, runs every profile side by side.
+func publishDays(opts publishOptions) int {
+	cfgs, code := loadConfigs(opts.keyEnv, opts.overrides, !opts.dryRun, opts.mode)
+	if code >= 0 {
+		return code
+	}
+	if opts.dryRun {
+		// Dry runs preview the selected days and exit, in daemon mode too: no signing, relays, ledger or waits.
+		return previewDays(cfgs, opts.days, bot.PreviewFormatText)
+	}
+
+	sessions, err := openSessions(cfgs)
+	if err != nil {
+		return exitFailure
+	}
+	defer closeSessions(sessions)
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	if opts.mode == "daemon" {
+		return runDaemon(ctx, sessions)
+	}
+	return runSessions(sessions, func(s *session) int {
+		return s.publishDays(ctx, opts)
+	})
+}
+
+// publishDays publishes the selected days as the session's identity.
+func (s *session) publishDays(ctx context.Context, opts publishOptions) int {
+	pace := opts.pace
+	if !opts.paceSet {
+		pace = s.publisher.DefaultWaitTime()
+		if opts.mode == "backfill" {
+			pace = s.cfg.BackfillPace
+		}
+	}
+	days := opts.days
+	if len(days) > 1 {
+		s.logger.Info().Str("from", days[0].Format("2006-01-02")).Str("to", days[len(days)-1].Format("2006-01-02")).Int("days", len(days)).Dur("pace", pace).Msg("Publishing events for a range of dates.")
+	}
+
+	err := s.bot.RunDays(ctx, days, pace)
+	if errors.Is(err, context.Canceled) {
+		s.logger.Info().Msg("Bot execution interrupted. Remaining events will be resumed on the next start.")
+		s.finish("interrupted")
+		return exitInterrupted
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Fatal: Bot run failed. Bot will exit.")
+		s.finish("error")
+		return exitFailure
+	}
+
+	s.logger.Info().Msg("Bot execution finished for today.")
+	s.finish("run")
+	return exitOK
+}
+
+// runSessions calls run for every session concurrently and combines their exit codes:
+// interrupted if any session was interrupted, failure if any failed, success otherwise.
+func runSessions(sessions []*session, run func(s *session) int) int {
+	codes := make([]int, len(sessions))
+	var wg sync.WaitGroup
+	for i, s := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = run(s)
+		}()
+	}
+	wg.Wait()
+
+	result := exitOK
+	for _, code := range codes {
+		switch {
+		case code == exitInterrupted:
+			return exitInterrupted
+		case code != exitOK:
+			result = code
+		}
+	}
+	return result
+}
+
+// session is everything a publishing command needs for one identity: its signer, the
+// ledger of its key, the relay publisher and the bot built on them.
+type session struct {
+	cfg        *config.Config
+	signer     signer.Signer
+	ledger     *ledger.Ledger
+	ownsLedger bool // The ledger file was opened by this session, not shared from another
+	publisher  *nostr.EventPublisher
+	bot        *bot.Bot
+	logger     zerolog.Logger
+}
+
+// openSessions opens one session per configuration. Sessions whose ledger path is the
+// same share the ledger file, each scoped to its own pubkey.
+func openSessions(cfgs []*config.Config) ([]*session, error) {
+	ledgers := make(map[string]*ledger.Ledger)
+	sessions := make([]*session, 0, len(cfgs))
+	pubkeys := make(map[string]string) // Public key -> first profile signing with it
+	for _, cfg := range cfgs {
+		s, err := openSession(cfg, ledgers)
+		if err != nil {
+			closeSessions(sessions)
+			return nil, err
+		}
+		sessions = append(sessions, s)
+		// Remote signers only reveal their key once connected, so config loading cannot catch this.
+		if other, ok := pubkeys[s.signer.PublicKey()]; ok {
+			err := fmt.Errorf("profiles %s and %s sign with the same key; each profile run in one process needs its own identity", other, cfg.Profile)
+			s.logger.Error().Err(err).Msg("Fatal: Duplicate signing identity. Bot will exit.")
+			closeSessions(sessions)
+			return nil, err
+		}
+		pubkeys[s.signer.PublicKey()] = cfg.Profile
+	}
+	return sessions, nil
+}
+
+// openSession sets up the signer, opens the publish ledger and creates the bot.
+// ledgers holds the ledger files other sessions of this process already opened, by
+// path, and may be nil for a single session. Failures are logged; the caller only has to exit.
+func openSession(cfg *config.Config, ledgers map[string]*ledger.Ledger) (*session, error) {
+	logger := sessionLogger(cfg)
+	eventSigner, err := newSigner(cfg, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("Fatal: Failed to set up the event signer. Bot will exit.")
+		return nil, err
+	}
+	pubkey := eventSigner.PublicKey()
+
+	var publishLedger *ledger.Ledger
+	shared := ledgers[cfg.LedgerPath]
+	if shared != nil {
+		publishLedger, err = shared.ForPubkey(pubkey)
+	} else {
+		publishLedger, err = ledger.Open(cfg.LedgerPath, pubkey)
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("path", cfg.LedgerPath).Msg("Fatal: Failed to open publish ledger. Bot will exit.")
+		eventSigner.Close()
+		return nil, err
+	}
+	if shared == nil && ledgers != nil {
+		ledgers[cfg.LedgerPath] = publishLedger
+	}
+	s := &session{cfg: cfg, signer: eventSigner, ledger: publishLedger, ownsLedger: shared == nil, logger: logger}
+	logger.Info().Str("path", cfg.LedgerPath).Msg("Publish ledger opened.")
+
+	templates, err := bot.ParseTemplates(cfg.Templates)
+	if err != nil {
+		logger.Error().Err(err).Msg("Fatal: Failed to parse content templates. Bot will exit.")
+		s.Close()
+		return nil, err
+	}
+
+	apiClient := api.NewClient(cfg.APIEndpoint, cfg.APIKey)
+	s.publisher = nostr.NewEventPublisher(cfg.NostrRelays, eventSigner, metrics.NewCollector(), logger)
+	s.publisher.SetKindRelays(cfg.KindRelays)
+	imageValidator := nostr.NewImageValidator(cfg.ImageMaxBytes, cfg.VideoMaxBytes)
+	s.bot = bot.New(apiClient, s.publisher, imageValidator, publishLedger, cfg.ProcessingLanguage, logger)
+	s.bot.SetMetricsRetention(cfg.MetricsRetentionDays)
+	s.bot.SetTemplates(templates)
+	s.bot.SetCalendar(cfg.CalendarTitle)
+	s.bot.SetMaxImages(cfg.ImageMaxPerEvent)
+	switch {
+	case cfg.BlossomServer != "":
+		s.bot.SetMediaStore(blossom.NewClient(cfg.BlossomServer, eventSigner))
+	case cfg.NIP96Server != "":
+		s.bot.SetMediaStore(nip96.NewClient(cfg.NIP96Server, eventSigner))
+	}
+	if cfg.ProcessImages {
+		s.bot.SetImageProcessor(media.NewProcessor(cfg.ImageProcessing))
+	}
+	if cfg.Cards {
+		renderer, err := card.NewRenderer(cfg.Card)
+		if err != nil {
+			logger.Error().Err(err).Msg("Fatal: Failed to load the quote card style. Bot will exit.")
+			s.Close()
+			return nil, err
+		}
+		s.bot.SetCards(renderer)
+	}
+	if cfg.Profile != "" {
+		s.bot.SetMetricsDir(filepath.Join(bot.DefaultMetricsDir, cfg.Profile))
+	}
+	return s, nil
+}
+
+// newSigner returns the signer of cfg's identity: the remote signer of its bunker URL if
+// one is set, with the private key, if any, as the client key, or the private key itself.
+func newSigner(cfg *config.Config, logger zerolog.Logger) (signer.Signer, error) {
+	if cfg.BunkerURL == "" {
+		logger.Info().Str("npub", cfg.PrivateKey.Npub()).Msg("Private key loaded.")
+		return signer.NewLocal(cfg.PrivateKey), nil
+	}
+
+	clientKey := cfg.PrivateKey
+	if clientKey.IsZero() {
+		var err error
+		clientKey, err = keys.Parse(gonostr.GeneratePrivateKey(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate client key: %w", err)
+		}
+		logger.Warn().Str("clientNpub", clientKey.Npub()).Msg("No client key configured for the remote signer. Using a new one; the signer has to accept the bot again on every start.")
+	} else {
+		logger.Info().Str("clientNpub", clientKey.Npub()).Msg("Connecting to remote signer with the configured client key.")
+	}
+	return signer.ConnectBunker(context.Background(), cfg.BunkerURL, clientKey, cfg.SignerTimeout, nostr.SignedKinds, logger)
+}
+
+// sessionLogger returns the logger of one identity, tagged with its profile and language
+// when a config file profile is in use.
+func sessionLogger(cfg *config.Config) zerolog.Logger {
+	if cfg.Profile == "" {
+		return log.Logger
+	}
+	return log.Logger.With().Str("profile", cfg.Profile).Str("language", cfg.ProcessingLanguage).Logger()
+}
+
+// finish exports the metrics of the session's run and pushes them to the Pushgateway.
+func (s *session) finish(prefix string) {
+	s.bot.FinishRun(prefix)
+	pushMetrics(s.cfg, s.bot.Metrics())
+}
+
+// Close closes the relay and signer connections, and the ledger if the session opened it.
+func (s *session) Close() {
+	if s.publisher != nil {
+		s.publisher.Close()
+	}
+	s.signer.Close()
+	if s.ownsLedger {
+		s.ledger.Close()
+	}
+}
+
+// closeSessions closes the sessions, those sharing another session's ledger first.
+func closeSessions(sessions []*session) {
+	for i := len(sessions) - 1; i >= 0; i-- {
+		sessions[i].Close()
+	}
+}
+
+// runDaemon keeps the bots running across days, each posting its day's events at the
+// slots of its own schedule instead of relying on an external cron job. The metrics
+// endpoint serves every bot, told apart by their labels.
+func runDaemon(ctx context.Context, sessions []*session) int {
+	scheds := make(map[*session]*scheduler.Scheduler, len(sessions))
+	for _, s := range sessions {
+		start, err := scheduler.ParseClock(s.cfg.ScheduleStart)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("Fatal: Invalid daemon schedule. Bot will exit.")
+			return exitConfig
+		}
+		scheds[s] = scheduler.New(start, s.cfg.ScheduleInterval, time.Local, s.logger)
+	}
+
+	// The metrics address is a top-level setting, the same for every session.
+	if addr := sessions[0].cfg.MetricsAddr; addr != "" {
+		sources := make([]metrics.Source, 0, len(sessions))
+		for _, s := range sessions {
+			sources = append(sources, metrics.Source{Collector: s.bot.Metrics, Labels: metricsLabels(s.cfg)})
+		}
+		go func() {
+			log.Info().Str("addr", addr).Msg("Serving Prometheus metrics on /metrics.")
+			if err := metrics.Serve(ctx, addr, metrics.Handler(sources...)); err != nil {
+				log.Error().Err(err).Msg("Metrics endpoint stopped. Posting continues without it.")
+			}
+		}()
+	}
+
+	return runSessions(sessions, func(s *session) int {
+		sched := scheds[s]
+		s.logger.Info().Str("firstSlot", s.cfg.ScheduleStart).Dur("interval", s.cfg.ScheduleInterval).Msg("Starting daemon mode.")
+		err := sched.Run(ctx, func(ctx context.Context, day time.Time) error {
+			return s.bot.RunScheduledDay(ctx, sched, day)
+		})
+		s.logger.Info().Err(err).Msg("Daemon stopped.")
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return exitFailure
+		}
+		return exitOK
+	})
+}
+
+// metricsLabels returns the labels that identify this bot instance in Prometheus.
+func metricsLabels(cfg *config.Config) map[string]string {
+	labels := map[string]string{"language": cfg.ProcessingLanguage}
+	if cfg.Profile != "" {
+		labels["profile"] = cfg.Profile
+	}
+	return labels
+}
+
+// pushMetrics sends the metrics of a finished one-shot run to the Pushgateway, if one is configured.
+// A failed push is logged but does not fail the run.
+func pushMetrics(cfg *config.Config, collector *metrics.Collector) {
+	if cfg.PushgatewayURL == "" {
+		return
+	}
+	// Use a fresh context: the run context may already be cancelled by a shutdown signal.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := collector.Push(ctx, cfg.PushgatewayURL, cfg.PushgatewayJob, metricsLabels(cfg)); err != nil {
+		log.Error().Err(err).Str("pushgateway", cfg.PushgatewayURL).Msg("Failed to push metrics to the Pushgateway.")
+		return
+	}
+	log.Info().Str("pushgateway", cfg.PushgatewayURL).Str("job", cfg.PushgatewayJob).Msg("Metrics pushed to the Pushgateway.")
+}
+
+// today returns local midnight of now's day.
+func today(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
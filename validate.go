@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"calendar-bot/internal/config"
+)
+
+// runValidate implements `calendar-bot validate`: it loads the configuration exactly as a
+// run would and reports whether it is valid. Without ENV_VAR, a key file or a selected
+// profile, the settings that only publishing needs (private key, relays) are not checked.
+func runValidate(args []string) int {
+	fs := newFlagSet("validate", "[flags] [ENV_VAR]", "Check the configuration from the environment, .env and flags, and exit with 0 if it is valid or 3 if not.\nWithout ENV_VAR, --key-file or a selected profile the private key and relays are not checked.")
+	keyEnv := fs.String("key-env", "", "env var holding the private key (instead of ENV_VAR)")
+	overrides := addConfigFlags(fs)
+	positional, code := parseFlags(fs, args)
+	if code >= 0 {
+		return code
+	}
+	keyEnvVar, code := keyEnvName(fs, *keyEnv, positional)
+	if code >= 0 {
+		return code
+	}
+
+	cfg, err := config.Read(keyEnvVar, overrides()...)
+	if err == nil {
+		err = validateFor(cfg)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		return exitConfig
+	}
+	fmt.Println("Configuration is valid.")
+	return exitOK
+}
+
+// runConfig implements `calendar-bot config`: it prints the effective configuration after
+// the environment, .env and flags are applied, with the API key and private key redacted.
+// The configuration is printed even if it is invalid, followed by the validation error.
+func runConfig(args []string) int {
+	fs := newFlagSet("config", "[flags] [ENV_VAR]", "Print the effective configuration, with secrets redacted.")
+	keyEnv := fs.String("key-env", "", "env var holding the private key (instead of ENV_VAR)")
+	format := fs.String("format", "text", "output format: text or json")
+	overrides := addConfigFlags(fs)
+	positional, code := parseFlags(fs, args)
+	if code >= 0 {
+		return code
+	}
+	keyEnvVar, code := keyEnvName(fs, *keyEnv, positional)
+	if code >= 0 {
+		return code
+	}
+	if *format != "text" && *format != "json" {
+		return usageError(fs, "Invalid --format '%s'. Must be text or json", *format)
+	}
+
+	cfg, err := config.Read(keyEnvVar, overrides()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		return exitConfig
+	}
+	redacted := cfg.Redacted()
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(redacted); err != nil {
+			return exitFailure
+		}
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, row := range [][2]string{
+			{"APIEndpoint", redacted.APIEndpoint},
+			{"APIKey", redacted.APIKey},
+			{"EnvVarForPrivateKey", redacted.EnvVarForPrivateKey},
+			{"KeyFile", redacted.KeyFile},
+			{"KeyPasswordEnv", redacted.KeyPasswordEnv},
+			{"KeyPasswordFile", redacted.KeyPasswordFile},
+			{"PrivateKey", redacted.PrivateKey.String()},
+			{"PublicKey", redacted.PrivateKey.Npub()},
+			{"BunkerURL", redacted.BunkerURL},
+			{"BunkerEnv", redacted.BunkerEnv},
+			{"SignerTimeout", redacted.SignerTimeout.String()},
+			{"ProcessingLanguage", redacted.ProcessingLanguage},
+			{"NostrRelays", strings.Join(redacted.NostrRelays, ",")},
+			{"LogDir", redacted.LogDir},
+			{"LogLevel", redacted.LogLevel},
+			{"ConsoleLog", fmt.Sprint(redacted.ConsoleLog)},
+			{"Debug", fmt.Sprint(redacted.Debug)},
+			{"LedgerPath", redacted.LedgerPath},
+			{"ScheduleStart", redacted.ScheduleStart},
+			{"ScheduleInterval", redacted.ScheduleInterval.String()},
+			{"MetricsAddr", redacted.MetricsAddr},
+			{"PushgatewayURL", redacted.PushgatewayURL},
+			{"PushgatewayJob", redacted.PushgatewayJob},
+			{"MetricsRetentionDays", fmt.Sprint(redacted.MetricsRetentionDays)},
+			{"BackfillPace", redacted.BackfillPace.String()},
+			{"ConfigFile", redacted.ConfigFile},
+			{"Profile", redacted.Profile},
+			{"CalendarTitle", redacted.CalendarTitle},
+			{"ImageMaxBytes", fmt.Sprint(redacted.ImageMaxBytes)},
+			{"VideoMaxBytes", fmt.Sprint(redacted.VideoMaxBytes)},
+			{"ImageMaxPerEvent", fmt.Sprint(redacted.ImageMaxPerEvent)},
+			{"BlossomServer", redacted.BlossomServer},
+			{"NIP96Server", redacted.NIP96Server},
+			{"ProcessImages", fmt.Sprint(redacted.ProcessImages)},
+			{"ImageMaxDimensions", fmt.Sprintf("%dx%d", redacted.ImageProcessing.MaxWidth, redacted.ImageProcessing.MaxHeight)},
+			{"ImageOutputMaxBytes", fmt.Sprint(redacted.ImageProcessing.MaxBytes)},
+			{"ImageQuality", fmt.Sprint(redacted.ImageProcessing.Quality)},
+			{"ImageThumbSize", fmt.Sprint(redacted.ImageProcessing.ThumbSize)},
+			{"Cards", fmt.Sprint(redacted.Cards)},
+			{"CardSize", fmt.Sprintf("%dx%d", redacted.Card.Width, redacted.Card.Height)},
+			{"CardFont", redacted.Card.Font},
+			{"CardBoldFont", redacted.Card.BoldFont},
+			{"CardLogo", redacted.Card.Logo},
+			{"CardColors", strings.Join([]string{redacted.Card.Background, redacted.Card.Foreground, redacted.Card.Accent}, ",")},
+			{"KindRelays", formatKindRelays(redacted.KindRelays)},
+			{"Templates", strings.Join(config.SortedKeys(redacted.Templates), ",")},
+			{"Profiles", strings.Join(redacted.ProfileNames(), ",")},
+		} {
+			fmt.Fprintf(tw, "%s\t%s\n", row[0], row[1])
+		}
+		if err := tw.Flush(); err != nil {
+			return exitFailure
+		}
+	}
+
+	if err := validateFor(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration is invalid: %v\n", err)
+		return exitConfig
+	}
+	return exitOK
+}
+
+// validateFor validates everything a run needs if cfg names a private key env var, key file
+// or remote signer, either given directly or by the selected profile, and only the general
+// settings otherwise.
+func validateFor(cfg *config.Config) error {
+	if cfg.EnvVarForPrivateKey != "" || cfg.KeyFile != "" || cfg.BunkerURL != "" || cfg.BunkerEnv != "" {
+		return cfg.Validate()
+	}
+	return cfg.ValidateSettings()
+}
+
+// formatKindRelays formats per-kind relays as kind=relay|relay pairs, e.g.
+// "kind20=wss://a|wss://b".
+func formatKindRelays(kindRelays map[string][]string) string {
+	pairs := make([]string, 0, len(kindRelays))
+	for _, kind := range config.SortedKeys(kindRelays) {
+		pairs = append(pairs, kind+"="+strings.Join(kindRelays[kind], "|"))
+	}
+	return strings.Join(pairs, " ")
+}